@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"strings"
+)
+
+var gifPaletteModes = map[string]bool{
+	"frame":  true,
+	"global": true,
+}
+
+// Animation holds the composed frames of an animated GIF.  Every frame is the
+// full canvas as it is shown, so transformations never see partial frames.
+type Animation struct {
+	frames [][][]color.Color
+	// Delays in 100ths of a second
+	delays    []int
+	loopCount int
+}
+
+type GIFSettings struct {
+	// frame quantizes every frame on its own, global uses one palette
+	palette string
+	dither  bool
+}
+
+func parseGIFPaletteMode(value string) (string, error) {
+	mode := strings.ToLower(value)
+	if !gifPaletteModes[mode] {
+		return "", fmt.Errorf("unknown GIF palette mode: %v (use frame or global)", value)
+	}
+	return mode, nil
+}
+
+// DecodeAnimation decodes every frame of a GIF, drawing each over the canvas
+// left by the previous frame and its disposal method.
+func DecodeAnimation(reader io.Reader, name string, maxPixels int64) (Animation, error) {
+	var animation Animation
+
+	decoded, err := gif.DecodeAll(reader)
+	if err != nil {
+		return animation, &DecodeError{Path: name, Err: err}
+	}
+
+	canvasBounds := image.Rect(0, 0, decoded.Config.Width, decoded.Config.Height)
+	if int64(canvasBounds.Dx())*int64(canvasBounds.Dy())*int64(len(decoded.Image)) > maxPixels {
+		err = fmt.Errorf("%w: %v frames of %vx%v pixels are above the %v pixel limit", errImageTooLarge, len(decoded.Image), canvasBounds.Dx(), canvasBounds.Dy(), maxPixels)
+		return animation, &DecodeError{Path: name, Err: err}
+	}
+
+	canvas := image.NewRGBA(canvasBounds)
+	for index, frame := range decoded.Image {
+		disposal := byte(gif.DisposalNone)
+		if index < len(decoded.Disposal) {
+			disposal = decoded.Disposal[index]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvasBounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		pixels, err := CreatePixelArrayFromImage(canvas)
+		if err != nil {
+			return animation, &DecodeError{Path: name, Err: err}
+		}
+		animation.frames = append(animation.frames, pixels)
+		animation.delays = append(animation.delays, decoded.Delay[index])
+
+		switch disposal {
+		case gif.DisposalBackground:
+			// Viewers clear to transparent rather than the background color
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	animation.loopCount = decoded.LoopCount
+	return animation, nil
+}
+
+// TransformAnimation runs the transformation list on every frame.
+func TransformAnimation(animation Animation, transformationList []TransformationType, options TransformOptions) (Animation, error) {
+	transformed := Animation{delays: animation.delays, loopCount: animation.loopCount}
+	for index, frame := range animation.frames {
+		pixels, err := ProcessListOfTransformationsWithOptions(frame, transformationList, options)
+		if err != nil {
+			return transformed, fmt.Errorf("frame %v: %w", index+1, err)
+		}
+		transformed.frames = append(transformed.frames, pixels)
+	}
+	return transformed, nil
+}
+
+// EncodeAnimation writes the frames as an animated GIF with their delays and
+// loop count.  The frames are whole canvases, so each one replaces the last.
+func EncodeAnimation(w io.Writer, animation Animation, settings GIFSettings, name string) error {
+	var images []image.Image
+	for _, frame := range animation.frames {
+		img, err := CreateImageFromPixelArray(frame)
+		if err != nil {
+			return &EncodeError{Path: name, Err: err}
+		}
+		images = append(images, img)
+	}
+	if len(images) == 0 {
+		return &EncodeError{Path: name, Err: fmt.Errorf("animation has no frames")}
+	}
+
+	bounds := images[0].Bounds()
+	encoded := &gif.GIF{LoopCount: animation.loopCount}
+
+	var globalPalette color.Palette
+	if settings.palette == "global" {
+		globalPalette = MedianCutPalette(images, 256)
+		encoded.Config = image.Config{ColorModel: globalPalette, Width: bounds.Dx(), Height: bounds.Dy()}
+	}
+
+	var drawer draw.Drawer = draw.Src
+	if settings.dither {
+		drawer = draw.FloydSteinberg
+	}
+
+	for index, img := range images {
+		palette := globalPalette
+		if palette == nil {
+			palette = MedianCutPalette([]image.Image{img}, 256)
+		}
+		if len(palette) == 0 {
+			palette = color.Palette{color.RGBA{}}
+		}
+
+		paletted := image.NewPaletted(img.Bounds(), palette)
+		drawer.Draw(paletted, img.Bounds(), img, image.Point{})
+		encoded.Image = append(encoded.Image, paletted)
+		encoded.Delay = append(encoded.Delay, animation.delays[index])
+		encoded.Disposal = append(encoded.Disposal, gif.DisposalBackground)
+	}
+
+	if err := gif.EncodeAll(w, encoded); err != nil {
+		return &EncodeError{Path: name, Err: err}
+	}
+	return nil
+}
+
+// processAnimation keeps every frame of a GIF written as a GIF.
+func processAnimation(params Transformation, data []byte, inputFile string, outputFile string) error {
+	animation, err := DecodeAnimation(bytes.NewReader(data), imageSourceName(inputFile), maxImagePixels)
+	if err != nil {
+		return err
+	}
+
+	animation, err = TransformAnimation(animation, params.transformList, params.options)
+	if err != nil {
+		return err
+	}
+
+	var encoded bytes.Buffer
+	if err := EncodeAnimation(&encoded, animation, params.gif, outputFile); err != nil {
+		return err
+	}
+	if err := writeOutputData(outputFile, encoded.Bytes()); err != nil {
+		return err
+	}
+
+	if params.preview.enabled {
+		return writePreview(previewWriter(outputFile), animation.frames[0], params.preview, os.Getenv)
+	}
+	return nil
+}
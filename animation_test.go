@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"testing"
+)
+
+var animationPalette = color.Palette{
+	color.RGBA{},
+	color.RGBA{255, 0, 0, 255},
+	color.RGBA{0, 0, 255, 255},
+	color.RGBA{0, 255, 0, 255},
+}
+
+// createTestAnimation is a 4x4 red canvas, a blue 2x2 square drawn in the top
+// left and then disposed to the background, and a green pixel in the bottom
+// right drawn over what is left.
+func createTestAnimation(t *testing.T) []byte {
+	red := image.NewPaletted(image.Rect(0, 0, 4, 4), animationPalette)
+	for index := range red.Pix {
+		red.Pix[index] = 1
+	}
+	blue := image.NewPaletted(image.Rect(0, 0, 2, 2), animationPalette)
+	for index := range blue.Pix {
+		blue.Pix[index] = 2
+	}
+	green := image.NewPaletted(image.Rect(3, 3, 4, 4), animationPalette)
+	green.Pix[0] = 3
+
+	var data bytes.Buffer
+	err := gif.EncodeAll(&data, &gif.GIF{
+		Image:     []*image.Paletted{red, blue, green},
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		LoopCount: 3,
+		Config:    image.Config{ColorModel: animationPalette, Width: 4, Height: 4},
+	})
+	if err != nil {
+		t.Fatalf("could not encode test animation: %v", err)
+	}
+	return data.Bytes()
+}
+
+func checkAnimationPixel(t *testing.T, animation Animation, frame int, x int, y int, expected color.RGBA) {
+	actual := color.RGBAModel.Convert(animation.frames[frame][x][y]).(color.RGBA)
+	if actual != expected {
+		t.Errorf("frame %v pixel %v,%v: expected %v, got %v", frame, x, y, expected, actual)
+	}
+}
+
+func TestDecodeAnimation(t *testing.T) {
+	animation, err := DecodeAnimation(bytes.NewReader(createTestAnimation(t)), "test", maxImagePixels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(animation.frames) != 3 || animation.loopCount != 3 {
+		t.Fatalf("expected 3 frames looping 3 times, got %v frames and %v", len(animation.frames), animation.loopCount)
+	}
+	if animation.delays[0] != 10 || animation.delays[1] != 20 || animation.delays[2] != 30 {
+		t.Errorf("unexpected delays %v", animation.delays)
+	}
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	checkAnimationPixel(t, animation, 1, 0, 0, blue)
+	checkAnimationPixel(t, animation, 1, 3, 3, red)
+	// The blue square is cleared to transparent, the rest stays red
+	checkAnimationPixel(t, animation, 2, 0, 0, color.RGBA{})
+	checkAnimationPixel(t, animation, 2, 2, 2, red)
+	checkAnimationPixel(t, animation, 2, 3, 3, green)
+
+	if _, err := DecodeAnimation(bytes.NewReader(createTestAnimation(t)), "test", 47); !errors.Is(err, errImageTooLarge) {
+		t.Errorf("expected the frames to count towards the pixel limit, got %v", err)
+	}
+	if _, err := DecodeAnimation(bytes.NewReader([]byte("GIF89a")), "test", maxImagePixels); exitCodeForError(err) != exitDecode {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+}
+
+func TestDecodeAnimationDisposePrevious(t *testing.T) {
+	red := image.NewPaletted(image.Rect(0, 0, 2, 1), animationPalette)
+	red.Pix[0], red.Pix[1] = 1, 1
+	blue := image.NewPaletted(image.Rect(0, 0, 1, 1), animationPalette)
+	blue.Pix[0] = 2
+	green := image.NewPaletted(image.Rect(1, 0, 2, 1), animationPalette)
+	green.Pix[0] = 3
+
+	var data bytes.Buffer
+	gif.EncodeAll(&data, &gif.GIF{
+		Image:    []*image.Paletted{red, blue, green},
+		Delay:    []int{0, 0, 0},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalNone},
+		Config:   image.Config{ColorModel: animationPalette, Width: 2, Height: 1},
+	})
+
+	animation, err := DecodeAnimation(&data, "test", maxImagePixels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The blue pixel is undone before the green one is drawn
+	checkAnimationPixel(t, animation, 1, 0, 0, color.RGBA{0, 0, 255, 255})
+	checkAnimationPixel(t, animation, 2, 0, 0, color.RGBA{255, 0, 0, 255})
+	checkAnimationPixel(t, animation, 2, 1, 0, color.RGBA{0, 255, 0, 255})
+}
+
+func TestEncodeAnimationRoundTrip(t *testing.T) {
+	animation, err := DecodeAnimation(bytes.NewReader(createTestAnimation(t)), "test", maxImagePixels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	animation, err = TransformAnimation(animation, []TransformationType{SwapRB}, TransformOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, settings := range []GIFSettings{{palette: "frame"}, {palette: "global"}, {palette: "frame", dither: true}} {
+		var data bytes.Buffer
+		if err := EncodeAnimation(&data, animation, settings, "test"); err != nil {
+			t.Fatalf("%+v: unexpected error: %v", settings, err)
+		}
+
+		decoded, err := gif.DecodeAll(bytes.NewReader(data.Bytes()))
+		if err != nil {
+			t.Fatalf("%+v: could not decode the result: %v", settings, err)
+		}
+		if len(decoded.Image) != 3 || decoded.LoopCount != 3 || decoded.Delay[2] != 30 {
+			t.Errorf("%+v: expected 3 frames, loop count and delays, got %v %v %v", settings, len(decoded.Image), decoded.LoopCount, decoded.Delay)
+		}
+		if settings.palette == "global" && decoded.Config.ColorModel == nil {
+			t.Errorf("expected a global color table")
+		}
+
+		roundTrip, _ := DecodeAnimation(bytes.NewReader(data.Bytes()), "test", maxImagePixels)
+		// Red and blue are swapped in every frame
+		checkAnimationPixel(t, roundTrip, 0, 0, 0, color.RGBA{0, 0, 255, 255})
+		checkAnimationPixel(t, roundTrip, 1, 0, 0, color.RGBA{255, 0, 0, 255})
+		checkAnimationPixel(t, roundTrip, 2, 0, 0, color.RGBA{})
+	}
+
+	if err := EncodeAnimation(&bytes.Buffer{}, Animation{}, GIFSettings{}, "test"); exitCodeForError(err) != exitEncode {
+		t.Errorf("expected an encode error, got %v", err)
+	}
+}
+
+func TestRunAnimation(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := tmpDir + "/input.gif"
+	if err := os.WriteFile(input, createTestAnimation(t), 0644); err != nil {
+		t.Fatalf("could not write input: %v", err)
+	}
+
+	if code := run([]string{"-i", input, "-o", tmpDir + "/result.gif", "-g", "-gif-palette", "global"}); code != exitOK {
+		t.Fatalf("run exited with %v", code)
+	}
+	data, _ := os.ReadFile(tmpDir + "/result.gif")
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(decoded.Image) != 3 {
+		t.Fatalf("expected an animated result, got %v", err)
+	}
+
+	// Any other format keeps the first frame only
+	if code := run([]string{"-i", input, "-o", tmpDir + "/result.png", "--format", "png"}); code != exitOK {
+		t.Fatalf("run exited with %v", code)
+	}
+
+	if code := run([]string{"-i", input, "-o", tmpDir + "/result.gif", "-gif-palette", "octree"}); code != exitInvalidParameter {
+		t.Errorf("expected an invalid parameter, got %v", code)
+	}
+}
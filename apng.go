@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image/color"
+	"io"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// writePNGChunk writes the length, type, data and CRC of a PNG chunk.
+func writePNGChunk(w io.Writer, chunkType string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], chunkType)
+
+	checksum := crc32.NewIEEE()
+	checksum.Write(header[4:])
+	checksum.Write(data)
+	footer := binary.BigEndian.AppendUint32(nil, checksum.Sum32())
+
+	for _, part := range [][]byte{header, data, footer} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compressPNGFrame stores the pixels as 8-bit RGBA scanlines without
+// filtering, compressed with zlib as PNG expects.
+func compressPNGFrame(pixels [][]color.Color) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+
+	width := len(pixels)
+	row := make([]byte, 1+4*width)
+	for y := 0; y < len(pixels[0]); y++ {
+		for x := 0; x < width; x++ {
+			pixel := color.NRGBAModel.Convert(pixels[x][y]).(color.NRGBA)
+			copy(row[1+4*x:], []byte{pixel.R, pixel.G, pixel.B, pixel.A})
+		}
+		if _, err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// EncodeAPNG writes the frames as an animated PNG that loops forever.  The
+// delays are in milliseconds.  Viewers without APNG support show the first
+// frame.
+func EncodeAPNG(w io.Writer, frames [][][]color.Color, delays []int) error {
+	if len(frames) == 0 || len(frames[0]) == 0 || len(frames[0][0]) == 0 {
+		return errors.New("animation has no frames")
+	}
+	width := len(frames[0])
+	height := len(frames[0][0])
+
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+
+	header := binary.BigEndian.AppendUint32(nil, uint32(width))
+	header = binary.BigEndian.AppendUint32(header, uint32(height))
+	// 8 bits per channel RGBA, deflate, adaptive filtering, no interlace
+	header = append(header, 8, 6, 0, 0, 0)
+	if err := writePNGChunk(w, "IHDR", header); err != nil {
+		return err
+	}
+
+	animationControl := binary.BigEndian.AppendUint32(nil, uint32(len(frames)))
+	// Loop forever
+	animationControl = binary.BigEndian.AppendUint32(animationControl, 0)
+	if err := writePNGChunk(w, "acTL", animationControl); err != nil {
+		return err
+	}
+
+	sequence := uint32(0)
+	for index, frame := range frames {
+		if len(frame) != width || len(frame[0]) != height {
+			return errors.New("all frames must have the same size")
+		}
+
+		frameControl := binary.BigEndian.AppendUint32(nil, sequence)
+		frameControl = binary.BigEndian.AppendUint32(frameControl, uint32(width))
+		frameControl = binary.BigEndian.AppendUint32(frameControl, uint32(height))
+		// Frame offset x and y
+		frameControl = binary.BigEndian.AppendUint32(frameControl, 0)
+		frameControl = binary.BigEndian.AppendUint32(frameControl, 0)
+		frameControl = binary.BigEndian.AppendUint16(frameControl, uint16(delays[index]))
+		frameControl = binary.BigEndian.AppendUint16(frameControl, 1000)
+		// Dispose to nothing, replace the previous pixels instead of blending
+		frameControl = append(frameControl, 0, 0)
+		if err := writePNGChunk(w, "fcTL", frameControl); err != nil {
+			return err
+		}
+		sequence++
+
+		data, err := compressPNGFrame(frame)
+		if err != nil {
+			return err
+		}
+		if index == 0 {
+			err = writePNGChunk(w, "IDAT", data)
+		} else {
+			err = writePNGChunk(w, "fdAT", append(binary.BigEndian.AppendUint32(nil, sequence), data...))
+			sequence++
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return writePNGChunk(w, "IEND", nil)
+}
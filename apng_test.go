@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+type pngChunk struct {
+	chunkType string
+	data      []byte
+}
+
+func readPNGChunks(t *testing.T, data []byte) []pngChunk {
+	if !bytes.HasPrefix(data, pngSignature) {
+		t.Fatalf("missing PNG signature")
+	}
+	var chunks []pngChunk
+	for offset := len(pngSignature); offset < len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		chunks = append(chunks, pngChunk{string(data[offset+4 : offset+8]), data[offset+8 : offset+8+length]})
+		offset += 12 + length
+	}
+	return chunks
+}
+
+func TestEncodeAPNG(t *testing.T) {
+	red := create2DArraySingleColor(testRed)
+	blue := create2DArraySingleColor(testBlue)
+	green := create2DArraySingleColor(testGreen)
+
+	var encoded bytes.Buffer
+	if err := EncodeAPNG(&encoded, [][][]color.Color{red, blue, green}, []int{100, 40, 1000}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Decoders without APNG support show the first frame
+	img, err := png.Decode(bytes.NewReader(encoded.Bytes()))
+	if err != nil {
+		t.Fatalf("not a valid PNG: %v", err)
+	}
+	if r, g, b, _ := img.At(0, 0).RGBA(); r>>8 != 255 || g != 0 || b != 0 {
+		t.Errorf("expected the first frame to be red, got %v", img.At(0, 0))
+	}
+
+	var types []string
+	var sequence []uint32
+	var delays []uint16
+	for _, chunk := range readPNGChunks(t, encoded.Bytes()) {
+		types = append(types, chunk.chunkType)
+		switch chunk.chunkType {
+		case "acTL":
+			if frames := binary.BigEndian.Uint32(chunk.data); frames != 3 {
+				t.Errorf("expected 3 frames in acTL, got %v", frames)
+			}
+		case "fcTL":
+			sequence = append(sequence, binary.BigEndian.Uint32(chunk.data))
+			delays = append(delays, binary.BigEndian.Uint16(chunk.data[20:]))
+		case "fdAT":
+			sequence = append(sequence, binary.BigEndian.Uint32(chunk.data))
+		}
+	}
+
+	expectedTypes := []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}
+	if len(types) != len(expectedTypes) {
+		t.Fatalf("expected chunks %v, got %v", expectedTypes, types)
+	}
+	for index := range types {
+		if types[index] != expectedTypes[index] {
+			t.Fatalf("expected chunks %v, got %v", expectedTypes, types)
+		}
+	}
+	for index, number := range sequence {
+		if number != uint32(index) {
+			t.Errorf("expected sequence numbers counting from 0, got %v", sequence)
+			break
+		}
+	}
+	if delays[0] != 100 || delays[1] != 40 || delays[2] != 1000 {
+		t.Errorf("unexpected delays %v", delays)
+	}
+}
+
+func TestEncodeAPNGErrors(t *testing.T) {
+	if err := EncodeAPNG(&bytes.Buffer{}, nil, nil); err == nil {
+		t.Errorf("expected an error without frames")
+	}
+	frames := [][][]color.Color{createGray2DArray(), createTwoToneArray(testRed, testBlue)}
+	if err := EncodeAPNG(&bytes.Buffer{}, frames, []int{10, 10}); err == nil {
+		t.Errorf("expected an error for frames of different sizes")
+	}
+}
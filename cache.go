@@ -0,0 +1,164 @@
+package main
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache files are named after a SHA-256 key and an image format.  Anything
+// else in the directory belongs to someone else and is left alone.
+var cacheFileName = regexp.MustCompile(`^([0-9a-f]{64})\.([a-z]+)$`)
+
+// DiskCache keeps encoded images on disk under their content address and
+// evicts the least recently used ones when the size limit is exceeded.  The
+// file modification times record the use order across restarts.
+type DiskCache struct {
+	dir        string
+	maxBytes   int64
+	mutex      sync.Mutex
+	order      *list.List
+	entries    map[string]*list.Element
+	totalBytes int64
+}
+
+type cacheEntry struct {
+	key    string
+	format string
+	size   int64
+}
+
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, &IOError{Path: dir, Err: err}
+	}
+
+	cache := &DiskCache{dir: dir, maxBytes: maxBytes, order: list.New(), entries: make(map[string]*list.Element)}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, &IOError{Path: dir, Err: err}
+	}
+
+	type existingFile struct {
+		entry    cacheEntry
+		modified time.Time
+	}
+	var existing []existingFile
+	for _, file := range files {
+		match := cacheFileName.FindStringSubmatch(file.Name())
+		if match == nil || file.IsDir() {
+			continue
+		}
+		key, format := match[1], match[2]
+		if _, ok := imageContentTypes[format]; !ok {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		existing = append(existing, existingFile{cacheEntry{key, format, info.Size()}, info.ModTime()})
+	}
+
+	// Oldest first, so the most recently used file ends up at the front
+	sort.Slice(existing, func(i, j int) bool { return existing[i].modified.Before(existing[j].modified) })
+	for _, file := range existing {
+		entry := file.entry
+		cache.entries[entry.key] = cache.order.PushFront(&entry)
+		cache.totalBytes += entry.size
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.evict()
+	return cache, nil
+}
+
+func (cache *DiskCache) path(entry *cacheEntry) string {
+	return filepath.Join(cache.dir, entry.key+"."+entry.format)
+}
+
+// Get returns the cached data and its image format.
+func (cache *DiskCache) Get(key string) ([]byte, string, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, "", false
+	}
+	entry := element.Value.(*cacheEntry)
+
+	data, err := os.ReadFile(cache.path(entry))
+	if err != nil {
+		// Removed behind our back, forget it
+		cache.remove(element)
+		return nil, "", false
+	}
+
+	cache.order.MoveToFront(element)
+	now := time.Now()
+	os.Chtimes(cache.path(entry), now, now)
+	return data, entry.format, true
+}
+
+func (cache *DiskCache) Put(key string, format string, data []byte) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+
+	entry := &cacheEntry{key, format, int64(len(data))}
+	// Write to a temporary file first so readers never see a partial image
+	temp, err := os.CreateTemp(cache.dir, "tmp-*")
+	if err != nil {
+		return &IOError{Path: cache.dir, Err: err}
+	}
+	_, err = temp.Write(data)
+	closeErr := temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), cache.path(entry))
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return &IOError{Path: cache.path(entry), Err: err}
+	}
+
+	cache.entries[key] = cache.order.PushFront(entry)
+	cache.totalBytes += entry.size
+	cache.evict()
+	return nil
+}
+
+// evict removes least recently used entries until the cache fits.  The
+// caller holds the mutex.
+func (cache *DiskCache) evict() {
+	for cache.totalBytes > cache.maxBytes && cache.order.Len() > 0 {
+		element := cache.order.Back()
+		os.Remove(cache.path(element.Value.(*cacheEntry)))
+		cache.remove(element)
+	}
+}
+
+func (cache *DiskCache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	cache.order.Remove(element)
+	delete(cache.entries, entry.key)
+	cache.totalBytes -= entry.size
+}
+
+func (cache *DiskCache) Size() int64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.totalBytes
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Keys are SHA-256 hashes, so repeat a hex digit to get one of the right form.
+var keyA = strings.Repeat("a", 64)
+var keyB = strings.Repeat("b", 64)
+var keyC = strings.Repeat("c", 64)
+
+func TestDiskCacheGetPut(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, _, ok := cache.Get(strings.Repeat("0", 64)); ok {
+		t.Errorf("expected a miss for an unknown key")
+	}
+	if err := cache.Put(keyA, "png", []byte("data")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, format, ok := cache.Get(keyA)
+	if !ok || format != "png" || !bytes.Equal(data, []byte("data")) {
+		t.Errorf("expected the stored data, got %q %v %v", data, format, ok)
+	}
+	if cache.Size() != 4 {
+		t.Errorf("expected size 4, got %v", cache.Size())
+	}
+}
+
+func TestDiskCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cache.Put(keyA, "png", []byte("aaaa"))
+	cache.Put(keyB, "png", []byte("bbbb"))
+	// Using a makes b the least recently used entry
+	cache.Get(keyA)
+	cache.Put(keyC, "png", []byte("cccc"))
+
+	if _, _, ok := cache.Get(keyB); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	for _, key := range []string{keyA, keyC} {
+		if _, _, ok := cache.Get(key); !ok {
+			t.Errorf("expected %v to be kept", key)
+		}
+	}
+	if cache.Size() != 8 {
+		t.Errorf("expected size 8, got %v", cache.Size())
+	}
+	if _, err := os.Stat(filepath.Join(cache.dir, keyB+".png")); !os.IsNotExist(err) {
+		t.Errorf("expected the evicted file to be removed, got %v", err)
+	}
+}
+
+func TestDiskCacheReopen(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cache.Put(keyA, "jpeg", []byte("data"))
+
+	reopened, err := NewDiskCache(dir, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, format, ok := reopened.Get(keyA); !ok || format != "jpeg" || string(data) != "data" {
+		t.Errorf("expected the entry to survive a restart, got %q %v %v", data, format, ok)
+	}
+
+	// A smaller limit evicts on open
+	shrunk, err := NewDiskCache(dir, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shrunk.Size() != 0 {
+		t.Errorf("expected an empty cache, got size %v", shrunk.Size())
+	}
+}
+
+func TestDiskCacheKeepsForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"holiday.jpg", keyA + ".txt", "tmp-123"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("not a cache entry"), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, keyB+".png"), []byte("cached"), 0644)
+
+	cache, err := NewDiskCache(dir, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cache.Size() != 0 {
+		t.Errorf("expected the cache entry to be evicted, got size %v", cache.Size())
+	}
+	for _, name := range []string{"holiday.jpg", keyA + ".txt", "tmp-123"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %v to be left alone, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, keyB+".png")); !os.IsNotExist(err) {
+		t.Errorf("expected the evicted entry to be removed, got %v", err)
+	}
+}
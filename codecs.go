@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+
+	"golang.org/x/image/tiff"
+	// Registers the WebP decoder with image.Decode, BMP and TIFF are
+	// registered by the encoders imported in imageIO.go
+	_ "golang.org/x/image/webp"
+)
+
+// Formats image.Decode reads but encodeImage cannot write.
+var decodeOnlyFormats = map[string]bool{
+	"webp": true,
+}
+
+// Most pages read from a TIFF, a loop in the IFD chain must not hang.
+const maxTIFFPages = 10000
+
+// tiffPageOffsets follows the chain of image file directories and returns the
+// offset of each.
+func tiffPageOffsets(data []byte) ([]uint32, binary.ByteOrder, error) {
+	if len(data) < 8 {
+		return nil, nil, errors.New("tiff: file too short")
+	}
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return nil, nil, errors.New("tiff: invalid header")
+	}
+
+	var offsets []uint32
+	offset := order.Uint32(data[4:8])
+	for offset != 0 {
+		if len(offsets) == maxTIFFPages || int64(offset)+2 > int64(len(data)) {
+			return nil, nil, fmt.Errorf("tiff: invalid directory offset %v", offset)
+		}
+		offsets = append(offsets, offset)
+
+		// Two byte entry count, 12 byte entries, then the next offset
+		entries := int64(order.Uint16(data[offset:]))
+		next := int64(offset) + 2 + entries*12
+		if next+4 > int64(len(data)) {
+			return nil, nil, errors.New("tiff: truncated directory")
+		}
+		offset = order.Uint32(data[next:])
+	}
+	if len(offsets) == 0 {
+		return nil, nil, errors.New("tiff: no images")
+	}
+	return offsets, order, nil
+}
+
+// CountTIFFPages returns the number of images in a TIFF file.
+func CountTIFFPages(data []byte) (int, error) {
+	offsets, _, err := tiffPageOffsets(data)
+	return len(offsets), err
+}
+
+// TIFFPageData returns a copy of the TIFF file that starts with the given
+// page, counting from 1.  The tiff package only reads the first directory,
+// so the header is pointed at the page's directory instead.
+func TIFFPageData(data []byte, page int) ([]byte, error) {
+	offsets, order, err := tiffPageOffsets(data)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 || page > len(offsets) {
+		return nil, fmt.Errorf("tiff: page %v out of range, the file has %v", page, len(offsets))
+	}
+
+	patched := bytes.Clone(data)
+	order.PutUint32(patched[4:8], offsets[page-1])
+	return patched, nil
+}
+
+// DecodeTIFFPage decodes one page of a multi-page TIFF, counting from 1.
+func DecodeTIFFPage(data []byte, page int) (image.Image, error) {
+	patched, err := TIFFPageData(data, page)
+	if err != nil {
+		return nil, err
+	}
+	return tiff.Decode(bytes.NewReader(patched))
+}
+
+// DecodeTIFFPages decodes every page of a TIFF file.
+func DecodeTIFFPages(data []byte) ([]image.Image, error) {
+	count, err := CountTIFFPages(data)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]image.Image, 0, count)
+	for page := 1; page <= count; page++ {
+		img, err := DecodeTIFFPage(data, page)
+		if err != nil {
+			return nil, fmt.Errorf("page %v: %w", page, err)
+		}
+		pages = append(pages, img)
+	}
+	return pages, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+)
+
+// buildGrayTIFF writes an uncompressed little endian TIFF with a 1x1 gray
+// page for every value.
+func buildGrayTIFF(values []uint8) []byte {
+	data := []byte("II*\x00")
+	data = binary.LittleEndian.AppendUint32(data, 8)
+
+	for index, value := range values {
+		offset := uint32(len(data))
+		// Entry count, 9 entries, next offset, then the pixel
+		pixelOffset := offset + 2 + 9*12 + 4
+		next := uint32(0)
+		if index < len(values)-1 {
+			next = pixelOffset + 1
+		}
+
+		data = binary.LittleEndian.AppendUint16(data, 9)
+		for _, entry := range [][2]uint32{
+			{256, 1}, {257, 1}, {258, 8}, {259, 1}, {262, 1},
+			{273, pixelOffset}, {277, 1}, {278, 1}, {279, 1},
+		} {
+			data = binary.LittleEndian.AppendUint16(data, uint16(entry[0]))
+			// LONG values, one of them
+			data = binary.LittleEndian.AppendUint16(data, 4)
+			data = binary.LittleEndian.AppendUint32(data, 1)
+			data = binary.LittleEndian.AppendUint32(data, entry[1])
+		}
+		data = binary.LittleEndian.AppendUint32(data, next)
+		data = append(data, value)
+	}
+	return data
+}
+
+func TestDecodeTIFFPages(t *testing.T) {
+	data := buildGrayTIFF([]uint8{10, 20, 30})
+
+	if count, err := CountTIFFPages(data); err != nil || count != 3 {
+		t.Fatalf("expected 3 pages, got %v %v", count, err)
+	}
+
+	pages, err := DecodeTIFFPages(data)
+	if err != nil || len(pages) != 3 {
+		t.Fatalf("expected 3 pages, got %v %v", len(pages), err)
+	}
+	for index, expected := range []uint8{10, 20, 30} {
+		if got := color.GrayModel.Convert(pages[index].At(0, 0)).(color.Gray).Y; got != expected {
+			t.Errorf("page %v: expected %v, got %v", index+1, expected, got)
+		}
+	}
+
+	// The page data is still sniffed as a TIFF
+	pageData, err := TIFFPageData(data, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, format, err := image.Decode(bytes.NewReader(pageData)); err != nil || format != "tiff" {
+		t.Errorf("expected to decode tiff, got %v %v", format, err)
+	}
+
+	if _, err := DecodeTIFFPage(data, 4); err == nil {
+		t.Error("expected an error for a page past the end")
+	}
+	if _, err := DecodeTIFFPage(data, 0); err == nil {
+		t.Error("expected an error for page 0")
+	}
+}
+
+func TestTIFFPageOffsetsErrors(t *testing.T) {
+	loop := buildGrayTIFF([]uint8{10})
+	// Point the first directory back at itself
+	binary.LittleEndian.PutUint32(loop[8+2+9*12:], 8)
+
+	for name, data := range map[string][]byte{
+		"Short":  []byte("II*"),
+		"Header": []byte("PK\x03\x04\x00\x00\x00\x00"),
+		"Offset": append([]byte("II*\x00"), 0xff, 0, 0, 0),
+		"Loop":   loop,
+	} {
+		if _, err := CountTIFFPages(data); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
+
+func TestProcessImageFileTIFFPage(t *testing.T) {
+	dir := t.TempDir()
+	input := dir + "/scan.tiff"
+	if err := os.WriteFile(input, buildGrayTIFF([]uint8{10, 200}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	params := getEmptyTransformationParams()
+	params.page = 2
+	output := dir + "/page.pgm"
+	if err := processImageFile(params, input, output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, _, err := openImage(output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := color.GrayModel.Convert(img.At(0, 0)).(color.Gray).Y; got != 200 {
+		t.Errorf("expected the second page, got %v", got)
+	}
+
+	params.page = 3
+	if err := processImageFile(params, input, output); exitCodeForError(err) != exitDecode {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const ssimWindow = 8
+
+type CompareParameters struct {
+	firstFile     string
+	secondFile    string
+	diffFile      string
+	tolerance     int
+	maxMAE        float64
+	maxMSE        float64
+	minPSNR       float64
+	minSSIM       float64
+	maxDiffPixels int
+	showHelp      bool
+}
+
+type CompareResult struct {
+	MAE        float64
+	MSE        float64
+	PSNR       float64
+	SSIM       float64
+	DiffPixels int
+	Pixels     int
+}
+
+func getDefaultCompareParameters() CompareParameters {
+	return CompareParameters{maxMAE: -1, maxMSE: -1, minPSNR: -1, minSSIM: -1, maxDiffPixels: -1}
+}
+
+func parseCompareParameters(args []string) (CompareParameters, error) {
+	compareParams := getDefaultCompareParameters()
+	nextValueFlag := ""
+
+	for _, a := range args {
+		if nextValueFlag != "" {
+			err := setCompareParameterValue(&compareParams, nextValueFlag, a)
+			if err != nil {
+				return compareParams, err
+			}
+			nextValueFlag = ""
+			continue
+		}
+
+		switch a {
+		case "-a", "-b", "-diff", "-tolerance", "-max-mae", "-max-mse", "-min-psnr", "-min-ssim", "-max-diff-pixels":
+			nextValueFlag = a
+		case "-h", "-help":
+			return CompareParameters{showHelp: true}, nil
+		default:
+			return compareParams, fmt.Errorf("unknown compare flag: %v", a)
+		}
+	}
+
+	if nextValueFlag != "" {
+		return compareParams, fmt.Errorf("missing value for flag: %v", nextValueFlag)
+	}
+	if strings.TrimSpace(compareParams.firstFile) == "" || strings.TrimSpace(compareParams.secondFile) == "" {
+		return compareParams, errors.New("both images to compare must be defined with -a and -b")
+	}
+	return compareParams, nil
+}
+
+func setCompareParameterValue(compareParams *CompareParameters, flag string, value string) error {
+	switch flag {
+	case "-a":
+		compareParams.firstFile = value
+	case "-b":
+		compareParams.secondFile = value
+	case "-diff":
+		compareParams.diffFile = value
+	case "-tolerance", "-max-diff-pixels":
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return fmt.Errorf("invalid value for %v: %v", flag, value)
+		}
+		if flag == "-tolerance" {
+			compareParams.tolerance = number
+		} else {
+			compareParams.maxDiffPixels = number
+		}
+	default:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || number < 0 || math.IsNaN(number) {
+			return fmt.Errorf("invalid value for %v: %v", flag, value)
+		}
+		switch flag {
+		case "-max-mae":
+			compareParams.maxMAE = number
+		case "-max-mse":
+			compareParams.maxMSE = number
+		case "-min-psnr":
+			compareParams.minPSNR = number
+		case "-min-ssim":
+			compareParams.minSSIM = number
+		}
+	}
+	return nil
+}
+
+// ComparePixels measures the difference between two images of the same size.
+// MAE, MSE and PSNR use the red, green and blue values, SSIM uses luminance
+// and a pixel differs when any channel, alpha included, is further apart
+// than the tolerance.
+func ComparePixels(first [][]color.Color, second [][]color.Color, tolerance int) (CompareResult, error) {
+	if len(first) == 0 || len(first) != len(second) || len(first[0]) != len(second[0]) {
+		return CompareResult{}, errors.New("images to compare must have the same size")
+	}
+
+	width := len(first)
+	height := len(first[0])
+	result := CompareResult{Pixels: width * height}
+	absoluteSum := 0.0
+	squareSum := 0.0
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			a := color.NRGBAModel.Convert(first[x][y]).(color.NRGBA)
+			b := color.NRGBAModel.Convert(second[x][y]).(color.NRGBA)
+			differs := false
+			for index, values := range [][2]uint8{{a.R, b.R}, {a.G, b.G}, {a.B, b.B}, {a.A, b.A}} {
+				difference := int(values[0]) - int(values[1])
+				if abs(difference) > tolerance {
+					differs = true
+				}
+				if index < 3 {
+					absoluteSum += math.Abs(float64(difference))
+					squareSum += float64(difference * difference)
+				}
+			}
+			if differs {
+				result.DiffPixels++
+			}
+		}
+	}
+
+	samples := float64(result.Pixels * 3)
+	result.MAE = absoluteSum / samples
+	result.MSE = squareSum / samples
+	if result.MSE == 0 {
+		result.PSNR = math.Inf(1)
+	} else {
+		result.PSNR = 10 * math.Log10(255*255/result.MSE)
+	}
+	result.SSIM = calcSSIM(first, second)
+	return result, nil
+}
+
+// calcSSIM averages the structural similarity of non-overlapping windows
+// of luminance.
+func calcSSIM(first [][]color.Color, second [][]color.Color) float64 {
+	const c1 = (0.01 * 255) * (0.01 * 255)
+	const c2 = (0.03 * 255) * (0.03 * 255)
+
+	width := len(first)
+	height := len(first[0])
+	total := 0.0
+	windows := 0
+
+	for startX := 0; startX < width; startX += ssimWindow {
+		for startY := 0; startY < height; startY += ssimWindow {
+			blockA, errA := getPixelBlockRect(first, startX, startY, ssimWindow, ssimWindow)
+			blockB, errB := getPixelBlockRect(second, startX, startY, ssimWindow, ssimWindow)
+			if errA != nil || errB != nil {
+				continue
+			}
+
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			for index := range blockA {
+				a := float64(pixelLuminance(blockA[index]))
+				b := float64(pixelLuminance(blockB[index]))
+				sumA += a
+				sumB += b
+				sumAA += a * a
+				sumBB += b * b
+				sumAB += a * b
+			}
+
+			count := float64(len(blockA))
+			meanA := sumA / count
+			meanB := sumB / count
+			varianceA := sumAA/count - meanA*meanA
+			varianceB := sumBB/count - meanB*meanB
+			covariance := sumAB/count - meanA*meanB
+
+			total += ((2*meanA*meanB + c1) * (2*covariance + c2)) /
+				((meanA*meanA + meanB*meanB + c1) * (varianceA + varianceB + c2))
+			windows++
+		}
+	}
+
+	return total / float64(windows)
+}
+
+// CreateDiffPixels dims the first image to gray and marks the pixels that
+// differ in red, brighter for larger differences.
+func CreateDiffPixels(first [][]color.Color, second [][]color.Color, tolerance int) [][]color.Color {
+	diff := make([][]color.Color, len(first))
+	for x := range first {
+		diff[x] = make([]color.Color, len(first[x]))
+		for y := range first[x] {
+			a := color.NRGBAModel.Convert(first[x][y]).(color.NRGBA)
+			b := color.NRGBAModel.Convert(second[x][y]).(color.NRGBA)
+			largest := max(abs(int(a.R)-int(b.R)), abs(int(a.G)-int(b.G)), abs(int(a.B)-int(b.B)), abs(int(a.A)-int(b.A)))
+			if largest > tolerance {
+				diff[x][y] = color.RGBA{uint8(128 + largest/2), 0, 0, 255}
+				continue
+			}
+			gray := uint8(pixelLuminance(first[x][y]) / 4)
+			diff[x][y] = color.RGBA{gray, gray, gray, 255}
+		}
+	}
+	return diff
+}
+
+// checkCompareThresholds lists every threshold the result fails.
+func checkCompareThresholds(result CompareResult, compareParams CompareParameters) []string {
+	var failures []string
+	if compareParams.maxMAE >= 0 && result.MAE > compareParams.maxMAE {
+		failures = append(failures, fmt.Sprintf("MAE %.4f is above %v", result.MAE, compareParams.maxMAE))
+	}
+	if compareParams.maxMSE >= 0 && result.MSE > compareParams.maxMSE {
+		failures = append(failures, fmt.Sprintf("MSE %.4f is above %v", result.MSE, compareParams.maxMSE))
+	}
+	if compareParams.minPSNR >= 0 && result.PSNR < compareParams.minPSNR {
+		failures = append(failures, fmt.Sprintf("PSNR %.4f is below %v", result.PSNR, compareParams.minPSNR))
+	}
+	if compareParams.minSSIM >= 0 && result.SSIM < compareParams.minSSIM {
+		failures = append(failures, fmt.Sprintf("SSIM %.4f is below %v", result.SSIM, compareParams.minSSIM))
+	}
+	if compareParams.maxDiffPixels >= 0 && result.DiffPixels > compareParams.maxDiffPixels {
+		failures = append(failures, fmt.Sprintf("%v differing pixels is above %v", result.DiffPixels, compareParams.maxDiffPixels))
+	}
+	return failures
+}
+
+func writeCompareResult(w io.Writer, result CompareResult) {
+	fmt.Fprintf(w, "MAE:              %.4f\n", result.MAE)
+	fmt.Fprintf(w, "MSE:              %.4f\n", result.MSE)
+	fmt.Fprintf(w, "PSNR:             %.4f dB\n", result.PSNR)
+	fmt.Fprintf(w, "SSIM:             %.4f\n", result.SSIM)
+	fmt.Fprintf(w, "Differing Pixels: %v of %v\n", result.DiffPixels, result.Pixels)
+}
+
+func showCompareHelp() {
+	fmt.Println("imagesTx.exe compare -a <first image> -b <second image> [compare flags]")
+	fmt.Println("")
+	fmt.Println("Reports MAE, MSE, PSNR, SSIM and the number of differing pixels of two images of the same size.")
+	fmt.Println("")
+	fmt.Println("  -diff <file>           Write an image with the differing pixels in red")
+	fmt.Println("  -tolerance <value>     Largest channel difference (0-255) still counted as equal (default 0)")
+	fmt.Println("  -max-mae <value>       Fail when the MAE is above the value")
+	fmt.Println("  -max-mse <value>       Fail when the MSE is above the value")
+	fmt.Println("  -min-psnr <value>      Fail when the PSNR is below the value")
+	fmt.Println("  -min-ssim <value>      Fail when the SSIM is below the value")
+	fmt.Println("  -max-diff-pixels <n>   Fail when more than n pixels differ")
+	fmt.Println("")
+	fmt.Printf("Exits with %v when a threshold is exceeded.\n", exitThresholdExceeded)
+	fmt.Println("")
+}
+
+// runCompare returns the threshold failures separately from errors so main
+// can pick the exit code.
+func runCompare(args []string, w io.Writer) ([]string, error) {
+	compareParams, err := parseCompareParameters(args)
+	if err != nil {
+		return nil, &InvalidParameterError{Err: err}
+	}
+
+	if compareParams.showHelp {
+		showCompareHelp()
+		return nil, nil
+	}
+
+	var images [2][][]color.Color
+	for index, file := range []string{compareParams.firstFile, compareParams.secondFile} {
+		img, _, err := openImage(file)
+		if err != nil {
+			return nil, err
+		}
+		images[index], err = CreatePixelArrayFromImage(img)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := ComparePixels(images[0], images[1], compareParams.tolerance)
+	if err != nil {
+		return nil, err
+	}
+	writeCompareResult(w, result)
+
+	if compareParams.diffFile != "" {
+		err = writeImageFile(CreateDiffPixels(images[0], images[1], compareParams.tolerance), compareParams.diffFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return checkCompareThresholds(result, compareParams), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func createSolidPixels(width int, height int, pixel color.Color) [][]color.Color {
+	pixels := make([][]color.Color, width)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, height)
+		for y := range pixels[x] {
+			pixels[x][y] = pixel
+		}
+	}
+	return pixels
+}
+
+func TestParseCompareParameters(t *testing.T) {
+	compareParams, err := parseCompareParameters([]string{"-a", "a.png", "-b", "b.png", "-min-psnr", "30", "-tolerance", "2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if compareParams.firstFile != "a.png" || compareParams.secondFile != "b.png" || compareParams.minPSNR != 30 || compareParams.tolerance != 2 {
+		t.Errorf("unexpected parameters: %+v", compareParams)
+	}
+	if compareParams.maxMSE != -1 || compareParams.maxDiffPixels != -1 {
+		t.Errorf("expected unset thresholds to be disabled: %+v", compareParams)
+	}
+
+	invalidArgs := [][]string{
+		{"-a", "a.png"},
+		{"-a", "a.png", "-b", "b.png", "-min-ssim"},
+		{"-a", "a.png", "-b", "b.png", "-max-mse", "abc"},
+		{"-a", "a.png", "-b", "b.png", "-tolerance", "-1"},
+		{"-a", "a.png", "-b", "b.png", "-x"},
+	}
+	for _, args := range invalidArgs {
+		if _, err := parseCompareParameters(args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func TestComparePixelsIdentical(t *testing.T) {
+	pixels := createSolidPixels(10, 10, color.RGBA{10, 100, 200, 255})
+
+	result, err := ComparePixels(pixels, CopyPixelArray(pixels), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.MAE != 0 || result.MSE != 0 || !math.IsInf(result.PSNR, 1) || math.Abs(result.SSIM-1) > 1e-9 || result.DiffPixels != 0 {
+		t.Errorf("unexpected result for identical images: %+v", result)
+	}
+}
+
+func TestComparePixelsDifferent(t *testing.T) {
+	first := createSolidPixels(4, 4, color.RGBA{100, 100, 100, 255})
+	second := CopyPixelArray(first)
+	second[1][2] = color.RGBA{110, 100, 100, 255}
+	second[3][3] = color.RGBA{102, 100, 100, 255}
+
+	result, err := ComparePixels(first, second, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(result.MAE-12.0/48) > 1e-9 || math.Abs(result.MSE-104.0/48) > 1e-9 {
+		t.Errorf("unexpected MAE/MSE: %+v", result)
+	}
+	if math.Abs(result.PSNR-10*math.Log10(255*255/(104.0/48))) > 1e-9 {
+		t.Errorf("unexpected PSNR %v", result.PSNR)
+	}
+	if result.DiffPixels != 2 || result.SSIM >= 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	result, _ = ComparePixels(first, second, 5)
+	if result.DiffPixels != 1 {
+		t.Errorf("expected tolerance to ignore the small difference, got %v", result.DiffPixels)
+	}
+
+	if _, err := ComparePixels(first, createSolidPixels(4, 5, color.White), 0); err == nil {
+		t.Error("expected error for different sizes")
+	}
+}
+
+func TestCreateDiffPixels(t *testing.T) {
+	first := createSolidPixels(2, 1, color.RGBA{200, 200, 200, 255})
+	second := CopyPixelArray(first)
+	second[1][0] = color.RGBA{0, 200, 200, 255}
+
+	diff := CreateDiffPixels(first, second, 0)
+	if diff[0][0] != (color.RGBA{50, 50, 50, 255}) {
+		t.Errorf("expected dimmed gray for equal pixel, got %v", diff[0][0])
+	}
+	if diff[1][0] != (color.RGBA{228, 0, 0, 255}) {
+		t.Errorf("expected red for differing pixel, got %v", diff[1][0])
+	}
+}
+
+func TestCheckCompareThresholds(t *testing.T) {
+	result := CompareResult{MAE: 2, MSE: 8, PSNR: 39, SSIM: 0.95, DiffPixels: 20}
+
+	compareParams := getDefaultCompareParameters()
+	if failures := checkCompareThresholds(result, compareParams); len(failures) != 0 {
+		t.Errorf("expected no failures without thresholds, got %v", failures)
+	}
+
+	compareParams.minPSNR = 40
+	compareParams.minSSIM = 0.9
+	compareParams.maxDiffPixels = 10
+	if failures := checkCompareThresholds(result, compareParams); len(failures) != 2 {
+		t.Errorf("expected PSNR and pixel failures, got %v", failures)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+)
+
+type BlendMode int64
+
+const (
+	BlendNormal BlendMode = iota
+	BlendMultiply
+	BlendScreen
+	BlendOverlay
+	BlendSoftLight
+	BlendHardLight
+	BlendDifference
+	BlendColorDodge
+	BlendColorBurn
+	BlendHue
+	BlendSaturation
+	BlendColor
+	BlendLuminosity
+)
+
+// CompositeOperator is one of the Porter-Duff operators deciding how much of
+// the source and the backdrop survive where they overlap.
+type CompositeOperator int64
+
+const (
+	CompositeSourceOver CompositeOperator = iota
+	CompositeClear
+	CompositeSource
+	CompositeDestination
+	CompositeDestinationOver
+	CompositeSourceIn
+	CompositeDestinationIn
+	CompositeSourceOut
+	CompositeDestinationOut
+	CompositeSourceAtop
+	CompositeDestinationAtop
+	CompositeXor
+)
+
+var blendModeNames = map[string]BlendMode{
+	"normal":     BlendNormal,
+	"multiply":   BlendMultiply,
+	"screen":     BlendScreen,
+	"overlay":    BlendOverlay,
+	"softlight":  BlendSoftLight,
+	"hardlight":  BlendHardLight,
+	"difference": BlendDifference,
+	"dodge":      BlendColorDodge,
+	"burn":       BlendColorBurn,
+	"hue":        BlendHue,
+	"saturation": BlendSaturation,
+	"color":      BlendColor,
+	"luminosity": BlendLuminosity,
+}
+
+var compositeOperatorNames = map[string]CompositeOperator{
+	"over":     CompositeSourceOver,
+	"clear":    CompositeClear,
+	"src":      CompositeSource,
+	"dst":      CompositeDestination,
+	"dst-over": CompositeDestinationOver,
+	"in":       CompositeSourceIn,
+	"dst-in":   CompositeDestinationIn,
+	"out":      CompositeSourceOut,
+	"dst-out":  CompositeDestinationOut,
+	"atop":     CompositeSourceAtop,
+	"dst-atop": CompositeDestinationAtop,
+	"xor":      CompositeXor,
+}
+
+type CompositeSettings struct {
+	mode     BlendMode
+	operator CompositeOperator
+	opacity  float64
+}
+
+func getDefaultCompositeSettings() CompositeSettings {
+	return CompositeSettings{BlendNormal, CompositeSourceOver, 1}
+}
+
+func parseBlendMode(name string) (BlendMode, error) {
+	mode, ok := blendModeNames[name]
+	if !ok {
+		return BlendNormal, fmt.Errorf("unknown blend mode: %v", name)
+	}
+	return mode, nil
+}
+
+func parseCompositeOperator(name string) (CompositeOperator, error) {
+	operator, ok := compositeOperatorNames[name]
+	if !ok {
+		return CompositeSourceOver, fmt.Errorf("unknown composite operator: %v", name)
+	}
+	return operator, nil
+}
+
+// CompositePixels lays the source pixels over the backdrop using the blend
+// mode, Porter-Duff operator and opacity in the settings.  Both arrays must be
+// the same size.
+func CompositePixels(backdrop [][]color.Color, source [][]color.Color, settings CompositeSettings) ([][]color.Color, error) {
+	if len(backdrop) != len(source) {
+		return nil, errors.New("images must be the same size to composite")
+	}
+
+	var newPixels [][]color.Color
+	for xIndex := 0; xIndex < len(source); xIndex++ {
+		if len(backdrop[xIndex]) != len(source[xIndex]) {
+			return nil, errors.New("images must be the same size to composite")
+		}
+		newCol := make([]color.Color, len(source[xIndex]))
+		for yIndex := range newCol {
+			newCol[yIndex] = CompositeColor(backdrop[xIndex][yIndex], source[xIndex][yIndex], settings)
+		}
+		newPixels = append(newPixels, newCol)
+	}
+	return newPixels, nil
+}
+
+// CompositeColor follows the W3C compositing model: the source color is first
+// blended with the backdrop, then the operator combines the two by coverage.
+func CompositeColor(backdrop color.Color, source color.Color, settings CompositeSettings) color.Color {
+	cb, alphaB := colorToFloats(backdrop)
+	cs, alphaS := colorToFloats(source)
+	alphaS *= min(max(settings.opacity, 0), 1)
+
+	blended := blendColors(cb, cs, settings.mode)
+	for index := range cs {
+		cs[index] = (1-alphaB)*cs[index] + alphaB*blended[index]
+	}
+
+	fa, fb := porterDuffFactors(settings.operator, alphaS, alphaB)
+	alphaO := alphaS*fa + alphaB*fb
+	if alphaO <= 0 {
+		return color.RGBAModel.Convert(color.NRGBA{})
+	}
+
+	var result [3]float64
+	for index := range result {
+		result[index] = (alphaS*fa*cs[index] + alphaB*fb*cb[index]) / alphaO
+	}
+	return floatsToColor(result, alphaO)
+}
+
+func porterDuffFactors(operator CompositeOperator, alphaS float64, alphaB float64) (float64, float64) {
+	switch operator {
+	case CompositeClear:
+		return 0, 0
+	case CompositeSource:
+		return 1, 0
+	case CompositeDestination:
+		return 0, 1
+	case CompositeDestinationOver:
+		return 1 - alphaB, 1
+	case CompositeSourceIn:
+		return alphaB, 0
+	case CompositeDestinationIn:
+		return 0, alphaS
+	case CompositeSourceOut:
+		return 1 - alphaB, 0
+	case CompositeDestinationOut:
+		return 0, 1 - alphaS
+	case CompositeSourceAtop:
+		return alphaB, 1 - alphaS
+	case CompositeDestinationAtop:
+		return 1 - alphaB, alphaS
+	case CompositeXor:
+		return 1 - alphaB, 1 - alphaS
+	default:
+		return 1, 1 - alphaS
+	}
+}
+
+func blendColors(cb [3]float64, cs [3]float64, mode BlendMode) [3]float64 {
+	switch mode {
+	case BlendHue:
+		return setLum(setSat(cs, sat(cb)), lum(cb))
+	case BlendSaturation:
+		return setLum(setSat(cb, sat(cs)), lum(cb))
+	case BlendColor:
+		return setLum(cs, lum(cb))
+	case BlendLuminosity:
+		return setLum(cb, lum(cs))
+	}
+
+	var result [3]float64
+	for index := range result {
+		result[index] = blendChannel(cb[index], cs[index], mode)
+	}
+	return result
+}
+
+func blendChannel(cb float64, cs float64, mode BlendMode) float64 {
+	switch mode {
+	case BlendMultiply:
+		return cb * cs
+	case BlendScreen:
+		return cb + cs - cb*cs
+	case BlendOverlay:
+		return blendChannel(cs, cb, BlendHardLight)
+	case BlendHardLight:
+		if cs <= 0.5 {
+			return blendChannel(cb, 2*cs, BlendMultiply)
+		}
+		return blendChannel(cb, 2*cs-1, BlendScreen)
+	case BlendSoftLight:
+		if cs <= 0.5 {
+			return cb - (1-2*cs)*cb*(1-cb)
+		}
+		var d float64
+		if cb <= 0.25 {
+			d = ((16*cb-12)*cb + 4) * cb
+		} else {
+			d = math.Sqrt(cb)
+		}
+		return cb + (2*cs-1)*(d-cb)
+	case BlendDifference:
+		return math.Abs(cb - cs)
+	case BlendColorDodge:
+		if cb == 0 {
+			return 0
+		}
+		if cs == 1 {
+			return 1
+		}
+		return min(1, cb/(1-cs))
+	case BlendColorBurn:
+		if cb == 1 {
+			return 1
+		}
+		if cs == 0 {
+			return 0
+		}
+		return 1 - min(1, (1-cb)/cs)
+	default:
+		return cs
+	}
+}
+
+func lum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+func clipColor(c [3]float64) [3]float64 {
+	l := lum(c)
+	n := min(c[0], c[1], c[2])
+	x := max(c[0], c[1], c[2])
+	for index := range c {
+		if n < 0 {
+			c[index] = l + (c[index]-l)*l/(l-n)
+		}
+		if x > 1 {
+			c[index] = l + (c[index]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+func setLum(c [3]float64, l float64) [3]float64 {
+	d := l - lum(c)
+	for index := range c {
+		c[index] += d
+	}
+	return clipColor(c)
+}
+
+func sat(c [3]float64) float64 {
+	return max(c[0], c[1], c[2]) - min(c[0], c[1], c[2])
+}
+
+func setSat(c [3]float64, s float64) [3]float64 {
+	cMax := max(c[0], c[1], c[2])
+	cMin := min(c[0], c[1], c[2])
+	var result [3]float64
+	if cMax > cMin {
+		for index := range c {
+			switch c[index] {
+			case cMax:
+				result[index] = s
+			case cMin:
+				result[index] = 0
+			default:
+				result[index] = (c[index] - cMin) * s / (cMax - cMin)
+			}
+		}
+	}
+	return result
+}
+
+// colorToFloats returns the straight (not premultiplied) color channels and
+// alpha scaled to 0..1.
+func colorToFloats(c color.Color) ([3]float64, float64) {
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return [3]float64{float64(nrgba.R) / 255, float64(nrgba.G) / 255, float64(nrgba.B) / 255}, float64(nrgba.A) / 255
+}
+
+func floatsToColor(c [3]float64, alpha float64) color.Color {
+	toByte := func(value float64) uint8 {
+		return uint8(math.Round(min(max(value, 0), 1) * 255))
+	}
+	return color.RGBAModel.Convert(color.NRGBA{toByte(c[0]), toByte(c[1]), toByte(c[2]), toByte(alpha)})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+type CompositeTest struct {
+	name     string
+	backdrop color.Color
+	source   color.Color
+	settings CompositeSettings
+	expected color.Color
+}
+
+type BlendNameTest struct {
+	name      string
+	input     string
+	expectErr bool
+	errText   string
+}
+
+var testHalfRed = color.NRGBA{255, 0, 0, 128}
+var testClear = color.RGBA{0, 0, 0, 0}
+
+func TestCompositeColor(t *testing.T) {
+	var tests = []CompositeTest{
+		{"NormalOpaque", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeSourceOver, 1}, testRed.color},
+		{"NormalHalfOpacity", testBlack.color, testWhite.color, CompositeSettings{BlendNormal, CompositeSourceOver, 0.5}, SetTestColor(128, 128, 128).color},
+		{"NormalZeroOpacity", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeSourceOver, 0}, testBlue.color},
+		{"NormalHalfAlpha", testBlack.color, testHalfRed, CompositeSettings{BlendNormal, CompositeSourceOver, 1}, SetTestColor(128, 0, 0).color},
+		{"Multiply", testGray.color, testRed.color, CompositeSettings{BlendMultiply, CompositeSourceOver, 1}, SetTestColor(127, 0, 0).color},
+		{"MultiplyWhite", testGreen.color, testWhite.color, CompositeSettings{BlendMultiply, CompositeSourceOver, 1}, testGreen.color},
+		{"Screen", testRed.color, testBlue.color, CompositeSettings{BlendScreen, CompositeSourceOver, 1}, SetTestColor(255, 0, 255).color},
+		{"ScreenBlack", testGray.color, testBlack.color, CompositeSettings{BlendScreen, CompositeSourceOver, 1}, testGray.color},
+		{"OverlayDarkBackdrop", testBlack.color, testWhite.color, CompositeSettings{BlendOverlay, CompositeSourceOver, 1}, testBlack.color},
+		{"HardLightWhite", testBlack.color, testWhite.color, CompositeSettings{BlendHardLight, CompositeSourceOver, 1}, testWhite.color},
+		{"SoftLightBlack", testWhite.color, testBlack.color, CompositeSettings{BlendSoftLight, CompositeSourceOver, 1}, testWhite.color},
+		{"Difference", testWhite.color, testRed.color, CompositeSettings{BlendDifference, CompositeSourceOver, 1}, SetTestColor(0, 255, 255).color},
+		{"DifferenceSame", testGray.color, testGray.color, CompositeSettings{BlendDifference, CompositeSourceOver, 1}, testBlack.color},
+		{"ColorDodgeWhite", testGray.color, testWhite.color, CompositeSettings{BlendColorDodge, CompositeSourceOver, 1}, testWhite.color},
+		{"ColorDodgeBlackBackdrop", testBlack.color, testGray.color, CompositeSettings{BlendColorDodge, CompositeSourceOver, 1}, testBlack.color},
+		{"ColorBurnBlack", testGray.color, testBlack.color, CompositeSettings{BlendColorBurn, CompositeSourceOver, 1}, testBlack.color},
+		{"ColorBurnWhiteBackdrop", testWhite.color, testGray.color, CompositeSettings{BlendColorBurn, CompositeSourceOver, 1}, testWhite.color},
+		{"LuminosityOfGray", testRed.color, testGray.color, CompositeSettings{BlendLuminosity, CompositeSourceOver, 1}, SetTestColor(255, 72, 72).color},
+		{"ColorOfGrayIsGray", testGray.color, testGray.color, CompositeSettings{BlendColor, CompositeSourceOver, 1}, testGray.color},
+		{"SaturationOfGray", testRed.color, testGray.color, CompositeSettings{BlendSaturation, CompositeSourceOver, 1}, SetTestColor(77, 77, 77).color},
+		{"HueOfBlueOnGray", testGray.color, testBlue.color, CompositeSettings{BlendHue, CompositeSourceOver, 1}, testGray.color},
+		{"Clear", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeClear, 1}, testClear},
+		{"Source", testBlue.color, testHalfRed, CompositeSettings{BlendNormal, CompositeSource, 1}, color.RGBAModel.Convert(testHalfRed)},
+		{"Destination", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeDestination, 1}, testBlue.color},
+		{"DestinationOver", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeDestinationOver, 1}, testBlue.color},
+		{"SourceInClear", testClear, testRed.color, CompositeSettings{BlendNormal, CompositeSourceIn, 1}, testClear},
+		{"SourceIn", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeSourceIn, 1}, testRed.color},
+		{"DestinationIn", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeDestinationIn, 1}, testBlue.color},
+		{"SourceOut", testClear, testRed.color, CompositeSettings{BlendNormal, CompositeSourceOut, 1}, testRed.color},
+		{"DestinationOut", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeDestinationOut, 1}, testClear},
+		{"SourceAtop", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeSourceAtop, 1}, testRed.color},
+		{"DestinationAtop", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeDestinationAtop, 1}, testBlue.color},
+		{"XorBothOpaque", testBlue.color, testRed.color, CompositeSettings{BlendNormal, CompositeXor, 1}, testClear},
+		{"XorClearBackdrop", testClear, testRed.color, CompositeSettings{BlendNormal, CompositeXor, 1}, testRed.color},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CompositeColor(tt.backdrop, tt.source, tt.settings)
+			if tt.expected != result {
+				t.Errorf("Test %s returned invalid color: Expect: %v. Got: %v", tt.name, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseBlendMode(t *testing.T) {
+	var tests = []BlendNameTest{
+		{"Multiply", "multiply", false, ""},
+		{"Luminosity", "luminosity", false, ""},
+		{"Unknown", "sparkle", true, "unknown blend mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseBlendMode(tt.input)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			if err != nil && tt.expectErr && !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("Test %s returned incorrect error. Want: %s. Got: %v", tt.name, tt.errText, err)
+			}
+
+			if err == nil && tt.expectErr {
+				t.Errorf("Test %s should have returned an error, but did not", tt.name)
+			}
+		})
+	}
+}
+
+func TestParseCompositeOperator(t *testing.T) {
+	var tests = []BlendNameTest{
+		{"Over", "over", false, ""},
+		{"DestinationAtop", "dst-atop", false, ""},
+		{"Unknown", "under", true, "unknown composite operator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCompositeOperator(tt.input)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			if err != nil && tt.expectErr && !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("Test %s returned incorrect error. Want: %s. Got: %v", tt.name, tt.errText, err)
+			}
+
+			if err == nil && tt.expectErr {
+				t.Errorf("Test %s should have returned an error, but did not", tt.name)
+			}
+		})
+	}
+}
+
+func TestCompositePixels(t *testing.T) {
+	_, err := CompositePixels(create2DArraySingleColor(testRed), [][]color.Color{{testRed.color}}, getDefaultCompositeSettings())
+	if err == nil || !strings.Contains(err.Error(), "same size") {
+		t.Errorf("CompositePixels should have returned a size error. Got: %v", err)
+	}
+
+	result, err := CompositePixels(create2DArraySingleColor(testBlack), create2DArraySingleColor(testWhite), CompositeSettings{BlendNormal, CompositeSourceOver, 0.5})
+	if err != nil {
+		t.Fatalf("CompositePixels returned an unexpected error: %v", err)
+	}
+
+	expected := SetTestColor(128, 128, 128).color
+	if result[9][9] != expected {
+		t.Errorf("CompositePixels returned invalid color: Expect: %v. Got: %v", expected, result[9][9])
+	}
+}
+
+func TestProcessListWithComposite(t *testing.T) {
+	settings := CompositeSettings{BlendNormal, CompositeSourceOver, 0.5}
+	options := TransformOptions{composite: &settings}
+
+	// Pixelate changes the pixels in place, so the backdrop must be a copy
+	input := create2DArrayHalves(testWhite, testBlack, 10)
+	result, err := ProcessListOfTransformationsWithOptions(input, []TransformationType{Pixel10}, options)
+	if err != nil {
+		t.Fatalf("ProcessListOfTransformationsWithOptions returned an unexpected error: %v", err)
+	}
+
+	expectedLeft := SetTestColor(191, 191, 191).color
+	if result[0][0] != expectedLeft {
+		t.Errorf("composite returned invalid color: Expect: %v. Got: %v", expectedLeft, result[0][0])
+	}
+
+	tmpDir := t.TempDir()
+	bgFile := fmt.Sprintf("%v/%v", tmpDir, "bg.png")
+	if err := writePng(create2DArraySingleColor(testBlue), bgFile); err != nil {
+		t.Fatalf("could not write background image: %v", err)
+	}
+
+	settings = CompositeSettings{BlendScreen, CompositeSourceOver, 1}
+	options = TransformOptions{composite: &settings, backgroundFile: bgFile}
+	result, err = ProcessListOfTransformationsWithOptions(create2DArraySingleColor(testRed), []TransformationType{}, options)
+	if err != nil {
+		t.Fatalf("ProcessListOfTransformationsWithOptions returned an unexpected error: %v", err)
+	}
+
+	expectedScreen := SetTestColor(255, 0, 255).color
+	if result[0][0] != expectedScreen {
+		t.Errorf("composite over background returned invalid color: Expect: %v. Got: %v", expectedScreen, result[0][0])
+	}
+
+	options.backgroundFile = tmpDir + "/missing.png"
+	_, err = ProcessListOfTransformationsWithOptions(create2DArraySingleColor(testRed), []TransformationType{Gray}, options)
+	var transformError *TransformError
+	if !errors.As(err, &transformError) || transformError.Step != 0 || exitCodeForError(err) != exitIO {
+		t.Errorf("composite with a missing background should have failed at the first step. Got: %v", err)
+	}
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
-	"log"
 )
 
 func CreatePixelArrayFromImage(img image.Image) ([][]color.Color, error) {
@@ -40,11 +40,20 @@ func CreateImageFromPixelArray(pixels [][]color.Color) (image.Image, error) {
 			if ok {
 				newImage.Set(xIndex, yIndex, pixelRGBA)
 			} else {
-				log.Printf("Could not convert pixel value: %v %v %v", xIndex, yIndex, singlePixel)
-				return nil, errors.New("pixel conversion error")
+				return nil, fmt.Errorf("pixel conversion error at %v,%v: %v", xIndex, yIndex, singlePixel)
 			}
 		}
 	}
 
 	return newImage, nil
 }
+
+// CopyPixelArray returns a copy of the pixel array that can be changed without
+// affecting the original.
+func CopyPixelArray(pixels [][]color.Color) [][]color.Color {
+	newPixels := make([][]color.Color, len(pixels))
+	for xIndex := range pixels {
+		newPixels[xIndex] = append([]color.Color(nil), pixels[xIndex]...)
+	}
+	return newPixels
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Exit codes, one per category of error.  They are listed in the help text.
+const (
+	exitOK = 0
+	// Any error not in one of the categories below, such as a failing transform
+	exitFailure = 1
+	// Used by compare when a threshold is exceeded
+	exitThresholdExceeded = 2
+	exitInvalidParameter  = 3
+	exitUnknownTransform  = 4
+	exitIO                = 5
+	exitDecode            = 6
+	exitEncode            = 7
+)
+
+// InvalidParameterError reports a command line argument that cannot be used.
+type InvalidParameterError struct {
+	Flag string
+	Err  error
+}
+
+func (e *InvalidParameterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidParameterError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownTransformError reports a transformation flag or type that does not
+// exist.
+type UnknownTransformError struct {
+	Name string
+}
+
+func (e *UnknownTransformError) Error() string {
+	return fmt.Sprintf("unknown transformation: %v", e.Name)
+}
+
+// IOError reports a file that cannot be opened, created or read.
+type IOError struct {
+	Path string
+	Err  error
+}
+
+func (e *IOError) Error() string {
+	// Errors from the os package already name the file
+	if strings.Contains(e.Err.Error(), e.Path) {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v: %v", e.Path, e.Err)
+}
+
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError reports a file that was read but is not a supported image.
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cannot decode %v: %v", e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError reports pixels that cannot be written in the requested format.
+type EncodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("cannot encode %v: %v", e.Path, e.Err)
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// TransformError adds the failing step of a transformation list to the error.
+type TransformError struct {
+	Step           int
+	Transformation TransformationType
+	Err            error
+}
+
+func (e *TransformError) Error() string {
+	return fmt.Sprintf("step %v (%v): %v", e.Step+1, e.Transformation, e.Err)
+}
+
+func (e *TransformError) Unwrap() error {
+	return e.Err
+}
+
+// exitCodeForError picks the exit code for the first category below found
+// anywhere in the error chain, so a decode failure inside a transform step
+// still exits as a decode error.  The order of the cases sets the priority
+// when an error wraps more than one category.
+func exitCodeForError(err error) int {
+	var invalidParameter *InvalidParameterError
+	var unknownTransform *UnknownTransformError
+	var ioError *IOError
+	var decodeError *DecodeError
+	var encodeError *EncodeError
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &decodeError):
+		return exitDecode
+	case errors.As(err, &encodeError):
+		return exitEncode
+	case errors.As(err, &ioError):
+		return exitIO
+	case errors.As(err, &unknownTransform):
+		return exitUnknownTransform
+	case errors.As(err, &invalidParameter):
+		return exitInvalidParameter
+	}
+	return exitFailure
+}
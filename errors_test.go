@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExitCodeForError(t *testing.T) {
+	var tests = []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"NoError", nil, exitOK},
+		{"Plain", errors.New("failed"), exitFailure},
+		{"InvalidParameter", &InvalidParameterError{Flag: "-opacity", Err: errors.New("bad")}, exitInvalidParameter},
+		{"UnknownTransform", &UnknownTransformError{Name: "-x"}, exitUnknownTransform},
+		{"IO", &IOError{Path: "a.jpg", Err: os.ErrNotExist}, exitIO},
+		{"Decode", &DecodeError{Path: "a.jpg", Err: errors.New("bad")}, exitDecode},
+		{"Encode", &EncodeError{Path: "a.jpg", Err: errors.New("bad")}, exitEncode},
+		{"WrappedInStep", &TransformError{Step: 2, Transformation: Overlay, Err: &DecodeError{Path: "logo.png", Err: errors.New("bad")}}, exitDecode},
+		{"StepOnly", &TransformError{Step: 0, Transformation: Gray, Err: errors.New("bad")}, exitFailure},
+		{"WrappedWithFmt", fmt.Errorf("loading: %w", &IOError{Path: "a.jpg", Err: os.ErrNotExist}), exitIO},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := exitCodeForError(tt.err); code != tt.expected {
+				t.Errorf("Test %s returned exit code %v, want %v", tt.name, code, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTransformErrorMessage(t *testing.T) {
+	err := &TransformError{Step: 1, Transformation: Clahe, Err: errors.New("clip limit must be at least 1")}
+	if err.Error() != "step 2 (clahe): clip limit must be at least 1" {
+		t.Errorf("unexpected message: %v", err.Error())
+	}
+
+	if TransformationType(999).String() != "transformation 999" {
+		t.Errorf("unexpected name for an unknown transformation: %v", TransformationType(999))
+	}
+}
+
+func TestProcessListReportsStep(t *testing.T) {
+	pixels := createGray2DArray()
+	_, err := ProcessListOfTransformationsWithOptions(pixels, []TransformationType{Gray, Clahe}, TransformOptions{claheClip: 0.5})
+
+	var transformError *TransformError
+	if !errors.As(err, &transformError) || transformError.Step != 1 || transformError.Transformation != Clahe {
+		t.Errorf("expected the error of the second step, got %v", err)
+	}
+
+	_, err = ProcessListOfTransformations(pixels, []TransformationType{TransformationType(999)})
+	var unknownTransform *UnknownTransformError
+	if !errors.As(err, &unknownTransform) {
+		t.Errorf("expected an unknown transformation error, got %v", err)
+	}
+}
+
+func TestIOErrors(t *testing.T) {
+	_, err := openJpeg("fake/directory/fake.jpg")
+	if exitCodeForError(err) != exitIO || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected an I/O error wrapping os.ErrNotExist, got %v", err)
+	}
+
+	_, err = openJpeg("go.mod")
+	if exitCodeForError(err) != exitDecode || !strings.Contains(err.Error(), "go.mod") {
+		t.Errorf("expected a decode error naming the file, got %v", err)
+	}
+
+	err = writePng(createGray2DArray(), "fake/directory/result.png")
+	if exitCodeForError(err) != exitIO {
+		t.Errorf("expected an I/O error, got %v", err)
+	}
+
+	err = writePng([][]color.Color{}, t.TempDir()+"/result.png")
+	if exitCodeForError(err) != exitEncode {
+		t.Errorf("expected an encode error, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Regenerate the golden images with: go test -run TestGolden -update
+var updateGoldens = flag.Bool("update", false, "regenerate the golden images in testdata/golden")
+
+const goldenFixtureDir = "testdata/fixtures"
+const goldenDir = "testdata/golden"
+const goldenFailureDir = "testdata/failures"
+
+// Largest difference per channel allowed between a result and its golden,
+// leaving room for floating point differences between platforms.
+const goldenTolerance = 1
+
+type GoldenTest struct {
+	name string
+	args []string
+}
+
+var goldenTests = []GoldenTest{
+	{"autoContrast", []string{"-ac"}},
+	{"autoLevels", []string{"-al"}},
+	{"clahe", []string{"-clahe", "-clahe-grid", "4"}},
+	{"dot10", []string{"-dot10"}},
+	{"dot20", []string{"-dot20"}},
+	{"downsample3", []string{"-d3"}},
+	{"downsample10", []string{"-d10"}},
+	{"downsample20", []string{"-d20"}},
+	{"downsample50", []string{"-d50"}},
+	{"equalize", []string{"-eq"}},
+	{"gray", []string{"-g"}},
+	{"grayBlue", []string{"-gb"}},
+	{"grayGreen", []string{"-gg"}},
+	{"grayRed", []string{"-gr"}},
+	{"hexagon10", []string{"-hex10"}},
+	{"hexagon20", []string{"-hex20"}},
+	{"overlay", []string{"-overlay", "testdata/overlay.png", "-overlay-gravity", "ne"}},
+	{"overlayTile", []string{"-overlay", "testdata/overlay.png", "-overlay-tile", "-overlay-opacity", "50"}},
+	{"pixel3", []string{"-p3"}},
+	{"pixel10", []string{"-p10"}},
+	{"pixel20", []string{"-p20"}},
+	{"pixel50", []string{"-p50"}},
+	{"shiftLeft", []string{"-l"}},
+	{"shiftRight", []string{"-r"}},
+	{"swapGB", []string{"-sgb"}},
+	{"swapRB", []string{"-srb"}},
+	{"swapRG", []string{"-srg"}},
+	{"temperature", []string{"-temp", "4000"}},
+	{"text", []string{"-text", "{width}x{height}", "-text-outline", "000000"}},
+	{"tint", []string{"-tint", "-40"}},
+	{"triangle10", []string{"-tri10"}},
+	{"triangle20", []string{"-tri20"}},
+	{"upscale2", []string{"-u2"}},
+	{"upscale3", []string{"-u3"}},
+	{"upscale4", []string{"-u4"}},
+	{"upscale10", []string{"-u10"}},
+	{"voronoi100", []string{"-vor100"}},
+	{"voronoi500", []string{"-vor500"}},
+	{"whiteBalanceGray", []string{"-wbg"}},
+	{"whiteBalanceWhite", []string{"-wbw"}},
+	{"maskEllipse", []string{"-m", "ellipse:24,16,14,10", "-feather", "3", "-p3"}},
+	{"blendMultiply", []string{"-g", "-blend", "multiply", "-opacity", "70"}},
+	{"combined", []string{"-gr", "-hex10", "-r"}},
+}
+
+func TestGoldenCoversEveryTransformation(t *testing.T) {
+	covered := make(map[TransformationType]bool)
+	for _, test := range goldenTests {
+		params, err := parseParameters(append([]string{"-i", "in.png", "-o", "out.png"}, test.args...))
+		if err != nil {
+			t.Fatalf("Golden test %v has invalid arguments: %v", test.name, err)
+		}
+		for _, transformation := range params.transformList {
+			covered[transformation] = true
+		}
+	}
+
+	for transformation := Undefined + 1; transformation < transformationCount; transformation++ {
+		if !covered[transformation] {
+			t.Errorf("Transformation %v has no golden test", transformation)
+		}
+	}
+}
+
+func TestGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join(goldenFixtureDir, "*.png"))
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("No fixtures found in %v: %v", goldenFixtureDir, err)
+	}
+
+	for _, fixture := range fixtures {
+		fixtureName := strings.TrimSuffix(filepath.Base(fixture), ".png")
+		for _, test := range goldenTests {
+			name := fixtureName + "_" + test.name
+			t.Run(name, func(t *testing.T) {
+				runGoldenTest(t, name, fixture, test.args)
+			})
+		}
+	}
+}
+
+func runGoldenTest(t *testing.T, name string, fixture string, args []string) {
+	params, err := parseParameters(append([]string{"-i", fixture, "-o", name + ".png"}, args...))
+	if err != nil {
+		t.Fatalf("Invalid arguments: %v", err)
+	}
+
+	pixels := loadGoldenPixels(t, fixture)
+	result, err := ProcessListOfTransformationsWithOptions(pixels, params.transformList, params.options)
+	if err != nil {
+		t.Fatalf("Transformation failed: %v", err)
+	}
+
+	// Written images are premultiplied RGBA, so compare the result after the
+	// same conversion rather than with the extra precision it has in memory
+	resultImage, err := CreateImageFromPixelArray(result)
+	if err != nil {
+		t.Fatalf("Cannot convert result: %v", err)
+	}
+	result, _ = CreatePixelArrayFromImage(resultImage)
+
+	goldenFile := filepath.Join(goldenDir, name+".png")
+	if *updateGoldens {
+		if err := writePng(result, goldenFile); err != nil {
+			t.Fatalf("Cannot write golden: %v", err)
+		}
+		return
+	}
+
+	if _, err := os.Stat(goldenFile); err != nil {
+		t.Fatalf("Missing golden %v, run the tests with -update to create it", goldenFile)
+	}
+	golden := loadGoldenPixels(t, goldenFile)
+
+	if len(golden) != len(result) || len(golden[0]) != len(result[0]) {
+		writeGoldenFailure(t, name, result, nil)
+		t.Fatalf("Result is %vx%v, golden is %vx%v", len(result), len(result[0]), len(golden), len(golden[0]))
+	}
+
+	comparison, err := ComparePixels(golden, result, goldenTolerance)
+	if err != nil {
+		t.Fatalf("Cannot compare with golden: %v", err)
+	}
+	if comparison.DiffPixels > 0 {
+		writeGoldenFailure(t, name, result, CreateDiffPixels(golden, result, goldenTolerance))
+		t.Errorf("%v of %v pixels differ from the golden (MAE %.4f, PSNR %.2f dB)", comparison.DiffPixels, comparison.Pixels, comparison.MAE, comparison.PSNR)
+	}
+}
+
+func loadGoldenPixels(t *testing.T, path string) [][]color.Color {
+	img, _, err := openImage(path)
+	if err != nil {
+		t.Fatalf("Cannot open %v: %v", path, err)
+	}
+	pixels, err := CreatePixelArrayFromImage(img)
+	if err != nil {
+		t.Fatalf("Cannot read pixels of %v: %v", path, err)
+	}
+	return pixels
+}
+
+// writeGoldenFailure keeps the actual result and the diff image next to the
+// goldens so a failure can be inspected.
+func writeGoldenFailure(t *testing.T, name string, result [][]color.Color, diff [][]color.Color) {
+	if err := os.MkdirAll(goldenFailureDir, 0755); err != nil {
+		t.Logf("Cannot create %v: %v", goldenFailureDir, err)
+		return
+	}
+
+	actualFile := filepath.Join(goldenFailureDir, name+"_actual.png")
+	if err := writePng(result, actualFile); err == nil {
+		t.Logf("Actual result written to %v", actualFile)
+	}
+	if diff != nil {
+		diffFile := filepath.Join(goldenFailureDir, name+"_diff.png")
+		if err := writePng(diff, diffFile); err == nil {
+			t.Logf("Differences written to %v", diffFile)
+		}
+	}
+}
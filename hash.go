@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"math/bits"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type HashAlgorithm int
+
+const (
+	AverageHashAlgorithm HashAlgorithm = iota
+	DifferenceHashAlgorithm
+	PerceptualHashAlgorithm
+)
+
+var hashAlgorithmNames = map[string]HashAlgorithm{
+	"ahash": AverageHashAlgorithm,
+	"dhash": DifferenceHashAlgorithm,
+	"phash": PerceptualHashAlgorithm,
+}
+
+var hashAlgorithmOrder = []string{"ahash", "dhash", "phash"}
+
+const defaultHashDistance = 10
+const phashSize = 32
+const phashLowFrequencies = 8
+
+type HashParameters struct {
+	inputFiles []string
+	directory  string
+	algorithms []string
+	distance   int
+	showHelp   bool
+}
+
+type DuplicateGroup struct {
+	Files []string `json:"files"`
+}
+
+func parseHashParameters(args []string, dedupe bool) (HashParameters, error) {
+	hashParams := HashParameters{distance: defaultHashDistance}
+	nextValueFlag := ""
+
+	for _, a := range args {
+		if nextValueFlag != "" {
+			switch nextValueFlag {
+			case "-i":
+				hashParams.inputFiles = append(hashParams.inputFiles, a)
+			case "-dir":
+				hashParams.directory = a
+			case "-algo":
+				if a != "all" {
+					if _, ok := hashAlgorithmNames[a]; !ok {
+						return hashParams, fmt.Errorf("unknown hash algorithm: %v", a)
+					}
+				}
+				if len(hashParams.algorithms) > 0 && (a == "all" || slices.Contains(hashParams.algorithms, "all")) {
+					return hashParams, errors.New("-algo all cannot be combined with other algorithms")
+				}
+				hashParams.algorithms = append(hashParams.algorithms, a)
+			case "-distance":
+				distance, err := strconv.Atoi(a)
+				if err != nil || distance < 0 || distance > 64 {
+					return hashParams, fmt.Errorf("invalid value for -distance: %v", a)
+				}
+				hashParams.distance = distance
+			}
+			nextValueFlag = ""
+			continue
+		}
+
+		switch a {
+		case "-i", "-algo":
+			nextValueFlag = a
+		case "-dir", "-distance":
+			if !dedupe {
+				return hashParams, fmt.Errorf("unknown hash flag: %v", a)
+			}
+			nextValueFlag = a
+		case "-h", "-help":
+			return HashParameters{showHelp: true}, nil
+		default:
+			return hashParams, fmt.Errorf("unknown flag: %v", a)
+		}
+	}
+
+	if nextValueFlag != "" {
+		return hashParams, fmt.Errorf("missing value for flag: %v", nextValueFlag)
+	}
+
+	if dedupe {
+		if len(hashParams.algorithms) > 1 || (len(hashParams.algorithms) == 1 && hashParams.algorithms[0] == "all") {
+			return hashParams, errors.New("dedupe uses a single hash algorithm")
+		}
+		if len(hashParams.algorithms) == 0 {
+			hashParams.algorithms = []string{"phash"}
+		}
+		if strings.TrimSpace(hashParams.directory) == "" {
+			return hashParams, errors.New("directory to scan not properly defined")
+		}
+		return hashParams, nil
+	}
+
+	if len(hashParams.algorithms) == 0 || (len(hashParams.algorithms) == 1 && hashParams.algorithms[0] == "all") {
+		hashParams.algorithms = hashAlgorithmOrder
+	}
+	if len(hashParams.inputFiles) == 0 {
+		return hashParams, errors.New("input file not properly defined")
+	}
+	return hashParams, nil
+}
+
+func luminanceGrid(originalPixels [][]color.Color, width int, height int) ([][]float64, error) {
+	resized, err := ResizePixels(originalPixels, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	grid := make([][]float64, width)
+	for x := range resized {
+		grid[x] = make([]float64, height)
+		for y := range resized[x] {
+			grid[x][y] = float64(pixelLuminance(resized[x][y]))
+		}
+	}
+	return grid, nil
+}
+
+// AverageHash sets a bit for every pixel of an 8x8 thumbnail brighter than
+// the thumbnail's average.
+func AverageHash(originalPixels [][]color.Color) (uint64, error) {
+	grid, err := luminanceGrid(originalPixels, 8, 8)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for x := range grid {
+		for y := range grid[x] {
+			total += grid[x][y]
+		}
+	}
+	average := total / 64
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if grid[x][y] > average {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// DifferenceHash sets a bit wherever a pixel of a 9x8 thumbnail is darker
+// than its right neighbor.
+func DifferenceHash(originalPixels [][]color.Color) (uint64, error) {
+	grid, err := luminanceGrid(originalPixels, 9, 8)
+	if err != nil {
+		return 0, err
+	}
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if grid[x][y] < grid[x+1][y] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// PerceptualHash takes the DCT of a 32x32 thumbnail and sets a bit for every
+// one of the 8x8 lowest frequencies above their median.  The DC term only
+// holds the average brightness, so it is left out and the top bit stays 0.
+func PerceptualHash(originalPixels [][]color.Color) (uint64, error) {
+	grid, err := luminanceGrid(originalPixels, phashSize, phashSize)
+	if err != nil {
+		return 0, err
+	}
+
+	coefficients := calcDCT(grid, phashLowFrequencies)
+
+	values := make([]float64, 0, phashLowFrequencies*phashLowFrequencies-1)
+	for v := 0; v < phashLowFrequencies; v++ {
+		for u := 0; u < phashLowFrequencies; u++ {
+			if u != 0 || v != 0 {
+				values = append(values, coefficients[u][v])
+			}
+		}
+	}
+	sort.Float64s(values)
+	// An odd count of 63 values, so the median is the middle one
+	median := values[len(values)/2]
+
+	var hash uint64
+	for v := 0; v < phashLowFrequencies; v++ {
+		for u := 0; u < phashLowFrequencies; u++ {
+			if u == 0 && v == 0 {
+				continue
+			}
+			hash <<= 1
+			if coefficients[u][v] > median {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// calcDCT returns the lowest frequencies of the two dimensional DCT-II of
+// a square grid.
+func calcDCT(grid [][]float64, frequencies int) [][]float64 {
+	size := len(grid)
+	cosines := make([][]float64, frequencies)
+	for u := range cosines {
+		cosines[u] = make([]float64, size)
+		for x := range cosines[u] {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / float64(2*size))
+		}
+	}
+
+	coefficients := make([][]float64, frequencies)
+	for u := range coefficients {
+		coefficients[u] = make([]float64, frequencies)
+		for v := range coefficients[u] {
+			sum := 0.0
+			for x := 0; x < size; x++ {
+				for y := 0; y < size; y++ {
+					sum += grid[x][y] * cosines[u][x] * cosines[v][y]
+				}
+			}
+			coefficients[u][v] = sum
+		}
+	}
+	return coefficients
+}
+
+func calcHash(algorithm HashAlgorithm, originalPixels [][]color.Color) (uint64, error) {
+	switch algorithm {
+	case AverageHashAlgorithm:
+		return AverageHash(originalPixels)
+	case DifferenceHashAlgorithm:
+		return DifferenceHash(originalPixels)
+	case PerceptualHashAlgorithm:
+		return PerceptualHash(originalPixels)
+	}
+	return 0, fmt.Errorf("unknown hash algorithm: %v", algorithm)
+}
+
+func hashDistance(first uint64, second uint64) int {
+	return bits.OnesCount64(first ^ second)
+}
+
+func hashFile(algorithm HashAlgorithm, path string) (uint64, error) {
+	img, _, err := openImage(path)
+	if err != nil {
+		return 0, err
+	}
+	pixels, err := CreatePixelArrayFromImage(img)
+	if err != nil {
+		return 0, err
+	}
+	return calcHash(algorithm, pixels)
+}
+
+// GroupDuplicates puts files whose hashes are within the distance into the
+// same group.  Groups are transitive, so a group can hold files further
+// apart than the distance when others link them.
+func GroupDuplicates(files []string, hashes []uint64, distance int) []DuplicateGroup {
+	parents := make([]int, len(files))
+	for index := range parents {
+		parents[index] = index
+	}
+	var findRoot func(int) int
+	findRoot = func(index int) int {
+		if parents[index] != index {
+			parents[index] = findRoot(parents[index])
+		}
+		return parents[index]
+	}
+
+	for first := range files {
+		for second := first + 1; second < len(files); second++ {
+			if hashDistance(hashes[first], hashes[second]) <= distance {
+				parents[findRoot(second)] = findRoot(first)
+			}
+		}
+	}
+
+	members := make(map[int][]string)
+	var roots []int
+	for index, file := range files {
+		root := findRoot(index)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], file)
+	}
+
+	groups := []DuplicateGroup{}
+	for _, root := range roots {
+		if len(members[root]) > 1 {
+			groups = append(groups, DuplicateGroup{Files: members[root]})
+		}
+	}
+	return groups
+}
+
+func showHashHelp() {
+	fmt.Println("imagesTx.exe hash -i <input file> [-i <input file> ...] [-algo ahash|dhash|phash|all]")
+	fmt.Println("imagesTx.exe dedupe -dir <directory> [-algo ahash|dhash|phash] [-distance <bits>]")
+	fmt.Println("")
+	fmt.Println("hash prints 64 bit perceptual hashes of images as hexadecimal.")
+	fmt.Println("dedupe hashes every image below the directory and prints JSON groups of images")
+	fmt.Printf("whose hashes differ in at most -distance bits (default %v, using phash).\n", defaultHashDistance)
+	fmt.Println("")
+}
+
+func runHash(args []string, w io.Writer) error {
+	hashParams, err := parseHashParameters(args, false)
+	if err != nil {
+		return &InvalidParameterError{Err: err}
+	}
+	if hashParams.showHelp {
+		showHashHelp()
+		return nil
+	}
+
+	for _, file := range hashParams.inputFiles {
+		img, _, err := openImage(file)
+		if err != nil {
+			return err
+		}
+		pixels, err := CreatePixelArrayFromImage(img)
+		if err != nil {
+			return err
+		}
+		for _, name := range hashParams.algorithms {
+			hash, err := calcHash(hashAlgorithmNames[name], pixels)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%v %016x %v\n", name, hash, file)
+		}
+	}
+	return nil
+}
+
+func runDedupe(args []string, w io.Writer) error {
+	hashParams, err := parseHashParameters(args, true)
+	if err != nil {
+		return &InvalidParameterError{Err: err}
+	}
+	if hashParams.showHelp {
+		showHashHelp()
+		return nil
+	}
+
+	algorithm := hashAlgorithmNames[hashParams.algorithms[0]]
+	var files []string
+	var hashes []uint64
+	err = filepath.WalkDir(hashParams.directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return &IOError{Path: path, Err: err}
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		hash, err := hashFile(algorithm, path)
+		if err != nil {
+			log.Printf("Skipping %v: %v", path, err)
+			return nil
+		}
+		files = append(files, path)
+		hashes = append(hashes, hash)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(GroupDuplicates(files, hashes, hashParams.distance))
+}
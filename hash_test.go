@@ -0,0 +1,140 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"math/bits"
+	"reflect"
+	"testing"
+)
+
+func createPatternPixels(width int, height int) [][]color.Color {
+	pixels := make([][]color.Color, width)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, height)
+		for y := range pixels[x] {
+			value := uint8(128 + 60*math.Sin(float64(x)/5) + 50*math.Cos(float64(x*y)/200))
+			pixels[x][y] = color.RGBA{value, value, value, 255}
+		}
+	}
+	return pixels
+}
+
+func TestAverageHash(t *testing.T) {
+	pixels := make([][]color.Color, 16)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, 16)
+		for y := range pixels[x] {
+			pixels[x][y] = color.Black
+			if y < 8 {
+				pixels[x][y] = color.White
+			}
+		}
+	}
+
+	hash, err := AverageHash(pixels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hash != 0xffffffff00000000 {
+		t.Errorf("expected top half set, got %016x", hash)
+	}
+}
+
+func TestDifferenceHash(t *testing.T) {
+	pixels := make([][]color.Color, 18)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, 8)
+		for y := range pixels[x] {
+			value := uint8(x * 14)
+			pixels[x][y] = color.RGBA{value, value, value, 255}
+		}
+	}
+
+	hash, err := DifferenceHash(pixels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hash != 0xffffffffffffffff {
+		t.Errorf("expected every bit set for a left to right gradient, got %016x", hash)
+	}
+}
+
+func TestPerceptualHashStable(t *testing.T) {
+	pixels := createPatternPixels(120, 80)
+	original, err := PerceptualHash(pixels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The DC term gets no bit and half of the other 63 are above the median
+	if original>>63 != 0 || bits.OnesCount64(original) != 31 {
+		t.Errorf("expected 31 bits below the unused DC bit, got %016x", original)
+	}
+
+	resized, _ := ResizePixels(pixels, 60, 40)
+	smaller, err := PerceptualHash(resized)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if distance := hashDistance(original, smaller); distance > 4 {
+		t.Errorf("expected resized image to hash closely, distance %v", distance)
+	}
+
+	inverted := CopyPixelArray(pixels)
+	for x := range inverted {
+		for y := range inverted[x] {
+			value := 255 - inverted[x][y].(color.RGBA).R
+			inverted[x][y] = color.RGBA{value, value, value, 255}
+		}
+	}
+	different, _ := PerceptualHash(inverted)
+	if distance := hashDistance(original, different); distance < 20 {
+		t.Errorf("expected inverted image to hash differently, distance %v", distance)
+	}
+}
+
+func TestCalcDCT(t *testing.T) {
+	grid := [][]float64{{1, 1}, {1, 1}}
+	coefficients := calcDCT(grid, 2)
+	if math.Abs(coefficients[0][0]-4) > 1e-9 || math.Abs(coefficients[1][0]) > 1e-9 || math.Abs(coefficients[1][1]) > 1e-9 {
+		t.Errorf("unexpected DCT of a flat grid: %v", coefficients)
+	}
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	files := []string{"a", "b", "c", "d", "e"}
+	hashes := []uint64{0x0, 0xff00000000000000, 0x3, 0xf, 0xff00000000000001}
+
+	groups := GroupDuplicates(files, hashes, 2)
+	expected := []DuplicateGroup{{Files: []string{"a", "c", "d"}}, {Files: []string{"b", "e"}}}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected %v, got %v", expected, groups)
+	}
+
+	if groups := GroupDuplicates(files, hashes, 0); len(groups) != 0 {
+		t.Errorf("expected no groups, got %v", groups)
+	}
+}
+
+func TestParseHashParameters(t *testing.T) {
+	hashParams, err := parseHashParameters([]string{"-i", "a.png"}, false)
+	if err != nil || !reflect.DeepEqual(hashParams.algorithms, hashAlgorithmOrder) {
+		t.Errorf("expected every algorithm by default, got %v %v", hashParams.algorithms, err)
+	}
+
+	hashParams, err = parseHashParameters([]string{"-dir", "photos", "-distance", "6"}, true)
+	if err != nil || hashParams.distance != 6 || hashParams.algorithms[0] != "phash" {
+		t.Errorf("unexpected dedupe parameters %+v %v", hashParams, err)
+	}
+
+	invalidArgs := [][]string{{"-i", "a.png", "-algo", "xhash"}, {"-i", "a.png", "-dir", "photos"}, {},
+		{"-i", "a.png", "-algo", "all", "-algo", "dhash"}, {"-i", "a.png", "-algo", "dhash", "-algo", "all"}}
+	for _, args := range invalidArgs {
+		if _, err := parseHashParameters(args, false); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+	if _, err := parseHashParameters([]string{"-dir", "photos", "-distance", "65"}, true); err == nil {
+		t.Error("expected error for distance above 64")
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// Sizes written to an icon, the favicon sizes browsers and operating systems
+// ask for.
+var icoSizes = []int{16, 32, 48, 64, 128, 256}
+
+// Entries from this size up are stored as PNG, smaller ones as bitmaps that
+// older readers expect.
+const icoPNGSize = 64
+
+const icoMagic = "\x00\x00\x01\x00"
+
+// icoEntry is one image in the icon directory.
+type icoEntry struct {
+	width  int
+	height int
+	data   []byte
+}
+
+func init() {
+	image.RegisterFormat("ico", icoMagic, decodeICO, decodeICOConfig)
+}
+
+// readICODirectory returns the entries of the icon, each with its image data.
+func readICODirectory(data []byte) ([]icoEntry, error) {
+	if len(data) < 6 || string(data[:4]) != icoMagic {
+		return nil, errors.New("ico: invalid header")
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if count == 0 || len(data) < 6+16*count {
+		return nil, errors.New("ico: invalid directory")
+	}
+
+	entries := make([]icoEntry, count)
+	for index := range entries {
+		record := data[6+16*index:]
+		entry := icoEntry{width: int(record[0]), height: int(record[1])}
+		// 0 means 256
+		if entry.width == 0 {
+			entry.width = 256
+		}
+		if entry.height == 0 {
+			entry.height = 256
+		}
+
+		size := int64(binary.LittleEndian.Uint32(record[8:]))
+		offset := int64(binary.LittleEndian.Uint32(record[12:]))
+		if offset+size > int64(len(data)) {
+			return nil, fmt.Errorf("ico: entry %v outside the file", index+1)
+		}
+		entry.data = data[offset : offset+size]
+		entries[index] = entry
+	}
+	return entries, nil
+}
+
+// largestICOEntry picks the entry viewers show when the size is free.
+func largestICOEntry(entries []icoEntry) icoEntry {
+	largest := entries[0]
+	for _, entry := range entries[1:] {
+		if entry.width*entry.height > largest.width*largest.height {
+			largest = entry
+		}
+	}
+	return largest
+}
+
+func decodeICOConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	entries, err := readICODirectory(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	largest := largestICOEntry(entries)
+	if bytes.HasPrefix(largest.data, pngSignature) {
+		// The directory can only hold sizes up to 256
+		return png.DecodeConfig(bytes.NewReader(largest.data))
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: largest.width, Height: largest.height}, nil
+}
+
+// decodeICO decodes the largest image of the icon.
+func decodeICO(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readICODirectory(data)
+	if err != nil {
+		return nil, err
+	}
+	return decodeICOEntry(largestICOEntry(entries))
+}
+
+// DecodeICOImages decodes every image of the icon, in directory order.
+func DecodeICOImages(data []byte) ([]image.Image, error) {
+	entries, err := readICODirectory(data)
+	if err != nil {
+		return nil, err
+	}
+	var images []image.Image
+	for index, entry := range entries {
+		img, err := decodeICOEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("entry %v: %w", index+1, err)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+func decodeICOEntry(entry icoEntry) (image.Image, error) {
+	if bytes.HasPrefix(entry.data, pngSignature) {
+		return png.Decode(bytes.NewReader(entry.data))
+	}
+	return decodeICOBitmap(entry)
+}
+
+// decodeICOBitmap reads a bitmap entry: a BITMAPINFOHEADER with twice the
+// height, the color table for 1, 4 and 8 bit images, the bottom-up color rows
+// and the 1 bit transparency mask.  The size must match the directory, which
+// is the size decodeICOConfig reports.
+func decodeICOBitmap(entry icoEntry) (image.Image, error) {
+	data := entry.data
+	if len(data) < 40 || binary.LittleEndian.Uint32(data) < 40 {
+		return nil, errors.New("ico: invalid bitmap header")
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bitCount := int(binary.LittleEndian.Uint16(data[14:]))
+	compression := binary.LittleEndian.Uint32(data[16:])
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:]))
+
+	if !validCodecSize(width, height) {
+		return nil, fmt.Errorf("ico: invalid size %vx%v", width, height)
+	}
+	if width != entry.width || height != entry.height {
+		return nil, fmt.Errorf("ico: bitmap is %vx%v but the directory says %vx%v", width, height, entry.width, entry.height)
+	}
+	if compression != 0 {
+		return nil, errors.New("ico: compressed bitmaps are not supported")
+	}
+
+	var palette []color.NRGBA
+	switch bitCount {
+	case 1, 4, 8:
+		if colorsUsed == 0 || colorsUsed > 1<<bitCount {
+			colorsUsed = 1 << bitCount
+		}
+		if len(data) < headerSize+4*colorsUsed {
+			return nil, errors.New("ico: truncated color table")
+		}
+		for index := 0; index < colorsUsed; index++ {
+			quad := data[headerSize+4*index:]
+			palette = append(palette, color.NRGBA{quad[2], quad[1], quad[0], 255})
+		}
+	case 24, 32:
+	default:
+		return nil, fmt.Errorf("ico: unsupported bit count %v", bitCount)
+	}
+
+	// Rows are padded to 4 bytes
+	stride := (width*bitCount + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	pixelsStart := headerSize + 4*len(palette)
+	maskStart := pixelsStart + stride*height
+	if len(data) < maskStart {
+		return nil, errors.New("ico: truncated bitmap")
+	}
+	hasMask := len(data) >= maskStart+maskStride*height
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	anyAlpha := false
+	for y := 0; y < height; y++ {
+		row := data[pixelsStart+(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			var pixel color.NRGBA
+			switch bitCount {
+			case 32:
+				pixel = color.NRGBA{row[4*x+2], row[4*x+1], row[4*x], row[4*x+3]}
+				anyAlpha = anyAlpha || pixel.A != 0
+			case 24:
+				pixel = color.NRGBA{row[3*x+2], row[3*x+1], row[3*x], 255}
+			default:
+				bit := x * bitCount
+				index := int(row[bit/8]>>(8-bitCount-bit%8)) & (1<<bitCount - 1)
+				if index < len(palette) {
+					pixel = palette[index]
+				}
+			}
+			img.SetNRGBA(x, y, pixel)
+		}
+	}
+
+	// 32 bit images carry alpha, the mask only matters when every pixel is
+	// transparent by alpha, as in icons written before alpha was used
+	if hasMask && (bitCount != 32 || !anyAlpha) {
+		for y := 0; y < height; y++ {
+			row := data[maskStart+(height-1-y)*maskStride:]
+			for x := 0; x < width; x++ {
+				offset := img.PixOffset(x, y)
+				if row[x/8]&(0x80>>(x%8)) != 0 {
+					img.Pix[offset+3] = 0
+				} else {
+					img.Pix[offset+3] = 255
+				}
+			}
+		}
+	}
+	return img, nil
+}
+
+// fitICOSquare resizes the pixels to fit a size x size square, keeping the
+// aspect ratio and centering them on transparency.
+func fitICOSquare(pixels [][]color.Color, size int) (image.Image, error) {
+	width, height := size, size
+	if len(pixels) > len(pixels[0]) {
+		height = max(1, size*len(pixels[0])/len(pixels))
+	} else {
+		width = max(1, size*len(pixels)/len(pixels[0]))
+	}
+
+	resized, err := ResizePixels(pixels, width, height)
+	if err != nil {
+		return nil, err
+	}
+	img, err := CreateImageFromPixelArray(resized)
+	if err != nil {
+		return nil, err
+	}
+
+	square := image.NewNRGBA(image.Rect(0, 0, size, size))
+	offset := image.Pt((size-width)/2, (size-height)/2)
+	draw.Draw(square, image.Rectangle{offset, offset.Add(img.Bounds().Size())}, img, image.Point{}, draw.Src)
+	return square, nil
+}
+
+// encodeICOBitmap writes a 32 bit bitmap entry with its transparency mask.
+func encodeICOBitmap(img *image.NRGBA) []byte {
+	size := img.Bounds().Dx()
+	maskStride := (size + 31) / 32 * 4
+
+	data := binary.LittleEndian.AppendUint32(nil, 40)
+	data = binary.LittleEndian.AppendUint32(data, uint32(size))
+	// The height counts the color rows and the mask rows
+	data = binary.LittleEndian.AppendUint32(data, uint32(2*size))
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 32)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, uint32(4*size*size+maskStride*size))
+	data = append(data, make([]byte, 16)...)
+
+	for y := size - 1; y >= 0; y-- {
+		for x := 0; x < size; x++ {
+			pixel := img.NRGBAAt(x, y)
+			data = append(data, pixel.B, pixel.G, pixel.R, pixel.A)
+		}
+	}
+	for y := size - 1; y >= 0; y-- {
+		mask := make([]byte, maskStride)
+		for x := 0; x < size; x++ {
+			if img.NRGBAAt(x, y).A == 0 {
+				mask[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		data = append(data, mask...)
+	}
+	return data
+}
+
+// EncodeICO writes an icon holding the image at every size, resized with
+// ResizePixels.
+func EncodeICO(w io.Writer, pixels [][]color.Color, sizes []int) error {
+	if len(pixels) == 0 || len(pixels[0]) == 0 {
+		return errors.New("cannot write an icon from an empty pixel array")
+	}
+	if len(sizes) == 0 {
+		return errors.New("icon has no sizes")
+	}
+
+	var entries [][]byte
+	for _, size := range sizes {
+		if size < 1 || size > 256 {
+			return fmt.Errorf("icon size must be between 1 and 256: %v", size)
+		}
+		img, err := fitICOSquare(pixels, size)
+		if err != nil {
+			return err
+		}
+
+		if size < icoPNGSize {
+			entries = append(entries, encodeICOBitmap(img.(*image.NRGBA)))
+			continue
+		}
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, img); err != nil {
+			return err
+		}
+		entries = append(entries, encoded.Bytes())
+	}
+
+	header := []byte(icoMagic)
+	header = binary.LittleEndian.AppendUint16(header, uint16(len(entries)))
+	offset := len(header) + 16*len(entries)
+	for index, entry := range entries {
+		// 256 is stored as 0
+		size := byte(sizes[index])
+		header = append(header, size, size, 0, 0)
+		header = binary.LittleEndian.AppendUint16(header, 1)
+		header = binary.LittleEndian.AppendUint16(header, 32)
+		header = binary.LittleEndian.AppendUint32(header, uint32(len(entry)))
+		header = binary.LittleEndian.AppendUint32(header, uint32(offset))
+		offset += len(entry)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := w.Write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
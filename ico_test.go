@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEncodeICO(t *testing.T) {
+	// Wider than tall, so every entry is padded top and bottom
+	pixels := make([][]color.Color, 40)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, 20)
+		for y := range pixels[x] {
+			pixels[x][y] = color.RGBA{200, 40, 40, 255}
+		}
+	}
+
+	var data bytes.Buffer
+	if err := EncodeICO(&data, pixels, icoSizes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries, err := readICODirectory(data.Bytes())
+	if err != nil || len(entries) != len(icoSizes) {
+		t.Fatalf("expected %v entries, got %v %v", len(icoSizes), len(entries), err)
+	}
+	for index, entry := range entries {
+		if entry.width != icoSizes[index] || entry.height != icoSizes[index] {
+			t.Errorf("entry %v: expected %v pixels, got %vx%v", index, icoSizes[index], entry.width, entry.height)
+		}
+		if isPNG := bytes.HasPrefix(entry.data, pngSignature); isPNG != (icoSizes[index] >= icoPNGSize) {
+			t.Errorf("entry %v: unexpected PNG %v for size %v", index, isPNG, icoSizes[index])
+		}
+	}
+
+	images, err := DecodeICOImages(data.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for index, img := range images {
+		size := icoSizes[index]
+		if img.Bounds().Dx() != size || img.Bounds().Dy() != size {
+			t.Fatalf("entry %v: unexpected bounds %v", index, img.Bounds())
+		}
+		center := color.NRGBAModel.Convert(img.At(size/2, size/2)).(color.NRGBA)
+		corner := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA)
+		if center != (color.NRGBA{200, 40, 40, 255}) || corner.A != 0 {
+			t.Errorf("entry %v: expected the color centered on transparency, got %v %v", index, center, corner)
+		}
+	}
+
+	// image.Decode finds the format and picks the largest entry
+	img, format, err := image.Decode(bytes.NewReader(data.Bytes()))
+	if err != nil || format != "ico" || img.Bounds().Dx() != 256 {
+		t.Errorf("expected the 256 pixel ico entry, got %v %v %v", format, img, err)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data.Bytes()))
+	if err != nil || config.Width != 256 || config.Height != 256 {
+		t.Errorf("expected a 256x256 config, got %v %v", config, err)
+	}
+}
+
+func TestEncodeICOErrors(t *testing.T) {
+	for _, sizes := range [][]int{nil, {0}, {300}} {
+		if err := EncodeICO(&bytes.Buffer{}, createGray2DArray(), sizes); err == nil {
+			t.Errorf("expected an error for sizes %v", sizes)
+		}
+	}
+	if err := EncodeICO(&bytes.Buffer{}, nil, icoSizes); err == nil {
+		t.Error("expected an error for an empty pixel array")
+	}
+}
+
+// buildPalettedICO writes a 2x2 icon with an 8 bit bitmap whose mask makes
+// the top left pixel transparent.
+func buildPalettedICO() []byte {
+	bitmap := binary.LittleEndian.AppendUint32(nil, 40)
+	bitmap = binary.LittleEndian.AppendUint32(bitmap, 2)
+	bitmap = binary.LittleEndian.AppendUint32(bitmap, 4)
+	bitmap = binary.LittleEndian.AppendUint16(bitmap, 1)
+	bitmap = binary.LittleEndian.AppendUint16(bitmap, 8)
+	bitmap = append(bitmap, make([]byte, 16)...)
+	// Two colors used
+	bitmap = binary.LittleEndian.AppendUint32(bitmap, 2)
+	bitmap = append(bitmap, make([]byte, 4)...)
+	// Blue and red in BGR order
+	bitmap = append(bitmap, 255, 0, 0, 0, 0, 0, 255, 0)
+	// Bottom row first, padded to 4 bytes: bottom red red, top blue red
+	bitmap = append(bitmap, 1, 1, 0, 0, 0, 1, 0, 0)
+	// Mask rows, bottom first
+	bitmap = append(bitmap, 0, 0, 0, 0, 0x80, 0, 0, 0)
+
+	data := []byte(icoMagic)
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = append(data, 2, 2, 2, 0)
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 8)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(bitmap)))
+	data = binary.LittleEndian.AppendUint32(data, 22)
+	return append(data, bitmap...)
+}
+
+func TestDecodeICOBitmap(t *testing.T) {
+	img, format, err := image.Decode(bytes.NewReader(buildPalettedICO()))
+	if err != nil || format != "ico" {
+		t.Fatalf("expected to decode ico, got %v %v", format, err)
+	}
+
+	expected := map[image.Point]color.NRGBA{
+		{0, 0}: {0, 0, 255, 0},
+		{1, 0}: {255, 0, 0, 255},
+		{0, 1}: {255, 0, 0, 255},
+		{1, 1}: {255, 0, 0, 255},
+	}
+	for point, want := range expected {
+		if got := img.At(point.X, point.Y); got != want {
+			t.Errorf("pixel %v: expected %v, got %v", point, want, got)
+		}
+	}
+}
+
+func TestDecodeICOErrors(t *testing.T) {
+	valid := buildPalettedICO()
+	outside := bytes.Clone(valid)
+	binary.LittleEndian.PutUint32(outside[18:], 1000)
+	depth := bytes.Clone(valid)
+	binary.LittleEndian.PutUint16(depth[22+14:], 16)
+	// The directory says 2x2 while the bitmap header asks for 100x100
+	mismatch := bytes.Clone(valid)
+	binary.LittleEndian.PutUint32(mismatch[22+4:], 100)
+	binary.LittleEndian.PutUint32(mismatch[22+8:], 200)
+	truncated := bytes.Clone(valid[:len(valid)-12])
+	binary.LittleEndian.PutUint32(truncated[14:], uint32(len(truncated)-22))
+
+	for name, data := range map[string][]byte{
+		"Header":    []byte("\x00\x00\x02\x00\x01\x00"),
+		"Directory": valid[:10],
+		"Outside":   outside,
+		"Depth":     depth,
+		"Mismatch":  mismatch,
+		"Truncated": truncated,
+	} {
+		if _, err := DecodeICOImages(data); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
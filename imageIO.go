@@ -1,49 +1,145 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
-	"log"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
 )
 
+const maxImagePixels = 100_000_000
+
+// Passing streamPath as the input or output file reads from stdin or writes
+// to stdout.
+const streamPath = "-"
+
+var stdin io.Reader = os.Stdin
+var stdout io.Writer = os.Stdout
+var stderr io.Writer = os.Stderr
+
+var imageFormatNames = map[string]string{
+	"jpeg": "jpeg",
+	"jpg":  "jpeg",
+	"png":  "png",
+	"gif":  "gif",
+	"bmp":  "bmp",
+	"tiff": "tiff",
+	"tif":  "tiff",
+	"pbm":  "pbm",
+	"pgm":  "pgm",
+	"ppm":  "ppm",
+	"pam":  "pam",
+	"qoi":  "qoi",
+	"ico":  "ico",
+}
+
+func parseImageFormat(value string) (string, error) {
+	format, ok := imageFormatNames[strings.ToLower(value)]
+	if !ok {
+		return "", fmt.Errorf("unknown image format: %v (use jpeg, png, gif, bmp, tiff, pbm, pgm, ppm, pam, qoi or ico)", value)
+	}
+	return format, nil
+}
+
 func openJpeg(path string) (image.Image, error) {
-	fileReader, err := os.Open(path)
+	img, _, err := openImage(path)
+	return img, err
+}
+
+// openImage decodes the image and reports the format image.Decode detected.
+func openImage(path string) (image.Image, string, error) {
+	data, err := readImageData(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return decodeImage(bytes.NewReader(data), imageSourceName(path))
+}
+
+// readImageData reads the file, or stdin for streamPath, without decoding it.
+func readImageData(path string) ([]byte, error) {
+	if path == streamPath {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, &IOError{Path: "stdin", Err: err}
+		}
+		return data, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &IOError{Path: path, Err: err}
+	}
+	return data, nil
+}
+
+func imageSourceName(path string) string {
+	if path == streamPath {
+		return "stdin"
+	}
+	return path
+}
+
+var errImageTooLarge = errors.New("image is too large")
+
+func decodeImage(reader io.Reader, name string) (image.Image, string, error) {
+	return decodeImageWithLimit(reader, name, maxImagePixels)
+}
+
+// decodeImageWithLimit checks the dimensions in the header first, so a small
+// file claiming a huge image is rejected before the pixels are allocated.
+func decodeImageWithLimit(reader io.Reader, name string, maxPixels int64) (image.Image, string, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", &IOError{Path: name, Err: err}
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
-		log.Printf("Error opening file: %s", err)
-		return nil, err
+		return nil, "", &DecodeError{Path: name, Err: err}
+	}
+	if int64(config.Width)*int64(config.Height) > maxPixels {
+		err = fmt.Errorf("%w: %vx%v pixels is above the %v pixel limit", errImageTooLarge, config.Width, config.Height, maxPixels)
+		return nil, "", &DecodeError{Path: name, Err: err}
 	}
-	defer fileReader.Close()
 
-	img, _, err := image.Decode(fileReader)
+	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		log.Printf("Error decoding image data: %s", err)
-		return nil, nil
+		return nil, "", &DecodeError{Path: name, Err: err}
 	}
 
-	return img, nil
+	return img, format, nil
 }
 
 func writeJpeg(pixels [][]color.Color, filePath string) error {
 
 	newImage, err := CreateImageFromPixelArray(pixels)
 	if err != nil {
-		log.Printf("Could not create new image: %v", err)
-		return err
+		return &EncodeError{Path: filePath, Err: err}
 	}
 
 	file, err := os.Create(filePath)
 	if err != nil {
-		log.Printf("Could not write new image: %v", err)
-		return err
+		return &IOError{Path: filePath, Err: err}
 	}
 	defer file.Close()
 
 	err = jpeg.Encode(file, newImage, nil)
+	if err != nil {
+		return &EncodeError{Path: filePath, Err: err}
+	}
 
-	return err
+	return nil
 
 }
 
@@ -51,19 +147,82 @@ func writePng(pixels [][]color.Color, filePath string) error {
 
 	newImage, err := CreateImageFromPixelArray(pixels)
 	if err != nil {
-		log.Printf("Could not create new image: %v", err)
-		return err
+		return &EncodeError{Path: filePath, Err: err}
 	}
 
 	file, err := os.Create(filePath)
 	if err != nil {
-		log.Printf("Could not write new image: %v", err)
-		return err
+		return &IOError{Path: filePath, Err: err}
 	}
 	defer file.Close()
 
 	err = png.Encode(file, newImage)
+	if err != nil {
+		return &EncodeError{Path: filePath, Err: err}
+	}
 
-	return err
+	return nil
 
 }
+
+// encodeImage writes the pixels to w in one of the formats known to
+// parseImageFormat.
+func encodeImage(w io.Writer, pixels [][]color.Color, format string, name string) error {
+	return encodeImageWithQuality(w, pixels, format, name, jpeg.DefaultQuality)
+}
+
+// encodeImageWithQuality is encodeImage with the JPEG quality (1-100), other
+// formats ignore it.
+func encodeImageWithQuality(w io.Writer, pixels [][]color.Color, format string, name string, quality int) error {
+	newImage, err := CreateImageFromPixelArray(pixels)
+	if err != nil {
+		return &EncodeError{Path: name, Err: err}
+	}
+
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(w, newImage, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(w, newImage)
+	case "gif":
+		err = gif.Encode(w, newImage, &gif.Options{NumColors: 256, Quantizer: medianCutQuantizer{}})
+	case "bmp":
+		err = bmp.Encode(w, newImage)
+	case "tiff":
+		err = tiff.Encode(w, newImage, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+	case "pbm", "pgm", "ppm", "pam":
+		err = encodeNetpbm(w, newImage, format)
+	case "qoi":
+		err = encodeQOI(w, newImage)
+	case "ico":
+		err = EncodeICO(w, pixels, icoSizes)
+	default:
+		err = fmt.Errorf("unknown image format: %v", format)
+	}
+	if err != nil {
+		return &EncodeError{Path: name, Err: err}
+	}
+	return nil
+}
+
+// writeOutputData writes encoded data to the file, or stdout for streamPath.
+func writeOutputData(path string, data []byte) error {
+	if path == streamPath {
+		if _, err := stdout.Write(data); err != nil {
+			return &IOError{Path: "stdout", Err: err}
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return &IOError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// writeImageFile writes a PNG for a .png extension and a JPEG otherwise.
+func writeImageFile(pixels [][]color.Color, filePath string) error {
+	if strings.ToLower(filepath.Ext(filePath)) == ".png" {
+		return writePng(pixels, filePath)
+	}
+	return writeJpeg(pixels, filePath)
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"image"
 	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -25,11 +33,20 @@ func TestOpenJpeg(t *testing.T) {
 		{"FileDoesNotExist", fmt.Sprintf("%s/%s", testDir, "fake.jpeg"), true, "no such file or directory"},
 		{"FileDoesNotExist", fmt.Sprintf("%s/%s", "fake/directory", "fake.jpeg"), true, "no such file or directory"},
 		{"FileExists", fmt.Sprintf("%s/%s/%s", currDir, "images", "test_image.jpg"), false, ""},
+		{"FileNotImage", fmt.Sprintf("%s/%s", currDir, "go.mod"), true, "unknown format"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := openJpeg(tt.pathToTest)
+			img, err := openJpeg(tt.pathToTest)
+			if err == nil && img == nil {
+				t.Errorf("Test %s returned neither an image nor an error", tt.name)
+			}
+
+			if err == nil && tt.expectErr {
+				t.Errorf("Test %s should have returned an error", tt.name)
+			}
+
 			if err != nil && !tt.expectErr {
 				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
 			}
@@ -112,3 +129,82 @@ func TestWritePngBad2(t *testing.T) {
 		t.Errorf("writing png should have returned an error")
 	}
 }
+
+func FuzzDecodeImage(f *testing.F) {
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 3, 2)))
+	f.Add(pngData.Bytes())
+
+	var jpegData bytes.Buffer
+	jpeg.Encode(&jpegData, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+	f.Add(jpegData.Bytes())
+
+	f.Add([]byte("GIF89a"))
+	f.Add([]byte{})
+
+	// Most inputs are invalid, keep their decode errors out of the output
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Headers for large images are valid but too slow to decode while fuzzing
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err == nil && int64(config.Width)*int64(config.Height) > 1<<20 {
+			return
+		}
+
+		img, format, err := decodeImage(bytes.NewReader(data), "fuzz")
+		if err != nil {
+			if img != nil {
+				t.Errorf("decodeImage returned an image with error %v", err)
+			}
+			return
+		}
+
+		if img == nil || format == "" {
+			t.Fatalf("decodeImage returned no image or format without an error")
+		}
+		if _, err := CreatePixelArrayFromImage(img); err != nil {
+			t.Errorf("cannot read pixels of decoded %v image: %v", format, err)
+		}
+	})
+}
+
+func TestDecodeImageTooLarge(t *testing.T) {
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewGray(image.Rect(0, 0, 1, 1)))
+
+	// Rewrite the header to claim 20000x20000 pixels, the decoder must refuse
+	// before allocating them
+	data := pngData.Bytes()
+	data[16], data[17], data[18], data[19] = 0, 0, 0x4e, 0x20
+	data[20], data[21], data[22], data[23] = 0, 0, 0x4e, 0x20
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	img, _, err := decodeImage(bytes.NewReader(data), "large.png")
+	if err == nil || img != nil || !strings.Contains(err.Error(), "pixel limit") {
+		t.Errorf("expected the pixel limit error, got %v", err)
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	for _, format := range []string{"jpeg", "png", "gif", "bmp", "tiff", "pbm", "pgm", "ppm", "pam", "qoi", "ico"} {
+		var data bytes.Buffer
+		if err := encodeImage(&data, createGray2DArray(), format, "test"); err != nil {
+			t.Fatalf("encoding %v returned an error: %v", format, err)
+		}
+
+		_, decodedFormat, err := decodeImage(&data, "test")
+		if err != nil || decodedFormat != format {
+			t.Errorf("expected to decode %v, got %v %v", format, decodedFormat, err)
+		}
+	}
+
+	if err := encodeImage(&bytes.Buffer{}, createGray2DArray(), "webp", "test"); exitCodeForError(err) != exitEncode {
+		t.Errorf("expected an encode error for an unknown format, got %v", err)
+	}
+
+	if format, err := parseImageFormat("JPG"); err != nil || format != "jpeg" {
+		t.Errorf("expected jpg to mean jpeg, got %v %v", format, err)
+	}
+}
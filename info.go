@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+const dominantColorCount = 5
+const sparklineBins = 32
+
+var sparklineChars = []rune("▁▂▃▄▅▆▇█")
+
+type InfoParameters struct {
+	inputFile string
+	asJSON    bool
+	showHelp  bool
+}
+
+type ChannelReport struct {
+	Name      string   `json:"name"`
+	Min       uint8    `json:"min"`
+	Max       uint8    `json:"max"`
+	Mean      float64  `json:"mean"`
+	StdDev    float64  `json:"stddev"`
+	Histogram [256]int `json:"histogram"`
+}
+
+type DominantColor struct {
+	Color   string  `json:"color"`
+	Percent float64 `json:"percent"`
+}
+
+type ImageReport struct {
+	File           string          `json:"file"`
+	Format         string          `json:"format"`
+	Width          int             `json:"width"`
+	Height         int             `json:"height"`
+	ColorModel     string          `json:"colorModel"`
+	Channels       []ChannelReport `json:"channels"`
+	UniqueColors   int             `json:"uniqueColors"`
+	DominantColors []DominantColor `json:"dominantColors"`
+}
+
+func parseInfoParameters(args []string) (InfoParameters, error) {
+	var infoParams InfoParameters
+	nextValueInput := false
+
+	for _, a := range args {
+		if nextValueInput {
+			infoParams.inputFile = a
+			nextValueInput = false
+			continue
+		}
+
+		switch a {
+		case "-i":
+			nextValueInput = true
+		case "-json", "--json":
+			infoParams.asJSON = true
+		case "-h", "-help":
+			return InfoParameters{showHelp: true}, nil
+		default:
+			return infoParams, fmt.Errorf("unknown info flag: %v", a)
+		}
+	}
+
+	if strings.TrimSpace(infoParams.inputFile) == "" {
+		return infoParams, errors.New("input file not properly defined")
+	}
+	return infoParams, nil
+}
+
+func colorModelName(img image.Image) string {
+	switch typed := img.(type) {
+	case *image.YCbCr:
+		return "YCbCr " + strings.TrimPrefix(typed.SubsampleRatio.String(), "YCbCrSubsampleRatio")
+	case *image.Paletted:
+		return fmt.Sprintf("Paletted (%d colors)", len(typed.Palette))
+	}
+
+	switch img.ColorModel() {
+	case color.RGBAModel:
+		return "RGBA"
+	case color.RGBA64Model:
+		return "RGBA64"
+	case color.NRGBAModel:
+		return "NRGBA"
+	case color.NRGBA64Model:
+		return "NRGBA64"
+	case color.GrayModel:
+		return "Gray"
+	case color.Gray16Model:
+		return "Gray16"
+	case color.AlphaModel:
+		return "Alpha"
+	case color.Alpha16Model:
+		return "Alpha16"
+	case color.CMYKModel:
+		return "CMYK"
+	case color.YCbCrModel:
+		return "YCbCr"
+	}
+	return fmt.Sprintf("%T", img)
+}
+
+// CreateImageReport gathers the statistics for the info command in a single
+// pass over the image.
+func CreateImageReport(img image.Image, format string, file string) ImageReport {
+	bounds := img.Bounds()
+	report := ImageReport{
+		File:       file,
+		Format:     format,
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		ColorModel: colorModelName(img),
+	}
+
+	names := []string{"red", "green", "blue", "alpha"}
+	channels := make([]ChannelReport, len(names))
+	sums := make([]float64, len(names))
+	squares := make([]float64, len(names))
+	for index, name := range names {
+		channels[index] = ChannelReport{Name: name, Min: 255}
+	}
+
+	uniqueColors := make(map[color.NRGBA]bool)
+	buckets := make(map[uint16][4]int)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			values := []uint8{pixel.R, pixel.G, pixel.B, pixel.A}
+			for index, value := range values {
+				channels[index].Min = min(channels[index].Min, value)
+				channels[index].Max = max(channels[index].Max, value)
+				channels[index].Histogram[value]++
+				sums[index] += float64(value)
+				squares[index] += float64(value) * float64(value)
+			}
+			uniqueColors[pixel] = true
+
+			// Group similar colors by keeping the top 5 bits of each channel
+			bucket := uint16(pixel.R>>3)<<10 | uint16(pixel.G>>3)<<5 | uint16(pixel.B>>3)
+			totals := buckets[bucket]
+			buckets[bucket] = [4]int{totals[0] + int(pixel.R), totals[1] + int(pixel.G), totals[2] + int(pixel.B), totals[3] + 1}
+		}
+	}
+
+	count := float64(report.Width * report.Height)
+	if count > 0 {
+		for index := range channels {
+			channels[index].Mean = sums[index] / count
+			variance := squares[index]/count - channels[index].Mean*channels[index].Mean
+			channels[index].StdDev = math.Sqrt(max(variance, 0))
+		}
+	} else {
+		for index := range channels {
+			channels[index].Min = 0
+		}
+	}
+
+	report.Channels = channels
+	report.UniqueColors = len(uniqueColors)
+	report.DominantColors = calcDominantColors(buckets, count)
+	return report
+}
+
+func calcDominantColors(buckets map[uint16][4]int, count float64) []DominantColor {
+	keys := make([]uint16, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if buckets[keys[i]][3] != buckets[keys[j]][3] {
+			return buckets[keys[i]][3] > buckets[keys[j]][3]
+		}
+		return keys[i] < keys[j]
+	})
+
+	dominant := []DominantColor{}
+	for _, key := range keys[:min(len(keys), dominantColorCount)] {
+		totals := buckets[key]
+		// Report the average of the real colors in the group
+		hex := fmt.Sprintf("#%02x%02x%02x", totals[0]/totals[3], totals[1]/totals[3], totals[2]/totals[3])
+		dominant = append(dominant, DominantColor{hex, math.Round(float64(totals[3])/count*10000) / 100})
+	}
+	return dominant
+}
+
+// sparkline draws the histogram as one line of block characters, each
+// character covering several histogram values.
+func sparkline(histogram [256]int) string {
+	var bins [sparklineBins]int
+	largest := 0
+	for value, count := range histogram {
+		bins[value*sparklineBins/256] += count
+	}
+	for _, count := range bins {
+		largest = max(largest, count)
+	}
+
+	var builder strings.Builder
+	for _, count := range bins {
+		if largest == 0 {
+			builder.WriteRune(sparklineChars[0])
+			continue
+		}
+		builder.WriteRune(sparklineChars[count*(len(sparklineChars)-1)/largest])
+	}
+	return builder.String()
+}
+
+func writeImageReport(w io.Writer, report ImageReport, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	fmt.Fprintf(w, "File:          %v\n", report.File)
+	fmt.Fprintf(w, "Format:        %v\n", report.Format)
+	fmt.Fprintf(w, "Dimensions:    %vx%v\n", report.Width, report.Height)
+	fmt.Fprintf(w, "Color Model:   %v\n", report.ColorModel)
+	fmt.Fprintf(w, "Unique Colors: %v\n", report.UniqueColors)
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Channel   Min   Max     Mean   StdDev  Histogram")
+	for _, channel := range report.Channels {
+		fmt.Fprintf(w, "%-7v %5d %5d %8.2f %8.2f  %v\n", channel.Name, channel.Min, channel.Max, channel.Mean, channel.StdDev, sparkline(channel.Histogram))
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Dominant Colors:")
+	for _, dominant := range report.DominantColors {
+		fmt.Fprintf(w, "  %v %6.2f%%\n", dominant.Color, dominant.Percent)
+	}
+	_, err := fmt.Fprintln(w, "")
+	return err
+}
+
+func showInfoHelp() {
+	fmt.Println("imagesTx.exe info -i <input file> [--json]")
+	fmt.Println("")
+	fmt.Println("Prints the dimensions, format, color model, channel statistics, histograms,")
+	fmt.Println("unique color count and dominant colors of an image.")
+	fmt.Println("")
+	fmt.Println("  --json  Print the report as JSON")
+	fmt.Println("")
+}
+
+func runInfo(args []string, w io.Writer) error {
+	infoParams, err := parseInfoParameters(args)
+	if err != nil {
+		return &InvalidParameterError{Err: err}
+	}
+
+	if infoParams.showHelp {
+		showInfoHelp()
+		return nil
+	}
+
+	img, format, err := openImage(infoParams.inputFile)
+	if err != nil {
+		return err
+	}
+
+	return writeImageReport(w, CreateImageReport(img, format, infoParams.inputFile), infoParams.asJSON)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseInfoParameters(t *testing.T) {
+	infoParams, err := parseInfoParameters([]string{"-i", "in.png", "--json"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if infoParams.inputFile != "in.png" || !infoParams.asJSON {
+		t.Errorf("unexpected parameters: %+v", infoParams)
+	}
+
+	if _, err := parseInfoParameters([]string{"--json"}); err == nil {
+		t.Error("expected error for missing input file")
+	}
+	if _, err := parseInfoParameters([]string{"-i", "in.png", "-x"}); err == nil {
+		t.Error("expected error for unknown flag")
+	}
+}
+
+func TestCreateImageReport(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	img.Set(3, 1, color.RGBA{0, 0, 255, 255})
+
+	report := CreateImageReport(img, "png", "test.png")
+
+	if report.Width != 4 || report.Height != 2 || report.Format != "png" || report.ColorModel != "RGBA" {
+		t.Errorf("unexpected header: %+v", report)
+	}
+	if report.UniqueColors != 2 {
+		t.Errorf("expected 2 unique colors, got %v", report.UniqueColors)
+	}
+
+	red := report.Channels[0]
+	if red.Min != 0 || red.Max != 255 || red.Histogram[255] != 7 || red.Histogram[0] != 1 {
+		t.Errorf("unexpected red channel: %+v", red)
+	}
+	if math.Abs(red.Mean-223.125) > 1e-9 {
+		t.Errorf("expected red mean 223.125, got %v", red.Mean)
+	}
+	if math.Abs(red.StdDev-math.Sqrt(7)*255/8) > 1e-9 {
+		t.Errorf("unexpected red stddev %v", red.StdDev)
+	}
+
+	if len(report.DominantColors) != 2 || report.DominantColors[0].Color != "#ff0000" || report.DominantColors[0].Percent != 87.5 {
+		t.Errorf("unexpected dominant colors: %+v", report.DominantColors)
+	}
+}
+
+func TestWriteImageReport(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 2))
+	report := CreateImageReport(img, "png", "gray.png")
+
+	var text bytes.Buffer
+	if err := writeImageReport(&text, report, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(text.String(), "Dimensions:    2x2") || !strings.Contains(text.String(), "Gray") {
+		t.Errorf("unexpected text report:\n%v", text.String())
+	}
+
+	var encoded bytes.Buffer
+	if err := writeImageReport(&encoded, report, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if decoded["uniqueColors"].(float64) != 1 {
+		t.Errorf("unexpected json report: %v", decoded)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	var histogram [256]int
+	histogram[0] = 10
+	histogram[255] = 5
+
+	line := []rune(sparkline(histogram))
+	if len(line) != sparklineBins {
+		t.Fatalf("expected %v characters, got %v", sparklineBins, len(line))
+	}
+	if line[0] != '█' || line[1] != '▁' || line[sparklineBins-1] != '▄' {
+		t.Errorf("unexpected sparkline %v", string(line))
+	}
+}
@@ -1,19 +1,85 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"image/color"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 func showHelp() {
 	fmt.Println("imagesTx.exe -i <input file> -o <output file> [transformation flags]")
+	fmt.Println("imagesTx.exe info -i <input file> [--json]")
+	fmt.Println("imagesTx.exe compare -a <first image> -b <second image> [compare flags]")
+	fmt.Println("imagesTx.exe hash -i <input file> [-algo ahash|dhash|phash|all]")
+	fmt.Println("imagesTx.exe dedupe -dir <directory> [-algo ahash|dhash|phash] [-distance <bits>]")
+	fmt.Println("imagesTx.exe serve [-addr <host:port>] [-max-upload <MB>] [-max-pixels <count>]")
+	fmt.Println("imagesTx.exe preview -i <input file> [transformation flags]")
+	fmt.Println("")
+	fmt.Println("Use - as the input or output file to read from stdin or write to stdout.")
+	fmt.Println("")
+	fmt.Println("Output Flags:")
+	fmt.Println("  --format <format>        jpeg, png, gif, bmp, tiff, pbm, pgm, ppm, pam, qoi or ico (default: the")
+	fmt.Println("                           output file extension, JPEG for unknown ones, the input format for stdout)")
+	fmt.Println("  -page <n>                Read page n of a multi-page TIFF (default 1)")
+	fmt.Println("  Inputs may also be WebP, which is read but not written.")
+	fmt.Println("  An .ico output is a favicon holding the result at 16, 32, 48, 64, 128 and 256 pixels,")
+	fmt.Println("  fitted into squares. An .ico input reads its largest image.")
+	fmt.Println("")
+	fmt.Println("Animation Flags:")
+	fmt.Println("  A GIF input written as a GIF (a .gif output file or --format gif) keeps all of its frames.")
+	fmt.Println("  Every frame is transformed, the delays and loop count are kept.")
+	fmt.Println("  -gif-palette <mode>      frame (default) picks the colors of every frame, global shares one palette")
+	fmt.Println("  -gif-dither              Dither the colors with Floyd-Steinberg")
+	fmt.Println("")
+	fmt.Println("Walkthrough Flags:")
+	fmt.Println("  -walkthrough <file>          Also write an animation of the image after every step, a GIF for")
+	fmt.Println("                               a .gif file and an animated PNG for .png or .apng")
+	fmt.Printf("  -walkthrough-delay <ms>      How long every step is shown (default %v)\n", defaultWalkthroughDelay)
+	fmt.Println("  -walkthrough-fade <frames>   Crossfade between steps with this many frames (default 0)")
+	fmt.Println("  -walkthrough-labels          Name the step in the top left corner")
+	fmt.Println("")
+	fmt.Println("Text Art Flags:")
+	fmt.Println("  An output file ending in .txt or .ans is written as text art, .ans always with ANSI colors.")
+	fmt.Printf("  -art-ramp <characters>   Characters from the darkest to the brightest pixels (default \"%v\")\n", defaultArtRamp)
+	fmt.Println("  -art-braille             Use braille patterns, 2x4 dots per character, instead of the ramp")
+	fmt.Println("  -art-color               Color every character with 24-bit ANSI colors")
+	fmt.Printf("  -art-width <columns>     Width of the text (default %v)\n", defaultArtColumns)
+	fmt.Println("")
+	fmt.Println("SVG Output:")
+	fmt.Println("  An output file ending in .svg is written as flat color rectangles, merging runs of the")
+	fmt.Println("  same color. Best after -p10 or -p20, the blocks stay sharp at any size.")
+	fmt.Println("")
+	fmt.Println("Preview Flags:")
+	fmt.Println("  --preview                Also show the result in the terminal (on stderr when writing to stdout)")
+	fmt.Println("  -preview-mode <mode>     auto (default), ansi, sixel or kitty")
+	fmt.Printf("  -preview-width <columns> Width of the preview (default $COLUMNS or %v)\n", defaultPreviewColumns)
+	fmt.Println("")
+	fmt.Println("Watch Flags:")
+	fmt.Println("  --watch                  Keep running and reprocess the input whenever it changes.  The input")
+	fmt.Println("                           can be a directory, the output is then a directory of results.")
+	fmt.Printf("  -watch-interval <ms>     How often to check for changes (default %v)\n", defaultWatchInterval.Milliseconds())
 	fmt.Println("")
 	fmt.Println("Transformation Flags:")
+	fmt.Println("  -ac    Auto-contrast: stretch the luminance range, keeping the color balance")
+	fmt.Println("  -al    Auto-levels: stretch each color channel separately (see -al-clip)")
+	fmt.Println("  -clahe Contrast limited adaptive histogram equalization (see -clahe-grid and -clahe-clip)")
+	fmt.Println("  -d3    Downsample the image to one pixel per 3x3 block")
+	fmt.Println("  -d10   Downsample the image to one pixel per 10x10 block")
+	fmt.Println("  -d20   Downsample the image to one pixel per 20x20 block")
+	fmt.Println("  -d50   Downsample the image to one pixel per 50x50 block")
+	fmt.Println("  -dot10 Mosaic of 10 pixel circular dots on a black background")
+	fmt.Println("  -dot20 Mosaic of 20 pixel circular dots on a black background")
+	fmt.Println("  -eq    Equalize the luminance histogram of the whole image")
 	fmt.Println("  -g     Convert image to grayscale")
 	fmt.Println("  -gb    Convert image to grayscale, maintain blue value")
 	fmt.Println("  -gg    Convert image to grayscale, maintain green value")
 	fmt.Println("  -gr    Convert image to grayscale, maintain red value")
+	fmt.Println("  -hex10 Mosaic of hexagons with a 10 pixel radius")
+	fmt.Println("  -hex20 Mosaic of hexagons with a 20 pixel radius")
 	fmt.Println("  -l     Shift Left (Red -> Blue, Green -> Red, Blue -> Green)")
 	fmt.Println("  -p3    Pixelate the image in 3x3 blocks")
 	fmt.Println("  -p10   Pixelate the image in 10x10 blocks")
@@ -23,43 +89,244 @@ func showHelp() {
 	fmt.Println("  -sgb   Swap green and blue values")
 	fmt.Println("  -srb   Swap red and blue values")
 	fmt.Println("  -srg   Swap red and green values")
+	fmt.Println("  -temp <kelvin>  Tint with the color of a light source (6500 is neutral, lower is warmer)")
+	fmt.Println("  -tint <value>   Shift between green (-100) and magenta (100)")
+	fmt.Println("  -tri10 Mosaic of triangles with 10 pixel sides")
+	fmt.Println("  -tri20 Mosaic of triangles with 20 pixel sides")
+	fmt.Println("  -u2    Upscale the image 2x using nearest neighbor")
+	fmt.Println("  -u3    Upscale the image 3x using nearest neighbor")
+	fmt.Println("  -u4    Upscale the image 4x using nearest neighbor")
+	fmt.Println("  -u10   Upscale the image 10x using nearest neighbor")
+	fmt.Println("  -vor100 Mosaic of 100 Voronoi cells")
+	fmt.Println("  -vor500 Mosaic of 500 Voronoi cells")
+	fmt.Println("  -wbg   White balance assuming the average color is gray (gray world)")
+	fmt.Println("  -wbw   White balance assuming the brightest color is white (white patch)")
 	fmt.Println("")
 	fmt.Println("Multiple transformation flags can be combined.  They are processed in the order they are listed.")
 	fmt.Println("")
+	fmt.Println("Histogram Flags:")
+	fmt.Printf("  -clahe-grid <tiles>  Number of CLAHE tiles across and down the image (default %v, at most %v)\n", defaultClaheGrid, maxClaheGrid)
+	fmt.Println("  -clahe-clip <limit>  CLAHE clip limit as a multiple of the average histogram bin (default 2)")
+	fmt.Println("  -al-clip <percent>   Percentage of the darkest and brightest values auto-levels ignores (default 0.5)")
+	fmt.Println("")
+	fmt.Println("Mask Flags:")
+	fmt.Println("  -m rect:x,y,w,h           Only transform inside a rectangle")
+	fmt.Println("  -m ellipse:cx,cy,rx,ry    Only transform inside an ellipse")
+	fmt.Println("  -m poly:x1,y1,x2,y2,...   Only transform inside a polygon")
+	fmt.Println("  -m image:mask.png         Use a grayscale image as the mask (white is transformed)")
+	fmt.Printf("  -feather <pixels>         Blend the mask edges over the given number of pixels (at most %v)\n", maxFeather)
+	fmt.Println("")
+	fmt.Println("Multiple masks can be combined.  Every transformation is limited to the masked area.")
+	fmt.Println("Masks cannot be combined with the downsample and upscale transformations.")
+	fmt.Println("")
+	fmt.Println("Compositing Flags:")
+	fmt.Println("  -blend <mode>       Blend the result over the original: normal, multiply, screen, overlay,")
+	fmt.Println("                      softlight, hardlight, difference, dodge, burn, hue, saturation, color, luminosity")
+	fmt.Println("  -opacity <percent>  Opacity of the result when compositing (default 100)")
+	fmt.Println("  -op <operator>      Porter-Duff operator: over (default), clear, src, dst, dst-over, in, dst-in,")
+	fmt.Println("                      out, dst-out, atop, dst-atop, xor")
+	fmt.Println("  -bg <file>          Composite over another image of the same size instead of the original")
+	fmt.Println("")
+	fmt.Println("Compositing cannot be combined with the downsample and upscale transformations.")
+	fmt.Println("")
+	fmt.Println("Overlay Flags:")
+	fmt.Println("  -overlay <file>              Stamp an image (e.g. a PNG logo with alpha) onto the result")
+	fmt.Println("  -overlay-gravity <position>  Anchor the overlay: nw, n, ne, w, c, e, sw, s, se (default se)")
+	fmt.Println("  -overlay-offset <x,y>        Move the overlay away from its anchored edges")
+	fmt.Printf("  -overlay-scale <percent>     Scale the overlay to a percentage of the image width (at most %v)\n", maxOverlayScale)
+	fmt.Println("  -overlay-opacity <percent>   Opacity of the overlay (default 100)")
+	fmt.Println("  -overlay-tile                Repeat the overlay across the whole image")
+	fmt.Println("")
+	fmt.Println("The overlay is applied at the position of -overlay in the list of transformations.")
+	fmt.Println("")
+	fmt.Println("Text Flags:")
+	fmt.Println("  -text <text>                Draw text; {filename}, {width}, {height}, {date}, {time} and \\n are replaced")
+	fmt.Println("  -text-font <file>           TrueType or OpenType font (default is an embedded bitmap font)")
+	fmt.Printf("  -text-size <points>         Font size (default %v, at most %v)\n", defaultTextSize, maxTextSize)
+	fmt.Println("  -text-color <RRGGBB[AA]>    Text color (default ffffff)")
+	fmt.Println("  -text-outline <RRGGBB[AA]>  Draw an outline in this color")
+	fmt.Printf("  -text-outline-width <px>    Outline width (default 1, at most %v)\n", maxTextOutlineWidth)
+	fmt.Println("  -text-shadow <RRGGBB[AA]>   Draw a drop shadow in this color")
+	fmt.Println("  -text-shadow-offset <x,y>   Shadow offset (default 2,2)")
+	fmt.Println("  -text-align <alignment>     left (default), center or right")
+	fmt.Println("  -text-gravity <position>    Anchor the text: nw, n, ne, w, c, e, sw, s, se (default sw)")
+	fmt.Println("  -text-offset <x,y>          Move the text away from its anchored edges (default 10,10)")
+	fmt.Println("  -text-wrap <px>             Wrap lines at this width (default fits the image)")
+	fmt.Println("")
 	fmt.Println("Examples:")
 	fmt.Println("  imagesTx.exe -i start.jpg -o result.jpg -gg -l")
+	fmt.Println("  imagesTx.exe -i start.png -o sprite.png -d10 -u4")
+	fmt.Println("  imagesTx.exe -i start.jpg -o result.jpg -m ellipse:120,80,40,50 -feather 8 -p10")
+	fmt.Println("  imagesTx.exe -i start.jpg -o result.jpg -gg -opacity 50")
+	fmt.Println("  imagesTx.exe -i start.jpg -o result.jpg -overlay logo.png -overlay-scale 20 -overlay-offset 10,10")
+	fmt.Println("  imagesTx.exe -i start.jpg -o result.jpg -text \"{filename} {date}\" -text-shadow 000000")
+	fmt.Println("  imagesTx.exe -i start.jpg -o result.txt -art-width 60 -art-ramp \" .:░▒▓█\"")
+	fmt.Println("  imagesTx.exe -i start.jpg -o result.jpg -gg -p10 -l -walkthrough steps.gif -walkthrough-fade 8 -walkthrough-labels")
+	fmt.Println("  imagesTx.exe -i scan.tiff -page 2 -o page2.qoi -gg")
+	fmt.Println("  imagesTx.exe -i logo.png -o favicon.ico")
+	fmt.Println("  imagesTx.exe -i sprite.png -o sprite.svg -p10")
+	fmt.Println("  imagesTx.exe -i photos -o graded -temp 3200 -ac --watch")
+	fmt.Println("  cat start.png | imagesTx.exe -i - -o - -p10 --format png > result.png")
 	fmt.Println("")
+	fmt.Println("Exit Codes:")
+	fmt.Printf("  %v  Success\n", exitOK)
+	fmt.Printf("  %v  A transformation failed\n", exitFailure)
+	fmt.Printf("  %v  compare: a threshold was exceeded\n", exitThresholdExceeded)
+	fmt.Printf("  %v  Invalid parameter\n", exitInvalidParameter)
+	fmt.Printf("  %v  Unknown transformation\n", exitUnknownTransform)
+	fmt.Printf("  %v  A file could not be opened, read or written\n", exitIO)
+	fmt.Printf("  %v  A file is not a supported image or font\n", exitDecode)
+	fmt.Printf("  %v  The result could not be encoded\n", exitEncode)
 	fmt.Println("")
 }
 
 func main() {
-	params, err := parseParameters(os.Args[1:])
+	// Keep stdout free for images written with -o -
+	log.SetOutput(os.Stderr)
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command in the arguments and returns the exit code.
+func run(args []string) int {
+	var err error
+
+	switch {
+	case len(args) > 0 && args[0] == "info":
+		err = runInfo(args[1:], os.Stdout)
+	case len(args) > 0 && args[0] == "compare":
+		var failures []string
+		failures, err = runCompare(args[1:], os.Stdout)
+		for _, failure := range failures {
+			fmt.Fprintf(os.Stderr, "Threshold exceeded: %v\n", failure)
+		}
+		if err == nil && len(failures) > 0 {
+			return exitThresholdExceeded
+		}
+	case len(args) > 0 && args[0] == "hash":
+		err = runHash(args[1:], os.Stdout)
+	case len(args) > 0 && args[0] == "dedupe":
+		err = runDedupe(args[1:], os.Stdout)
+	case len(args) > 0 && args[0] == "serve":
+		err = runServe(args[1:])
+	case len(args) > 0 && args[0] == "preview":
+		err = runPreview(args[1:])
+	default:
+		err = runTransformations(args)
+	}
+
 	if err != nil {
-		log.Fatalf("Error parsing parameters: %v", err)
+		log.Printf("Error: %v", err)
+		return exitCodeForError(err)
+	}
+	return exitOK
+}
+
+func runTransformations(args []string) error {
+	params, err := parseParameters(args)
+	if err != nil {
+		return err
 	}
 
 	if params.showHelp {
 		showHelp()
-		return
+		return nil
+	}
+
+	if params.watch {
+		return runWatch(params, os.Stderr)
 	}
 
-	img, err := openJpeg(params.inputFile)
+	return processImageFile(params, params.inputFile, params.outputFile)
+}
+
+// processImageFile runs the transformations of the parameters on one input
+// file and writes the result.  An empty output file only shows the preview.
+func processImageFile(params Transformation, inputFile string, outputFile string) error {
+	data, err := readImageData(inputFile)
 	if err != nil {
-		log.Fatal("Cannot open file: Aborting")
+		return err
+	}
+
+	if params.page > 1 {
+		data, err = TIFFPageData(data, params.page)
+		if err != nil {
+			return &DecodeError{Path: imageSourceName(inputFile), Err: err}
+		}
 	}
 
-	pixels, err := CreatePixelArrayFromImage(img)
+	img, inputFormat, err := decodeImage(bytes.NewReader(data), imageSourceName(inputFile))
 	if err != nil {
-		log.Fatal("Cannot generate array: Aborting")
+		return err
 	}
 
-	pixels, err = ProcessListOfTransformations(pixels, params.transformList)
+	if params.walkthrough.file != "" {
+		if err := writeWalkthrough(img, params); err != nil {
+			return err
+		}
+	}
+
+	if inputFormat == "gif" && outputFile != "" && outputImageFormat(params, outputFile, inputFormat) == "gif" {
+		return processAnimation(params, data, inputFile, outputFile)
+	}
+
+	pixels, err := transformImage(img, params)
 	if err != nil {
-		log.Fatalf("Cannot Transform Images: %v", err)
+		return err
+	}
+
+	if outputFile != "" {
+		if err := writeResult(params, pixels, inputFormat, outputFile); err != nil {
+			return err
+		}
+	}
+
+	if params.preview.enabled {
+		return writePreview(previewWriter(outputFile), pixels, params.preview, os.Getenv)
+	}
+	return nil
+}
+
+// outputImageFormat is the format of the result: --format, the input format
+// on stdout, the format named by the file extension, and JPEG for any other
+// file.  Formats that can only be read are written as PNG on stdout.
+func outputImageFormat(params Transformation, outputFile string, inputFormat string) string {
+	if params.outputFormat != "" {
+		return params.outputFormat
+	}
+	if outputFile == streamPath {
+		if decodeOnlyFormats[inputFormat] {
+			return "png"
+		}
+		return inputFormat
+	}
+	if format, ok := imageFormatNames[strings.ToLower(strings.TrimPrefix(filepath.Ext(outputFile), "."))]; ok {
+		return format
+	}
+	return "jpeg"
+}
+
+func writeResult(params Transformation, pixels [][]color.Color, inputFormat string, outputFile string) error {
+	if outputFile == streamPath {
+		return encodeImage(stdout, pixels, outputImageFormat(params, outputFile, inputFormat), "stdout")
+	}
+
+	if isTextArtFile(outputFile) {
+		return writeTextArtFile(pixels, outputFile, params.textArt)
+	}
+
+	if isSVGFile(outputFile) {
+		return writeSVGFile(pixels, outputFile)
+	}
+
+	format := outputImageFormat(params, outputFile, inputFormat)
+	if format == "jpeg" && params.outputFormat == "" {
+		return writeJpeg(pixels, outputFile)
 	}
 
-	err = writeJpeg(pixels, params.outputFile)
+	file, err := os.Create(outputFile)
 	if err != nil {
-		log.Fatal("Cannot write file: Aborting")
+		return &IOError{Path: outputFile, Err: err}
 	}
+	defer file.Close()
+	return encodeImage(file, pixels, format, outputFile)
 }
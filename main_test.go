@@ -1,7 +1,110 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+)
 
 func TestShowHelp(t *testing.T) {
 	showHelp() // No results to test, just make sure it doesn't blow up
 }
+
+func TestRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := tmpDir + "/input.png"
+	if err := writePng(createGray2DArray(), input); err != nil {
+		t.Fatalf("could not write input: %v", err)
+	}
+	black := tmpDir + "/black.png"
+	if err := writePng(create2DArraySingleColor(testBlack), black); err != nil {
+		t.Fatalf("could not write input: %v", err)
+	}
+
+	var tests = []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{"Success", []string{"-i", input, "-o", tmpDir + "/result.jpg", "-g"}, exitOK},
+		{"Help", []string{"-h"}, exitOK},
+		{"MissingOutput", []string{"-i", input}, exitInvalidParameter},
+		{"UnknownFlag", []string{"-i", input, "-o", tmpDir + "/result.jpg", "-sparkle"}, exitUnknownTransform},
+		{"MissingInput", []string{"-i", tmpDir + "/missing.png", "-o", tmpDir + "/result.jpg"}, exitIO},
+		{"NotAnImage", []string{"-i", "go.mod", "-o", tmpDir + "/result.jpg"}, exitDecode},
+		{"MissingOverlay", []string{"-i", input, "-o", tmpDir + "/result.jpg", "-overlay", tmpDir + "/missing.png"}, exitIO},
+		{"UnwritableOutput", []string{"-i", input, "-o", tmpDir + "/missing/result.jpg"}, exitIO},
+		{"InfoBadFlag", []string{"info", "-x"}, exitInvalidParameter},
+		{"CompareThreshold", []string{"compare", "-a", input, "-b", black, "-max-diff-pixels", "0"}, exitThresholdExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := run(tt.args); code != tt.expected {
+				t.Errorf("Test %s exited with %v, want %v", tt.name, code, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunStreams(t *testing.T) {
+	var input bytes.Buffer
+	if err := encodeImage(&input, createGray2DArray(), "png", "input"); err != nil {
+		t.Fatalf("could not encode input: %v", err)
+	}
+
+	var output bytes.Buffer
+	stdin, stdout = &input, &output
+	defer func() { stdin, stdout = os.Stdin, os.Stdout }()
+
+	if code := run([]string{"-i", "-", "-o", "-", "-u2"}); code != exitOK {
+		t.Fatalf("run exited with %v", code)
+	}
+
+	// Without --format the input format is kept
+	img, err := png.Decode(&output)
+	if err != nil {
+		t.Fatalf("stdout is not a png: %v", err)
+	}
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 20 {
+		t.Errorf("unexpected size %v", img.Bounds())
+	}
+}
+
+func TestRunPreview(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := tmpDir + "/input.png"
+	if err := writePng(createGray2DArray(), input); err != nil {
+		t.Fatalf("could not write input: %v", err)
+	}
+
+	var output bytes.Buffer
+	var errOutput bytes.Buffer
+	stdout, stderr = &output, &errOutput
+	defer func() { stdout, stderr = os.Stdout, os.Stderr }()
+
+	if code := run([]string{"preview", "-i", input, "-g", "-preview-mode", "ansi"}); code != exitOK {
+		t.Fatalf("run exited with %v", code)
+	}
+	// 10x10 pixels are 5 lines of 10 half blocks
+	if lines := strings.Count(output.String(), "\n"); lines != 5 {
+		t.Errorf("expected 5 lines, got %v", lines)
+	}
+	if blocks := strings.Count(output.String(), "▀"); blocks != 50 {
+		t.Errorf("expected 50 half blocks, got %v", blocks)
+	}
+
+	// Writing the image to stdout moves the preview to stderr
+	output.Reset()
+	if code := run([]string{"-i", input, "-o", "-", "--preview", "-preview-mode", "ansi", "--format", "png"}); code != exitOK {
+		t.Fatalf("run exited with %v", code)
+	}
+	if _, err := png.Decode(&output); err != nil {
+		t.Errorf("stdout is not a png: %v", err)
+	}
+	if !strings.Contains(errOutput.String(), "▀") {
+		t.Errorf("expected the preview on stderr")
+	}
+}
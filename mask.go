@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Mask holds a weight between 0 and 1 for every pixel, indexed [x][y] like
+// the pixel arrays.  A weight of 1 takes the transformed pixel, 0 keeps the
+// original.
+type Mask [][]float64
+
+type MaskShapeType int64
+
+const (
+	MaskUndefined MaskShapeType = iota
+	MaskRectangle
+	MaskEllipse
+	MaskPolygon
+	MaskImage
+)
+
+// Largest feather accepted, blurring costs the feather for every pixel.
+const maxFeather = 100
+
+type MaskSpec struct {
+	shape  MaskShapeType
+	values []float64
+	path   string
+}
+
+// parseMaskSpec reads a mask definition from the command line:
+//
+//	rect:x,y,width,height
+//	ellipse:centerX,centerY,radiusX,radiusY
+//	poly:x1,y1,x2,y2,x3,y3[,...]
+//	image:path/to/mask.png
+func parseMaskSpec(spec string) (MaskSpec, error) {
+	var maskSpec MaskSpec
+
+	kind, args, found := strings.Cut(spec, ":")
+	if !found || strings.TrimSpace(args) == "" {
+		return maskSpec, fmt.Errorf("invalid mask definition: %v", spec)
+	}
+
+	if kind == "image" {
+		maskSpec.shape = MaskImage
+		maskSpec.path = args
+		return maskSpec, nil
+	}
+
+	for _, field := range strings.Split(args, ",") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return maskSpec, fmt.Errorf("invalid mask value %v in %v", field, spec)
+		}
+		maskSpec.values = append(maskSpec.values, value)
+	}
+
+	switch kind {
+	case "rect":
+		maskSpec.shape = MaskRectangle
+		if len(maskSpec.values) != 4 {
+			return maskSpec, errors.New("rect mask needs x,y,width,height")
+		}
+	case "ellipse":
+		maskSpec.shape = MaskEllipse
+		if len(maskSpec.values) != 4 {
+			return maskSpec, errors.New("ellipse mask needs centerX,centerY,radiusX,radiusY")
+		}
+	case "poly":
+		maskSpec.shape = MaskPolygon
+		if len(maskSpec.values) < 6 || len(maskSpec.values)%2 != 0 {
+			return maskSpec, errors.New("poly mask needs at least three x,y points")
+		}
+	default:
+		return maskSpec, fmt.Errorf("unknown mask shape: %v", kind)
+	}
+
+	return maskSpec, nil
+}
+
+// BuildMask combines every mask definition into a single mask of the given
+// size and softens its edges over feather pixels.  Overlapping shapes keep
+// the strongest weight.
+func BuildMask(specs []MaskSpec, width int, height int, feather int) (Mask, error) {
+	mask := newMask(width, height)
+
+	for _, spec := range specs {
+		shapeMask, err := buildShapeMask(spec, width, height)
+		if err != nil {
+			return nil, err
+		}
+		for xIndex := 0; xIndex < width; xIndex++ {
+			for yIndex := 0; yIndex < height; yIndex++ {
+				mask[xIndex][yIndex] = max(mask[xIndex][yIndex], shapeMask[xIndex][yIndex])
+			}
+		}
+	}
+
+	if feather > 0 {
+		// Two box blur passes give a smooth ramp without a full gaussian
+		mask = blurMask(blurMask(mask, feather/2+1), feather/2+1)
+	}
+
+	return mask, nil
+}
+
+func newMask(width int, height int) Mask {
+	mask := make(Mask, width)
+	for xIndex := range mask {
+		mask[xIndex] = make([]float64, height)
+	}
+	return mask
+}
+
+func buildShapeMask(spec MaskSpec, width int, height int) (Mask, error) {
+	if spec.shape == MaskImage {
+		return loadMaskImage(spec.path, width, height)
+	}
+
+	mask := newMask(width, height)
+	for xIndex := 0; xIndex < width; xIndex++ {
+		for yIndex := 0; yIndex < height; yIndex++ {
+			// Test the pixel center so shapes line up with pixel edges
+			px := float64(xIndex) + 0.5
+			py := float64(yIndex) + 0.5
+			inside := false
+			switch spec.shape {
+			case MaskRectangle:
+				inside = px >= spec.values[0] && px < spec.values[0]+spec.values[2] &&
+					py >= spec.values[1] && py < spec.values[1]+spec.values[3]
+			case MaskEllipse:
+				if spec.values[2] > 0 && spec.values[3] > 0 {
+					dx := (px - spec.values[0]) / spec.values[2]
+					dy := (py - spec.values[1]) / spec.values[3]
+					inside = dx*dx+dy*dy <= 1
+				}
+			case MaskPolygon:
+				inside = pointInPolygon(px, py, spec.values)
+			default:
+				return nil, errors.New("unknown mask shape")
+			}
+			if inside {
+				mask[xIndex][yIndex] = 1
+			}
+		}
+	}
+	return mask, nil
+}
+
+// pointInPolygon uses the even-odd rule on a flat list of x,y points.
+func pointInPolygon(px float64, py float64, points []float64) bool {
+	inside := false
+	count := len(points) / 2
+	for current, previous := 0, count-1; current < count; previous, current = current, current+1 {
+		x1, y1 := points[current*2], points[current*2+1]
+		x2, y2 := points[previous*2], points[previous*2+1]
+		if (y1 > py) != (y2 > py) && px < (x2-x1)*(py-y1)/(y2-y1)+x1 {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// loadMaskImage reads a grayscale image and stretches it to the target size
+// with nearest neighbor sampling.  White is fully transformed, black is
+// untouched.
+func loadMaskImage(path string, width int, height int) (Mask, error) {
+	img, err := openJpeg(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, fmt.Errorf("mask image is empty: %v", path)
+	}
+
+	mask := newMask(width, height)
+	for xIndex := 0; xIndex < width; xIndex++ {
+		srcX := bounds.Min.X + xIndex*bounds.Dx()/width
+		for yIndex := 0; yIndex < height; yIndex++ {
+			srcY := bounds.Min.Y + yIndex*bounds.Dy()/height
+			gray := color.Gray16Model.Convert(img.At(srcX, srcY)).(color.Gray16)
+			mask[xIndex][yIndex] = float64(gray.Y) / math.MaxUint16
+		}
+	}
+	return mask, nil
+}
+
+// blurMask applies a separable box blur of the given radius.
+func blurMask(mask Mask, radius int) Mask {
+	width := len(mask)
+	if width == 0 {
+		return mask
+	}
+	height := len(mask[0])
+
+	horizontal := newMask(width, height)
+	for yIndex := 0; yIndex < height; yIndex++ {
+		for xIndex := 0; xIndex < width; xIndex++ {
+			total := 0.0
+			count := 0
+			for offset := -radius; offset <= radius; offset++ {
+				if xIndex+offset >= 0 && xIndex+offset < width {
+					total += mask[xIndex+offset][yIndex]
+					count++
+				}
+			}
+			horizontal[xIndex][yIndex] = total / float64(count)
+		}
+	}
+
+	blurred := newMask(width, height)
+	for xIndex := 0; xIndex < width; xIndex++ {
+		for yIndex := 0; yIndex < height; yIndex++ {
+			total := 0.0
+			count := 0
+			for offset := -radius; offset <= radius; offset++ {
+				if yIndex+offset >= 0 && yIndex+offset < height {
+					total += horizontal[xIndex][yIndex+offset]
+					count++
+				}
+			}
+			blurred[xIndex][yIndex] = total / float64(count)
+		}
+	}
+	return blurred
+}
+
+// ApplyMask blends the transformed pixels over the originals using the mask
+// weights.  Both pixel arrays and the mask must be the same size.
+func ApplyMask(originalPixels [][]color.Color, transformedPixels [][]color.Color, mask Mask) ([][]color.Color, error) {
+	if len(originalPixels) != len(transformedPixels) || len(originalPixels) != len(mask) {
+		return nil, errors.New("masked transforms must keep the image size")
+	}
+
+	var newPixels [][]color.Color
+	for xIndex := 0; xIndex < len(originalPixels); xIndex++ {
+		if len(originalPixels[xIndex]) != len(transformedPixels[xIndex]) || len(originalPixels[xIndex]) != len(mask[xIndex]) {
+			return nil, errors.New("masked transforms must keep the image size")
+		}
+		newCol := make([]color.Color, len(originalPixels[xIndex]))
+		for yIndex := range newCol {
+			weight := mask[xIndex][yIndex]
+			switch {
+			case weight <= 0:
+				newCol[yIndex] = originalPixels[xIndex][yIndex]
+			case weight >= 1:
+				newCol[yIndex] = transformedPixels[xIndex][yIndex]
+			default:
+				newCol[yIndex] = mixColors(originalPixels[xIndex][yIndex], transformedPixels[xIndex][yIndex], weight)
+			}
+		}
+		newPixels = append(newPixels, newCol)
+	}
+	return newPixels, nil
+}
+
+func mixColors(original color.Color, transformed color.Color, weight float64) color.Color {
+	from := color.RGBAModel.Convert(original).(color.RGBA)
+	to := color.RGBAModel.Convert(transformed).(color.RGBA)
+	mix := func(a uint8, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-weight) + float64(b)*weight))
+	}
+	return color.RGBA{mix(from.R, to.R), mix(from.G, to.G), mix(from.B, to.B), mix(from.A, to.A)}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+type MaskSpecTest struct {
+	name        string
+	input       string
+	expectShape MaskShapeType
+	expectCount int
+	expectErr   bool
+	errText     string
+}
+
+type BuildMaskTest struct {
+	name         string
+	specs        []MaskSpec
+	expectInside [][2]int
+	expectOutput [][2]int
+}
+
+func countMaskedPixels(mask Mask) int {
+	count := 0
+	for xIndex := range mask {
+		for yIndex := range mask[xIndex] {
+			if mask[xIndex][yIndex] >= 1 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestParseMaskSpec(t *testing.T) {
+	var tests = []MaskSpecTest{
+		{"Rect", "rect:1,2,3,4", MaskRectangle, 4, false, ""},
+		{"Ellipse", "ellipse:5,5,2,3", MaskEllipse, 4, false, ""},
+		{"Polygon", "poly:0,0,10,0,5,5", MaskPolygon, 6, false, ""},
+		{"Image", "image:mask.png", MaskImage, 0, false, ""},
+		{"NoShape", "1,2,3,4", MaskUndefined, 0, true, "invalid mask definition"},
+		{"NoValues", "rect:", MaskUndefined, 0, true, "invalid mask definition"},
+		{"UnknownShape", "star:1,2,3,4", MaskUndefined, 0, true, "unknown mask shape"},
+		{"BadNumber", "rect:1,2,x,4", MaskUndefined, 0, true, "invalid mask value"},
+		{"RectTooShort", "rect:1,2,3", MaskUndefined, 0, true, "rect mask needs"},
+		{"EllipseTooShort", "ellipse:1,2", MaskUndefined, 0, true, "ellipse mask needs"},
+		{"PolygonTooShort", "poly:0,0,1,1", MaskUndefined, 0, true, "poly mask needs"},
+		{"PolygonOddValues", "poly:0,0,1,1,2,2,3", MaskUndefined, 0, true, "poly mask needs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseMaskSpec(tt.input)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			if err != nil && tt.expectErr {
+				if !strings.Contains(err.Error(), tt.errText) {
+					t.Errorf("Test %s returned incorrect error. Want: %s. Got: %v", tt.name, tt.errText, err)
+				}
+			}
+
+			if err == nil && tt.expectErr {
+				t.Errorf("Test %s should have returned an error, but did not", tt.name)
+			}
+
+			if err == nil && !tt.expectErr {
+				if tt.expectShape != result.shape {
+					t.Errorf("Test %s returned invalid shape: Expect: %v. Got: %v", tt.name, tt.expectShape, result.shape)
+				}
+				if tt.expectCount != len(result.values) {
+					t.Errorf("Test %s returned invalid value count: Expect: %v. Got: %v", tt.name, tt.expectCount, len(result.values))
+				}
+			}
+		})
+	}
+}
+
+func TestBuildMask(t *testing.T) {
+	rect := MaskSpec{MaskRectangle, []float64{2, 2, 3, 3}, ""}
+	ellipse := MaskSpec{MaskEllipse, []float64{5, 5, 2, 2}, ""}
+	triangle := MaskSpec{MaskPolygon, []float64{0, 0, 10, 0, 0, 10}, ""}
+
+	var tests = []BuildMaskTest{
+		{"Rect", []MaskSpec{rect}, [][2]int{{2, 2}, {4, 4}}, [][2]int{{1, 1}, {5, 5}}},
+		{"Ellipse", []MaskSpec{ellipse}, [][2]int{{5, 5}, {4, 5}, {5, 6}}, [][2]int{{3, 3}, {7, 7}}},
+		{"Polygon", []MaskSpec{triangle}, [][2]int{{0, 0}, {3, 3}}, [][2]int{{6, 6}, {9, 9}}},
+		{"Union", []MaskSpec{rect, triangle}, [][2]int{{0, 0}, {4, 4}}, [][2]int{{9, 9}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := BuildMask(tt.specs, 10, 10, 0)
+			if err != nil {
+				t.Fatalf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			for _, point := range tt.expectInside {
+				if result[point[0]][point[1]] != 1 {
+					t.Errorf("Test %s returned invalid weight at %v: Expect: 1. Got: %v", tt.name, point, result[point[0]][point[1]])
+				}
+			}
+
+			for _, point := range tt.expectOutput {
+				if result[point[0]][point[1]] != 0 {
+					t.Errorf("Test %s returned invalid weight at %v: Expect: 0. Got: %v", tt.name, point, result[point[0]][point[1]])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildMaskRectangleSize(t *testing.T) {
+	result, err := BuildMask([]MaskSpec{{MaskRectangle, []float64{2, 2, 3, 4}, ""}}, 10, 10, 0)
+	if err != nil {
+		t.Fatalf("BuildMask returned an unexpected error: %v", err)
+	}
+
+	if countMaskedPixels(result) != 12 {
+		t.Errorf("BuildMask returned invalid pixel count: Expect: %v. Got: %v", 12, countMaskedPixels(result))
+	}
+}
+
+func TestBuildMaskFeather(t *testing.T) {
+	result, err := BuildMask([]MaskSpec{{MaskRectangle, []float64{10, 0, 10, 10}, ""}}, 20, 10, 4)
+	if err != nil {
+		t.Fatalf("BuildMask returned an unexpected error: %v", err)
+	}
+
+	if result[0][5] != 0 {
+		t.Errorf("BuildMask feathered too far: Expect: 0. Got: %v", result[0][5])
+	}
+
+	if result[19][5] != 1 {
+		t.Errorf("BuildMask feathered too far: Expect: 1. Got: %v", result[19][5])
+	}
+
+	edge := result[10][5]
+	if edge <= 0 || edge >= 1 {
+		t.Errorf("BuildMask did not feather the edge: Got: %v", edge)
+	}
+
+	if result[9][5] >= edge || result[11][5] <= edge {
+		t.Errorf("BuildMask feather is not a ramp: %v %v %v", result[9][5], edge, result[11][5])
+	}
+}
+
+func TestBuildMaskImage(t *testing.T) {
+	tmpDir := t.TempDir()
+	maskFile := fmt.Sprintf("%v/%v", tmpDir, "mask.png")
+
+	var maskPixels [][]color.Color
+	for xIndex := 0; xIndex < 4; xIndex++ {
+		var maskCol []color.Color
+		for yIndex := 0; yIndex < 4; yIndex++ {
+			if xIndex < 2 {
+				maskCol = append(maskCol, testWhite.color)
+			} else {
+				maskCol = append(maskCol, testBlack.color)
+			}
+		}
+		maskPixels = append(maskPixels, maskCol)
+	}
+	if err := writePng(maskPixels, maskFile); err != nil {
+		t.Fatalf("could not write mask image: %v", err)
+	}
+
+	result, err := BuildMask([]MaskSpec{{MaskImage, nil, maskFile}}, 8, 8, 0)
+	if err != nil {
+		t.Fatalf("BuildMask returned an unexpected error: %v", err)
+	}
+
+	if result[0][0] != 1 || result[3][7] != 1 {
+		t.Errorf("BuildMask returned invalid weight for white mask pixels: %v %v", result[0][0], result[3][7])
+	}
+
+	if result[4][0] != 0 || result[7][7] != 0 {
+		t.Errorf("BuildMask returned invalid weight for black mask pixels: %v %v", result[4][0], result[7][7])
+	}
+
+	_, err = BuildMask([]MaskSpec{{MaskImage, nil, tmpDir + "/missing.png"}}, 8, 8, 0)
+	if err == nil {
+		t.Errorf("BuildMask should have returned an error for a missing mask image")
+	}
+}
+
+func TestApplyMask(t *testing.T) {
+	original := [][]color.Color{{testBlack.color, testBlack.color, testBlack.color}}
+	transformed := [][]color.Color{{testWhite.color, testWhite.color, testWhite.color}}
+	mask := Mask{{0, 0.5, 1}}
+
+	result, err := ApplyMask(original, transformed, mask)
+	if err != nil {
+		t.Fatalf("ApplyMask returned an unexpected error: %v", err)
+	}
+
+	expected := []color.Color{testBlack.color, color.RGBA{128, 128, 128, 255}, testWhite.color}
+	for yIndex := range expected {
+		if expected[yIndex] != result[0][yIndex] {
+			t.Errorf("ApplyMask returned invalid pixel result: Expect: %v. Got: %v", expected[yIndex], result[0][yIndex])
+		}
+	}
+
+	_, err = ApplyMask(original, [][]color.Color{{testWhite.color}}, mask)
+	if err == nil || !strings.Contains(err.Error(), "must keep the image size") {
+		t.Errorf("ApplyMask should have returned a size error. Got: %v", err)
+	}
+}
+
+func TestTransformImageWithMask(t *testing.T) {
+	original := create2DArraySingleColor(testRed)
+	mask, err := BuildMask([]MaskSpec{{MaskRectangle, []float64{0, 0, 5, 10}, ""}}, 10, 10, 0)
+	if err != nil {
+		t.Fatalf("BuildMask returned an unexpected error: %v", err)
+	}
+
+	result, err := TransformImageWithMask(SwapRandGValues, original, mask)
+	if err != nil {
+		t.Fatalf("TransformImageWithMask returned an unexpected error: %v", err)
+	}
+
+	if result[0][0] != testGreen.color || result[4][9] != testGreen.color {
+		t.Errorf("TransformImageWithMask did not transform inside the mask: %v %v", result[0][0], result[4][9])
+	}
+
+	if result[5][0] != testRed.color || result[9][9] != testRed.color {
+		t.Errorf("TransformImageWithMask transformed outside the mask: %v %v", result[5][0], result[9][9])
+	}
+
+	if original[0][0] != testRed.color {
+		t.Errorf("TransformImageWithMask changed the original pixels")
+	}
+
+	_, err = TransformImageWithMask(mockTransformFuncFail, original, mask)
+	if err == nil {
+		t.Errorf("TransformImageWithMask should have returned an error")
+	}
+}
+
+func TestProcessListWithMask(t *testing.T) {
+	options := TransformOptions{masks: []MaskSpec{{MaskRectangle, []float64{0, 0, 10, 5}, ""}}}
+	input := create2DArrayHalves(testWhite, testBlack, 10)
+
+	result, err := ProcessListOfTransformationsWithOptions(input, []TransformationType{Pixel10}, options)
+	if err != nil {
+		t.Fatalf("ProcessListOfTransformationsWithOptions returned an unexpected error: %v", err)
+	}
+
+	if result[0][0] != testGray.color {
+		t.Errorf("masked pixelation did not change the masked area: %v", result[0][0])
+	}
+
+	if result[0][9] != testWhite.color || result[9][9] != testBlack.color {
+		t.Errorf("masked pixelation changed the unmasked area: %v %v", result[0][9], result[9][9])
+	}
+
+	_, err = ProcessListOfTransformationsWithOptions(input, []TransformationType{Downsample10}, options)
+	if err == nil {
+		t.Errorf("masked downsample should have returned an error")
+	}
+
+	options.masks = []MaskSpec{{MaskImage, nil, t.TempDir() + "/missing.png"}}
+	_, err = ProcessListOfTransformationsWithOptions(input, []TransformationType{Gray, Pixel10}, options)
+	var transformError *TransformError
+	if !errors.As(err, &transformError) || transformError.Step != 0 || transformError.Transformation != Gray {
+		t.Errorf("a missing mask image should have failed at the first step. Got: %v", err)
+	}
+}
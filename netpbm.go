@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// Largest image the Netpbm and QOI decoders allocate, whatever the header
+// claims.
+const maxCodecPixels = 1 << 30
+
+func validCodecSize(width int, height int) bool {
+	return width >= 1 && height >= 1 && width <= maxCodecPixels/height
+}
+
+// netpbmHeader describes a P1 to P7 file.  Depth is the number of samples per
+// pixel: 1 gray, 2 gray and alpha, 3 RGB, 4 RGB and alpha.
+type netpbmHeader struct {
+	magic  string
+	width  int
+	height int
+	depth  int
+	maxval int
+}
+
+func init() {
+	image.RegisterFormat("pbm", "P1", decodeNetpbm, decodeNetpbmConfig)
+	image.RegisterFormat("pbm", "P4", decodeNetpbm, decodeNetpbmConfig)
+	image.RegisterFormat("pgm", "P2", decodeNetpbm, decodeNetpbmConfig)
+	image.RegisterFormat("pgm", "P5", decodeNetpbm, decodeNetpbmConfig)
+	image.RegisterFormat("ppm", "P3", decodeNetpbm, decodeNetpbmConfig)
+	image.RegisterFormat("ppm", "P6", decodeNetpbm, decodeNetpbmConfig)
+	image.RegisterFormat("pam", "P7", decodeNetpbm, decodeNetpbmConfig)
+}
+
+// readNetpbmToken returns the next whitespace separated word, skipping
+// comments.
+func readNetpbmToken(reader *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(token) > 0 {
+				return string(token), nil
+			}
+			return "", err
+		}
+		switch {
+		case b == '#' && len(token) == 0:
+			if _, err := reader.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, b)
+		}
+	}
+}
+
+func readNetpbmNumber(reader *bufio.Reader) (int, error) {
+	token, err := readNetpbmToken(reader)
+	if err != nil {
+		return 0, err
+	}
+	number, err := strconv.Atoi(token)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("netpbm: invalid number %q", token)
+	}
+	return number, nil
+}
+
+func readNetpbmHeader(reader *bufio.Reader) (netpbmHeader, error) {
+	var header netpbmHeader
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return header, err
+	}
+	header.magic = string(magic)
+
+	var err error
+	switch header.magic {
+	case "P7":
+		err = readPAMHeader(reader, &header)
+	case "P1", "P4":
+		header.depth, header.maxval = 1, 1
+		if header.width, err = readNetpbmNumber(reader); err == nil {
+			header.height, err = readNetpbmNumber(reader)
+		}
+	case "P2", "P5", "P3", "P6":
+		header.depth = 1
+		if header.magic == "P3" || header.magic == "P6" {
+			header.depth = 3
+		}
+		if header.width, err = readNetpbmNumber(reader); err == nil {
+			if header.height, err = readNetpbmNumber(reader); err == nil {
+				header.maxval, err = readNetpbmNumber(reader)
+			}
+		}
+	default:
+		return header, errors.New("netpbm: unknown magic number")
+	}
+	if err != nil {
+		return header, err
+	}
+
+	if !validCodecSize(header.width, header.height) {
+		return header, fmt.Errorf("netpbm: invalid size %vx%v", header.width, header.height)
+	}
+	if header.maxval < 1 || header.maxval > 65535 {
+		return header, fmt.Errorf("netpbm: invalid maxval %v", header.maxval)
+	}
+	if header.depth < 1 || header.depth > 4 {
+		return header, fmt.Errorf("netpbm: unsupported depth %v", header.depth)
+	}
+	return header, nil
+}
+
+// readPAMHeader reads the WIDTH, HEIGHT, DEPTH and MAXVAL lines up to ENDHDR.
+// The tuple type is implied by the depth.
+func readPAMHeader(reader *bufio.Reader, header *netpbmHeader) error {
+	for {
+		token, err := readNetpbmToken(reader)
+		if err != nil {
+			return err
+		}
+		switch token {
+		case "ENDHDR":
+			return nil
+		case "TUPLTYPE":
+			if _, err := reader.ReadString('\n'); err != nil {
+				return err
+			}
+		case "WIDTH", "HEIGHT", "DEPTH", "MAXVAL":
+			number, err := readNetpbmNumber(reader)
+			if err != nil {
+				return err
+			}
+			switch token {
+			case "WIDTH":
+				header.width = number
+			case "HEIGHT":
+				header.height = number
+			case "DEPTH":
+				header.depth = number
+			default:
+				header.maxval = number
+			}
+		default:
+			return fmt.Errorf("netpbm: unknown PAM header field %q", token)
+		}
+	}
+}
+
+func (header netpbmHeader) colorModel() color.Model {
+	switch {
+	case header.depth <= 2 && header.maxval > 255:
+		if header.depth == 2 {
+			return color.NRGBA64Model
+		}
+		return color.Gray16Model
+	case header.depth == 1:
+		return color.GrayModel
+	case header.maxval > 255:
+		return color.NRGBA64Model
+	}
+	return color.NRGBAModel
+}
+
+func decodeNetpbmConfig(r io.Reader) (image.Config, error) {
+	header, err := readNetpbmHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: header.colorModel(), Width: header.width, Height: header.height}, nil
+}
+
+// netpbmSampleReader reads the samples of the raster, in text for P1 to P3
+// and binary otherwise.
+type netpbmSampleReader struct {
+	reader *bufio.Reader
+	header netpbmHeader
+}
+
+func (samples netpbmSampleReader) next() (int, error) {
+	switch samples.header.magic {
+	case "P1":
+		// Bits may be written without separating whitespace
+		for {
+			b, err := samples.reader.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if b == '0' || b == '1' {
+				return int(b - '0'), nil
+			}
+			if b == '#' {
+				samples.reader.ReadString('\n')
+			}
+		}
+	case "P2", "P3":
+		return readNetpbmNumber(samples.reader)
+	}
+
+	high, err := samples.reader.ReadByte()
+	if err != nil || samples.header.maxval < 256 {
+		return int(high), err
+	}
+	low, err := samples.reader.ReadByte()
+	return int(high)<<8 | int(low), err
+}
+
+func decodeNetpbm(r io.Reader) (image.Image, error) {
+	reader := bufio.NewReader(r)
+	header, err := readNetpbmHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	bounds := image.Rect(0, 0, header.width, header.height)
+
+	if header.magic == "P4" {
+		return decodePackedBitmap(reader, header)
+	}
+
+	samples := netpbmSampleReader{reader, header}
+	scale := func(value int) uint16 {
+		return uint16(value * 65535 / header.maxval)
+	}
+
+	var img image.Image
+	switch header.colorModel() {
+	case color.GrayModel:
+		img = image.NewGray(bounds)
+	case color.Gray16Model:
+		img = image.NewGray16(bounds)
+	case color.NRGBA64Model:
+		img = image.NewNRGBA64(bounds)
+	default:
+		img = image.NewNRGBA(bounds)
+	}
+	canvas := img.(interface {
+		Set(x int, y int, c color.Color)
+	})
+
+	values := make([]uint16, header.depth)
+	for y := 0; y < header.height; y++ {
+		for x := 0; x < header.width; x++ {
+			for index := range values {
+				value, err := samples.next()
+				if err != nil {
+					return nil, fmt.Errorf("netpbm: truncated raster: %w", err)
+				}
+				if value > header.maxval {
+					return nil, fmt.Errorf("netpbm: sample %v above maxval %v", value, header.maxval)
+				}
+				values[index] = scale(value)
+			}
+
+			switch header.depth {
+			case 1:
+				gray := values[0]
+				if header.magic == "P1" {
+					// In bitmaps 1 is black
+					gray = 65535 - gray
+				}
+				canvas.Set(x, y, color.Gray16{gray})
+			case 2:
+				canvas.Set(x, y, color.NRGBA64{values[0], values[0], values[0], values[1]})
+			case 3:
+				canvas.Set(x, y, color.NRGBA64{values[0], values[1], values[2], 65535})
+			default:
+				canvas.Set(x, y, color.NRGBA64{values[0], values[1], values[2], values[3]})
+			}
+		}
+	}
+	return img, nil
+}
+
+// decodePackedBitmap reads P4 rows of 8 pixels per byte, each row padded to
+// a whole byte.
+func decodePackedBitmap(reader *bufio.Reader, header netpbmHeader) (image.Image, error) {
+	img := image.NewGray(image.Rect(0, 0, header.width, header.height))
+	row := make([]byte, (header.width+7)/8)
+	for y := 0; y < header.height; y++ {
+		if _, err := io.ReadFull(reader, row); err != nil {
+			return nil, fmt.Errorf("netpbm: truncated raster: %w", err)
+		}
+		for x := 0; x < header.width; x++ {
+			if row[x/8]&(0x80>>(x%8)) == 0 {
+				img.Pix[y*img.Stride+x] = 255
+			}
+		}
+	}
+	return img, nil
+}
+
+// encodeNetpbm writes the binary variant of the format: P4 for pbm, P5 for
+// pgm, P6 for ppm and P7 with alpha for pam.
+func encodeNetpbm(w io.Writer, img image.Image, format string) error {
+	out := bufio.NewWriter(w)
+	bounds := img.Bounds()
+
+	switch format {
+	case "pbm":
+		fmt.Fprintf(out, "P4\n%d %d\n", bounds.Dx(), bounds.Dy())
+	case "pgm":
+		fmt.Fprintf(out, "P5\n%d %d\n255\n", bounds.Dx(), bounds.Dy())
+	case "ppm":
+		fmt.Fprintf(out, "P6\n%d %d\n255\n", bounds.Dx(), bounds.Dy())
+	case "pam":
+		fmt.Fprintf(out, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n", bounds.Dx(), bounds.Dy())
+	default:
+		return fmt.Errorf("netpbm: unknown format %v", format)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		var bits byte
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := img.At(x, y)
+			switch format {
+			case "pbm":
+				if color.GrayModel.Convert(pixel).(color.Gray).Y < 128 {
+					bits |= 0x80 >> ((x - bounds.Min.X) % 8)
+				}
+				if (x-bounds.Min.X)%8 == 7 || x == bounds.Max.X-1 {
+					out.WriteByte(bits)
+					bits = 0
+				}
+			case "pgm":
+				out.WriteByte(color.GrayModel.Convert(pixel).(color.Gray).Y)
+			case "ppm":
+				// Without alpha the pixels are shown over black
+				r, g, b, _ := pixel.RGBA()
+				out.Write([]byte{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
+			default:
+				nrgba := color.NRGBAModel.Convert(pixel).(color.NRGBA)
+				out.Write([]byte{nrgba.R, nrgba.G, nrgba.B, nrgba.A})
+			}
+		}
+	}
+	return out.Flush()
+}
+
+func isNetpbmFormat(format string) bool {
+	switch format {
+	case "pbm", "pgm", "ppm", "pam":
+		return true
+	}
+	return false
+}
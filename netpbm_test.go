@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestDecodeNetpbm(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		format   string
+		expected []color.NRGBA
+	}{
+		{"P1", "P1\n# a comment\n3 1\n1 0\n1", "pbm", []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}, {0, 0, 0, 255}}},
+		{"P1Packed", "P1 3 1 101", "pbm", []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}, {0, 0, 0, 255}}},
+		{"P2", "P2 2 1 4 0 4", "pgm", []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}}},
+		{"P3", "P3 2 1 255 255 0 0 #red\n 0 0 255", "ppm", []color.NRGBA{{255, 0, 0, 255}, {0, 0, 255, 255}}},
+		{"P4", "P4\n3 1\n\xa0", "pbm", []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}, {0, 0, 0, 255}}},
+		{"P5", "P5 2 1 255\n\x00\xff", "pgm", []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}}},
+		{"P5Wide", "P5 2 1 65535\n\x00\x00\xff\xff", "pgm", []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}}},
+		{"P6", "P6 1 1 255\n\x10\x20\x30", "ppm", []color.NRGBA{{0x10, 0x20, 0x30, 255}}},
+		{"P7", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n\x10\x20\x30\x80", "pam", []color.NRGBA{{0x10, 0x20, 0x30, 0x80}}},
+		{"P7GrayAlpha", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 2\nMAXVAL 255\nENDHDR\n\x40\xff", "pam", []color.NRGBA{{0x40, 0x40, 0x40, 255}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, format, err := image.Decode(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if format != tt.format {
+				t.Errorf("expected format %v, got %v", tt.format, format)
+			}
+			if img.Bounds().Dx() != len(tt.expected) || img.Bounds().Dy() != 1 {
+				t.Fatalf("unexpected size %v", img.Bounds())
+			}
+			for x, expected := range tt.expected {
+				if got := color.NRGBAModel.Convert(img.At(x, 0)); got != expected {
+					t.Errorf("pixel %v: expected %v, got %v", x, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeNetpbmErrors(t *testing.T) {
+	for _, data := range []string{
+		"P6 2 2 255\n\x00\x00\x00",
+		"P2 1 1 10 11",
+		"P5 0 1 255\n",
+		"P5 1 1 70000\n\x00",
+		"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 5\nMAXVAL 255\nENDHDR\n",
+		"P7\nWIDTH 1\nCOLORS 3\nENDHDR\n",
+		"P3 99999999 99999999 255\n",
+	} {
+		if _, err := decodeNetpbm(strings.NewReader(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestEncodeNetpbm(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 9, 2))
+	for x := 0; x < 9; x++ {
+		img.Set(x, 0, color.NRGBA{250, 200, 150, 255})
+		img.Set(x, 1, color.NRGBA{10, 20, 30, 128})
+	}
+
+	for _, format := range []string{"pbm", "pgm", "ppm", "pam"} {
+		var data bytes.Buffer
+		if err := encodeNetpbm(&data, img, format); err != nil {
+			t.Fatalf("encoding %v returned an error: %v", format, err)
+		}
+		decoded, decodedFormat, err := image.Decode(&data)
+		if err != nil || decodedFormat != format {
+			t.Fatalf("expected to decode %v, got %v %v", format, decodedFormat, err)
+		}
+		if decoded.Bounds() != img.Bounds() {
+			t.Errorf("%v: expected bounds %v, got %v", format, img.Bounds(), decoded.Bounds())
+		}
+
+		top := color.NRGBAModel.Convert(decoded.At(8, 0)).(color.NRGBA)
+		bottom := color.NRGBAModel.Convert(decoded.At(8, 1)).(color.NRGBA)
+		switch format {
+		case "pbm":
+			if top.R != 255 || bottom.R != 0 {
+				t.Errorf("pbm: expected white over black, got %v %v", top, bottom)
+			}
+		case "pam":
+			if top != (color.NRGBA{250, 200, 150, 255}) || bottom != (color.NRGBA{10, 20, 30, 128}) {
+				t.Errorf("pam: expected the colors with alpha, got %v %v", top, bottom)
+			}
+		case "ppm":
+			if top != (color.NRGBA{250, 200, 150, 255}) {
+				t.Errorf("ppm: expected the color, got %v", top)
+			}
+		}
+	}
+
+	if err := encodeNetpbm(&bytes.Buffer{}, img, "pnm"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Gravity anchors something placed on the image to one of its edges,
+// corners or the center.
+type Gravity int64
+
+const (
+	GravityCenter Gravity = iota
+	GravityNorthWest
+	GravityNorth
+	GravityNorthEast
+	GravityWest
+	GravityEast
+	GravitySouthWest
+	GravitySouth
+	GravitySouthEast
+)
+
+var gravityNames = map[string]Gravity{
+	"c":  GravityCenter,
+	"nw": GravityNorthWest,
+	"n":  GravityNorth,
+	"ne": GravityNorthEast,
+	"w":  GravityWest,
+	"e":  GravityEast,
+	"sw": GravitySouthWest,
+	"s":  GravitySouth,
+	"se": GravitySouthEast,
+}
+
+// Largest overlay scale in percent.  A wider overlay only gets cut off, and
+// the resized copy would grow with the square of the scale.
+const maxOverlayScale = 100
+
+type OverlaySettings struct {
+	file    string
+	gravity Gravity
+	offsetX int
+	offsetY int
+	tile    bool
+	scale   float64
+	opacity float64
+}
+
+func getDefaultOverlaySettings() OverlaySettings {
+	return OverlaySettings{"", GravitySouthEast, 0, 0, false, 0, 1}
+}
+
+func parseGravity(name string) (Gravity, error) {
+	gravity, ok := gravityNames[strings.ToLower(name)]
+	if !ok {
+		return GravityCenter, fmt.Errorf("unknown gravity: %v", name)
+	}
+	return gravity, nil
+}
+
+func parseOffset(value string) (int, int, error) {
+	xText, yText, found := strings.Cut(value, ",")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid offset: %v", value)
+	}
+	x, errX := strconv.Atoi(strings.TrimSpace(xText))
+	y, errY := strconv.Atoi(strings.TrimSpace(yText))
+	if errX != nil || errY != nil {
+		return 0, 0, fmt.Errorf("invalid offset: %v", value)
+	}
+	return x, y, nil
+}
+
+// placeWithGravity returns the top left corner for an item of the given size.
+// Offsets move the item away from the edge it is anchored to.
+func placeWithGravity(gravity Gravity, baseWidth int, baseHeight int, width int, height int, offsetX int, offsetY int) (int, int) {
+	x := (baseWidth-width)/2 + offsetX
+	y := (baseHeight-height)/2 + offsetY
+
+	switch gravity {
+	case GravityNorthWest, GravityWest, GravitySouthWest:
+		x = offsetX
+	case GravityNorthEast, GravityEast, GravitySouthEast:
+		x = baseWidth - width - offsetX
+	}
+
+	switch gravity {
+	case GravityNorthWest, GravityNorth, GravityNorthEast:
+		y = offsetY
+	case GravitySouthWest, GravitySouth, GravitySouthEast:
+		y = baseHeight - height - offsetY
+	}
+
+	return x, y
+}
+
+// OverlayTransformation returns a transform that stamps the overlay image onto
+// the pixels it is given.
+func OverlayTransformation(settings OverlaySettings, overlayPixels [][]color.Color) TransformFn {
+	return func(originalPixels [][]color.Color) ([][]color.Color, error) {
+		return TransformPixelsOverlay(originalPixels, overlayPixels, settings)
+	}
+}
+
+func loadOverlay(settings OverlaySettings) ([][]color.Color, error) {
+	img, err := openJpeg(settings.file)
+	if err != nil {
+		return nil, err
+	}
+	return CreatePixelArrayFromImage(img)
+}
+
+// TransformPixelsOverlay composites the overlay over the original pixels,
+// either once at the gravity position or tiled over the whole image.
+func TransformPixelsOverlay(originalPixels [][]color.Color, overlayPixels [][]color.Color, settings OverlaySettings) ([][]color.Color, error) {
+	if len(overlayPixels) == 0 || len(overlayPixels[0]) == 0 {
+		return nil, errors.New("overlay image is empty")
+	}
+	if len(originalPixels) == 0 {
+		return originalPixels, nil
+	}
+
+	baseWidth := len(originalPixels)
+	baseHeight := len(originalPixels[0])
+
+	if settings.scale > 0 {
+		// Scale relative to the base width and keep the overlay's aspect ratio
+		width := max(1, int(math.Round(float64(baseWidth)*settings.scale)))
+		height := max(1, int(math.Round(float64(width)*float64(len(overlayPixels[0]))/float64(len(overlayPixels)))))
+		var err error
+		overlayPixels, err = ResizePixels(overlayPixels, width, height)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	width := len(overlayPixels)
+	height := len(overlayPixels[0])
+	startX, startY := placeWithGravity(settings.gravity, baseWidth, baseHeight, width, height, settings.offsetX, settings.offsetY)
+	if settings.tile {
+		startX, startY = settings.offsetX, settings.offsetY
+	}
+
+	compositeSettings := CompositeSettings{BlendNormal, CompositeSourceOver, settings.opacity}
+	newPixels := CopyPixelArray(originalPixels)
+	for xIndex := 0; xIndex < baseWidth; xIndex++ {
+		for yIndex := 0; yIndex < len(newPixels[xIndex]); yIndex++ {
+			overlayX := xIndex - startX
+			overlayY := yIndex - startY
+			if settings.tile {
+				overlayX = ((overlayX % width) + width) % width
+				overlayY = ((overlayY % height) + height) % height
+			} else if overlayX < 0 || overlayX >= width || overlayY < 0 || overlayY >= height {
+				continue
+			}
+			newPixels[xIndex][yIndex] = CompositeColor(newPixels[xIndex][yIndex], overlayPixels[overlayX][overlayY], compositeSettings)
+		}
+	}
+
+	return newPixels, nil
+}
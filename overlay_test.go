@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+type GravityTest struct {
+	name    string
+	gravity Gravity
+	offsetX int
+	offsetY int
+	expectX int
+	expectY int
+}
+
+type OverlayTest struct {
+	name     string
+	settings OverlaySettings
+	expected [][]color.Color
+}
+
+func TestPlaceWithGravity(t *testing.T) {
+	var tests = []GravityTest{
+		{"Center", GravityCenter, 0, 0, 4, 3},
+		{"CenterOffset", GravityCenter, 1, -1, 5, 2},
+		{"NorthWest", GravityNorthWest, 2, 1, 2, 1},
+		{"North", GravityNorth, 0, 1, 4, 1},
+		{"NorthEast", GravityNorthEast, 2, 1, 6, 1},
+		{"West", GravityWest, 2, 0, 2, 3},
+		{"East", GravityEast, 2, 0, 6, 3},
+		{"SouthWest", GravitySouthWest, 2, 1, 2, 5},
+		{"South", GravitySouth, 0, 1, 4, 5},
+		{"SouthEast", GravitySouthEast, 2, 1, 6, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y := placeWithGravity(tt.gravity, 10, 8, 2, 2, tt.offsetX, tt.offsetY)
+			if x != tt.expectX || y != tt.expectY {
+				t.Errorf("Test %s returned invalid position: Expect: %v,%v. Got: %v,%v", tt.name, tt.expectX, tt.expectY, x, y)
+			}
+		})
+	}
+}
+
+func TestParseGravityAndOffset(t *testing.T) {
+	gravity, err := parseGravity("NE")
+	if err != nil || gravity != GravityNorthEast {
+		t.Errorf("parseGravity returned invalid result: %v %v", gravity, err)
+	}
+
+	_, err = parseGravity("up")
+	if err == nil || !strings.Contains(err.Error(), "unknown gravity") {
+		t.Errorf("parseGravity should have returned an error. Got: %v", err)
+	}
+
+	x, y, err := parseOffset("10, -4")
+	if err != nil || x != 10 || y != -4 {
+		t.Errorf("parseOffset returned invalid result: %v %v %v", x, y, err)
+	}
+
+	for _, bad := range []string{"10", "a,b", "1,"} {
+		_, _, err = parseOffset(bad)
+		if err == nil {
+			t.Errorf("parseOffset should have returned an error for %v", bad)
+		}
+	}
+}
+
+func TestTransformPixelsOverlay(t *testing.T) {
+	base := [][]color.Color{
+		{testBlack.color, testBlack.color, testBlack.color},
+		{testBlack.color, testBlack.color, testBlack.color},
+		{testBlack.color, testBlack.color, testBlack.color},
+	}
+	logo := [][]color.Color{{testWhite.color}}
+	half := SetTestColor(128, 128, 128).color
+
+	var tests = []OverlayTest{
+		{"SouthEast", OverlaySettings{"", GravitySouthEast, 0, 0, false, 0, 1}, [][]color.Color{
+			{testBlack.color, testBlack.color, testBlack.color},
+			{testBlack.color, testBlack.color, testBlack.color},
+			{testBlack.color, testBlack.color, testWhite.color},
+		}},
+		{"NorthWestOffset", OverlaySettings{"", GravityNorthWest, 1, 0, false, 0, 1}, [][]color.Color{
+			{testBlack.color, testBlack.color, testBlack.color},
+			{testWhite.color, testBlack.color, testBlack.color},
+			{testBlack.color, testBlack.color, testBlack.color},
+		}},
+		{"CenterHalfOpacity", OverlaySettings{"", GravityCenter, 0, 0, false, 0, 0.5}, [][]color.Color{
+			{testBlack.color, testBlack.color, testBlack.color},
+			{testBlack.color, half, testBlack.color},
+			{testBlack.color, testBlack.color, testBlack.color},
+		}},
+		{"OffImage", OverlaySettings{"", GravityNorthWest, 5, 5, false, 0, 1}, base},
+		{"Tile", OverlaySettings{"", GravityCenter, 0, 0, true, 0, 1}, [][]color.Color{
+			{testWhite.color, testWhite.color, testWhite.color},
+			{testWhite.color, testWhite.color, testWhite.color},
+			{testWhite.color, testWhite.color, testWhite.color},
+		}},
+		{"ScaledToWidth", OverlaySettings{"", GravityNorthWest, 0, 0, false, 2.0 / 3.0, 1}, [][]color.Color{
+			{testWhite.color, testWhite.color, testBlack.color},
+			{testWhite.color, testWhite.color, testBlack.color},
+			{testBlack.color, testBlack.color, testBlack.color},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := TransformPixelsOverlay(base, logo, tt.settings)
+			if err != nil {
+				t.Fatalf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			for xIndex := 0; xIndex < len(tt.expected); xIndex++ {
+				for yIndex := 0; yIndex < len(tt.expected[xIndex]); yIndex++ {
+					if tt.expected[xIndex][yIndex] != result[xIndex][yIndex] {
+						t.Errorf("Test %s returned invalid pixel result at %d,%d: Expect: %v. Got: %v", tt.name, xIndex, yIndex, tt.expected[xIndex][yIndex], result[xIndex][yIndex])
+					}
+				}
+			}
+		})
+	}
+
+	if base[2][2] != testBlack.color {
+		t.Errorf("TransformPixelsOverlay changed the original pixels")
+	}
+}
+
+func TestTransformPixelsOverlayTiledOffset(t *testing.T) {
+	base := create2DArraySingleColor(testBlack)
+	logo := [][]color.Color{{testWhite.color, testBlack.color}, {testBlack.color, testBlack.color}}
+
+	result, err := TransformPixelsOverlay(base, logo, OverlaySettings{"", GravityCenter, 1, 1, true, 0, 1})
+	if err != nil {
+		t.Fatalf("TransformPixelsOverlay returned an unexpected error: %v", err)
+	}
+
+	for xIndex := 0; xIndex < 10; xIndex++ {
+		for yIndex := 0; yIndex < 10; yIndex++ {
+			expected := testBlack.color
+			if xIndex%2 == 1 && yIndex%2 == 1 {
+				expected = testWhite.color
+			}
+			if result[xIndex][yIndex] != expected {
+				t.Errorf("tiled overlay returned invalid pixel at %d,%d: Expect: %v. Got: %v", xIndex, yIndex, expected, result[xIndex][yIndex])
+			}
+		}
+	}
+
+	_, err = TransformPixelsOverlay(base, [][]color.Color{}, getDefaultOverlaySettings())
+	if err == nil {
+		t.Errorf("TransformPixelsOverlay should have returned an error for an empty overlay")
+	}
+}
+
+func TestProcessListWithOverlay(t *testing.T) {
+	tmpDir := t.TempDir()
+	logoFile := fmt.Sprintf("%v/%v", tmpDir, "logo.png")
+	if err := writePng([][]color.Color{{testRed.color}}, logoFile); err != nil {
+		t.Fatalf("could not write overlay image: %v", err)
+	}
+
+	settings := getDefaultOverlaySettings()
+	settings.file = logoFile
+	options := TransformOptions{overlay: &settings}
+
+	result, err := ProcessListOfTransformationsWithOptions(create2DArraySingleColor(testBlue), []TransformationType{Overlay, SwapRB}, options)
+	if err != nil {
+		t.Fatalf("ProcessListOfTransformationsWithOptions returned an unexpected error: %v", err)
+	}
+
+	if result[9][9] != testBlue.color || result[0][0] != testRed.color {
+		t.Errorf("overlay step returned invalid pixels: %v %v", result[9][9], result[0][0])
+	}
+
+	_, err = ProcessListOfTransformationsWithOptions(create2DArraySingleColor(testBlue), []TransformationType{Overlay}, TransformOptions{})
+	if err == nil || !strings.Contains(err.Error(), "no overlay image defined") {
+		t.Errorf("overlay without an image should have returned an error. Got: %v", err)
+	}
+
+	settings.file = tmpDir + "/missing.png"
+	_, err = ProcessListOfTransformationsWithOptions(create2DArraySingleColor(testBlue), []TransformationType{Gray, Overlay}, options)
+	var transformError *TransformError
+	if !errors.As(err, &transformError) || transformError.Step != 1 || exitCodeForError(err) != exitIO {
+		t.Errorf("overlay with a missing image should have failed at the overlay step. Got: %v", err)
+	}
+
+	// The image is only loaded for an overlay step
+	_, err = ProcessListOfTransformationsWithOptions(create2DArraySingleColor(testBlue), []TransformationType{Gray}, options)
+	if err != nil {
+		t.Errorf("a list without an overlay step should not load the overlay. Got: %v", err)
+	}
+}
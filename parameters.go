@@ -3,24 +3,52 @@ package main
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type Transformation struct {
 	transformList []TransformationType
 	inputFile     string
 	outputFile    string
+	outputFormat  string
+	// Page of a multi-page TIFF to read, counting from 1
+	page          int
+	watch         bool
+	watchInterval time.Duration
+	preview       PreviewSettings
+	textArt       TextArtSettings
+	gif           GIFSettings
+	walkthrough   WalkthroughSettings
 	showHelp      bool
+	options       TransformOptions
 }
 
 type TransformationType int64
 
 const (
 	Undefined TransformationType = iota
+	AutoContrast
+	AutoLevels
+	Clahe
+	Dot10
+	Dot20
+	Downsample3
+	Downsample10
+	Downsample20
+	Downsample50
+	Equalize
 	Gray
 	GrayBlue
 	GrayGreen
 	GrayRed
+	Hexagon10
+	Hexagon20
+	Overlay
 	Pixel3
 	Pixel10
 	Pixel20
@@ -30,14 +58,86 @@ const (
 	SwapGB
 	SwapRB
 	SwapRG
+	Temperature
+	Text
+	Tint
+	Triangle10
+	Triangle20
+	Upscale2
+	Upscale3
+	Upscale4
+	Upscale10
+	Voronoi100
+	Voronoi500
+	WhiteBalanceGray
+	WhiteBalanceWhite
+	// Not a transformation, counts the ones above.  Keep it last.
+	transformationCount
 )
 
+var transformationNames = map[TransformationType]string{
+	AutoContrast:      "auto-contrast",
+	AutoLevels:        "auto-levels",
+	Clahe:             "clahe",
+	Dot10:             "dot10",
+	Dot20:             "dot20",
+	Downsample3:       "downsample3",
+	Downsample10:      "downsample10",
+	Downsample20:      "downsample20",
+	Downsample50:      "downsample50",
+	Equalize:          "equalize",
+	Gray:              "gray",
+	GrayBlue:          "gray-blue",
+	GrayGreen:         "gray-green",
+	GrayRed:           "gray-red",
+	Hexagon10:         "hexagon10",
+	Hexagon20:         "hexagon20",
+	Overlay:           "overlay",
+	Pixel3:            "pixel3",
+	Pixel10:           "pixel10",
+	Pixel20:           "pixel20",
+	Pixel50:           "pixel50",
+	ShiftLeft:         "shift-left",
+	ShiftRight:        "shift-right",
+	SwapGB:            "swap-gb",
+	SwapRB:            "swap-rb",
+	SwapRG:            "swap-rg",
+	Temperature:       "temperature",
+	Text:              "text",
+	Tint:              "tint",
+	Triangle10:        "triangle10",
+	Triangle20:        "triangle20",
+	Upscale2:          "upscale2",
+	Upscale3:          "upscale3",
+	Upscale4:          "upscale4",
+	Upscale10:         "upscale10",
+	Voronoi100:        "voronoi100",
+	Voronoi500:        "voronoi500",
+	WhiteBalanceGray:  "white-balance-gray",
+	WhiteBalanceWhite: "white-balance-white",
+}
+
+func (transformation TransformationType) String() string {
+	name, ok := transformationNames[transformation]
+	if !ok {
+		return fmt.Sprintf("transformation %d", int64(transformation))
+	}
+	return name
+}
+
 func getEmptyTransformationParams() Transformation {
 	var transformParams Transformation
 	transformParams.inputFile = ""
 	transformParams.outputFile = ""
 	transformParams.showHelp = false
+	transformParams.page = 1
+	transformParams.watchInterval = defaultWatchInterval
+	transformParams.preview = PreviewSettings{mode: "auto"}
+	transformParams.textArt = getDefaultTextArtSettings()
+	transformParams.gif = GIFSettings{palette: "frame"}
+	transformParams.walkthrough = WalkthroughSettings{delay: defaultWalkthroughDelay}
 	transformParams.transformList = []TransformationType{}
+	transformParams.options = TransformOptions{}
 
 	return transformParams
 }
@@ -46,38 +146,76 @@ func parseParameters(args []string) (Transformation, error) {
 
 	transformParams := getEmptyTransformationParams()
 	var returnImmediately bool
-	nextValueInput := false
-	nextValueOutput := false
+	nextValueFlag := ""
 
 	for _, a := range args {
 
 		returnImmediately = false
 
-		firstChar := a[0:1]
-		if firstChar == "-" {
+		if strings.HasPrefix(a, "-") && !(nextValueFlag != "" && (isNegativeValue(a) || a == streamPath)) {
 			// This is a flag, don't use value as a file name
-			nextValueInput = false
-			nextValueOutput = false
+			if nextValueFlag != "" && !isFileFlag(nextValueFlag) {
+				return transformParams, &InvalidParameterError{Flag: nextValueFlag, Err: fmt.Errorf("missing value for flag: %v", nextValueFlag)}
+			}
+			nextValueFlag = ""
 		}
 
-		if nextValueInput {
-			transformParams.inputFile = a
-			nextValueInput = false
-		} else if nextValueOutput {
-			transformParams.outputFile = a
-			nextValueOutput = false
+		if nextValueFlag != "" {
+			err := setParameterValue(&transformParams, nextValueFlag, a)
+			if err != nil {
+				return transformParams, &InvalidParameterError{Flag: nextValueFlag, Err: err}
+			}
+			nextValueFlag = ""
 		} else {
 			switch a {
-			case "-i":
-				nextValueInput = true
-			case "-o":
-				nextValueOutput = true
+			case "-i", "-o", "-m", "-feather", "-blend", "-op", "-opacity", "-bg",
+				"-overlay", "-overlay-gravity", "-overlay-offset", "-overlay-scale", "-overlay-opacity",
+				"-text", "-text-font", "-text-size", "-text-color", "-text-outline", "-text-outline-width",
+				"-text-shadow", "-text-shadow-offset", "-text-align", "-text-gravity", "-text-offset", "-text-wrap",
+				"-clahe-grid", "-clahe-clip", "-al-clip", "-temp", "-tint", "-format", "--format", "-page", "-watch-interval",
+				"-preview-mode", "-preview-width", "-art-ramp", "-art-width", "-gif-palette",
+				"-walkthrough", "-walkthrough-delay", "-walkthrough-fade":
+				nextValueFlag = a
+			case "-watch", "--watch":
+				transformParams.watch = true
+			case "-preview", "--preview":
+				transformParams.preview.enabled = true
+			case "-walkthrough-labels":
+				transformParams.walkthrough.labels = true
+			case "-gif-dither":
+				transformParams.gif.dither = true
+			case "-art-braille":
+				transformParams.textArt.braille = true
+			case "-art-color":
+				transformParams.textArt.color = true
+			case "-overlay-tile":
+				getOverlaySettings(&transformParams).tile = true
 			case "-help":
 				fallthrough
 			case "-h":
 				transformParams = getEmptyTransformationParams()
 				transformParams.showHelp = true
 				returnImmediately = true
+			case "-d3":
+				transformParams.transformList = append(transformParams.transformList, Downsample3)
+			case "-d10":
+				transformParams.transformList = append(transformParams.transformList, Downsample10)
+			case "-d20":
+				transformParams.transformList = append(transformParams.transformList, Downsample20)
+			case "-d50":
+				transformParams.transformList = append(transformParams.transformList, Downsample50)
+			case "-dot10":
+				transformParams.transformList = append(transformParams.transformList, Dot10)
+			case "-dot20":
+				transformParams.transformList = append(transformParams.transformList, Dot20)
+			case "-ac":
+				transformParams.transformList = append(transformParams.transformList, AutoContrast)
+			case "-al":
+				transformParams.transformList = append(transformParams.transformList, AutoLevels)
+			case "-clahe":
+				transformParams.transformList = append(transformParams.transformList, Clahe)
+			case "-eq":
+				transformParams.transformList = append(transformParams.transformList, Equalize)
 			case "-g":
 				transformParams.transformList = append(transformParams.transformList, Gray)
 			case "-gb":
@@ -86,6 +224,10 @@ func parseParameters(args []string) (Transformation, error) {
 				transformParams.transformList = append(transformParams.transformList, GrayGreen)
 			case "-gr":
 				transformParams.transformList = append(transformParams.transformList, GrayRed)
+			case "-hex10":
+				transformParams.transformList = append(transformParams.transformList, Hexagon10)
+			case "-hex20":
+				transformParams.transformList = append(transformParams.transformList, Hexagon20)
 			case "-p3":
 				transformParams.transformList = append(transformParams.transformList, Pixel3)
 			case "-p10":
@@ -100,12 +242,32 @@ func parseParameters(args []string) (Transformation, error) {
 				transformParams.transformList = append(transformParams.transformList, SwapRB)
 			case "-srg":
 				transformParams.transformList = append(transformParams.transformList, SwapRG)
+			case "-tri10":
+				transformParams.transformList = append(transformParams.transformList, Triangle10)
+			case "-tri20":
+				transformParams.transformList = append(transformParams.transformList, Triangle20)
 			case "-l":
 				transformParams.transformList = append(transformParams.transformList, ShiftLeft)
 			case "-r":
 				transformParams.transformList = append(transformParams.transformList, ShiftRight)
+			case "-u2":
+				transformParams.transformList = append(transformParams.transformList, Upscale2)
+			case "-u3":
+				transformParams.transformList = append(transformParams.transformList, Upscale3)
+			case "-u4":
+				transformParams.transformList = append(transformParams.transformList, Upscale4)
+			case "-u10":
+				transformParams.transformList = append(transformParams.transformList, Upscale10)
+			case "-wbg":
+				transformParams.transformList = append(transformParams.transformList, WhiteBalanceGray)
+			case "-wbw":
+				transformParams.transformList = append(transformParams.transformList, WhiteBalanceWhite)
+			case "-vor100":
+				transformParams.transformList = append(transformParams.transformList, Voronoi100)
+			case "-vor500":
+				transformParams.transformList = append(transformParams.transformList, Voronoi500)
 			default:
-				return transformParams, fmt.Errorf("unknown transformation flag: %v", a)
+				return transformParams, &UnknownTransformError{Name: a}
 			}
 		}
 
@@ -114,13 +276,322 @@ func parseParameters(args []string) (Transformation, error) {
 		}
 	}
 
+	if nextValueFlag != "" && !isFileFlag(nextValueFlag) {
+		return transformParams, &InvalidParameterError{Flag: nextValueFlag, Err: fmt.Errorf("missing value for flag: %v", nextValueFlag)}
+	}
+
+	if transformParams.options.overlay != nil && !slices.Contains(transformParams.transformList, Overlay) {
+		return transformParams, &InvalidParameterError{Flag: "-overlay", Err: errors.New("overlay flags need an -overlay image")}
+	}
+
+	if transformParams.options.text != nil && !slices.Contains(transformParams.transformList, Text) {
+		return transformParams, &InvalidParameterError{Flag: "-text", Err: errors.New("text flags need a -text template")}
+	}
+
+	// Masks and the compositing backdrop are the size of the input image
+	for _, transformation := range transformParams.transformList {
+		if !changesImageSize(transformation) {
+			continue
+		}
+		if len(transformParams.options.masks) > 0 {
+			return transformParams, &InvalidParameterError{Flag: "-m", Err: fmt.Errorf("masks cannot be combined with %v, which changes the image size", transformation)}
+		}
+		if transformParams.options.composite != nil {
+			return transformParams, &InvalidParameterError{Flag: "-blend", Err: fmt.Errorf("compositing cannot be combined with %v, which changes the image size", transformation)}
+		}
+	}
+
 	if strings.TrimSpace(transformParams.inputFile) == "" {
-		return transformParams, errors.New("input file not properly defined")
+		return transformParams, &InvalidParameterError{Flag: "-i", Err: errors.New("input file not properly defined")}
 	}
 
 	if strings.TrimSpace(transformParams.outputFile) == "" {
-		return transformParams, errors.New("output file not properly defined")
+		return transformParams, &InvalidParameterError{Flag: "-o", Err: errors.New("output file not properly defined")}
 	}
 
 	return transformParams, nil
 }
+
+// isFileFlag reports whether the flag names a file.  A missing file name is
+// reported by the input and output checks instead of as a missing value.
+func isFileFlag(flag string) bool {
+	return flag == "-i" || flag == "-o"
+}
+
+// isNegativeValue reports whether the argument is a value such as -20 or
+// -5,10 rather than a flag.
+func isNegativeValue(value string) bool {
+	return len(value) > 1 && value[0] == '-' && (value[1] == '.' || (value[1] >= '0' && value[1] <= '9'))
+}
+
+func setParameterValue(transformParams *Transformation, flag string, value string) error {
+	switch flag {
+	case "-i":
+		transformParams.inputFile = value
+		transformParams.options.sourceName = filepath.Base(value)
+		if value == streamPath {
+			transformParams.options.sourceName = "stdin"
+		}
+	case "-o":
+		transformParams.outputFile = value
+	case "-format", "--format":
+		format, err := parseImageFormat(value)
+		if err != nil {
+			return err
+		}
+		transformParams.outputFormat = format
+	case "-page":
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return fmt.Errorf("invalid page: %v", value)
+		}
+		transformParams.page = page
+	case "-watch-interval":
+		milliseconds, err := strconv.Atoi(value)
+		if err != nil || milliseconds < 10 {
+			return fmt.Errorf("invalid watch interval: %v", value)
+		}
+		transformParams.watchInterval = time.Duration(milliseconds) * time.Millisecond
+	case "-preview-mode":
+		mode, err := parsePreviewMode(value)
+		if err != nil {
+			return err
+		}
+		transformParams.preview.mode = mode
+	case "-preview-width":
+		columns, err := strconv.Atoi(value)
+		if err != nil || columns < 1 {
+			return fmt.Errorf("invalid preview width: %v", value)
+		}
+		transformParams.preview.width = columns
+	case "-walkthrough":
+		if err := checkWalkthroughFile(value); err != nil {
+			return err
+		}
+		transformParams.walkthrough.file = value
+	case "-walkthrough-delay":
+		delay, err := strconv.Atoi(value)
+		if err != nil || delay < 10 || delay > maxWalkthroughDelay {
+			return fmt.Errorf("invalid walkthrough delay: %v", value)
+		}
+		transformParams.walkthrough.delay = delay
+	case "-walkthrough-fade":
+		fade, err := strconv.Atoi(value)
+		if err != nil || fade < 0 || fade > 30 {
+			return fmt.Errorf("invalid walkthrough fade: %v", value)
+		}
+		transformParams.walkthrough.fade = fade
+	case "-gif-palette":
+		mode, err := parseGIFPaletteMode(value)
+		if err != nil {
+			return err
+		}
+		transformParams.gif.palette = mode
+	case "-art-ramp":
+		if utf8.RuneCountInString(value) < 2 {
+			return fmt.Errorf("invalid character ramp, it needs at least 2 characters: %v", value)
+		}
+		transformParams.textArt.ramp = value
+	case "-art-width":
+		columns, err := strconv.Atoi(value)
+		if err != nil || columns < 1 {
+			return fmt.Errorf("invalid art width: %v", value)
+		}
+		transformParams.textArt.columns = columns
+	case "-m":
+		maskSpec, err := parseMaskSpec(value)
+		if err != nil {
+			return err
+		}
+		transformParams.options.masks = append(transformParams.options.masks, maskSpec)
+	case "-feather":
+		feather, err := strconv.Atoi(value)
+		if err != nil || feather < 0 || feather > maxFeather {
+			return fmt.Errorf("invalid feather value: %v (at most %v)", value, maxFeather)
+		}
+		transformParams.options.feather = feather
+	case "-blend":
+		mode, err := parseBlendMode(value)
+		if err != nil {
+			return err
+		}
+		getCompositeSettings(transformParams).mode = mode
+	case "-op":
+		operator, err := parseCompositeOperator(value)
+		if err != nil {
+			return err
+		}
+		getCompositeSettings(transformParams).operator = operator
+	case "-opacity":
+		opacity, err := strconv.ParseFloat(value, 64)
+		if err != nil || opacity < 0 || opacity > 100 {
+			return fmt.Errorf("invalid opacity value: %v", value)
+		}
+		getCompositeSettings(transformParams).opacity = opacity / 100
+	case "-bg":
+		getCompositeSettings(transformParams)
+		transformParams.options.backgroundFile = value
+	case "-overlay":
+		if slices.Contains(transformParams.transformList, Overlay) {
+			return errors.New("-overlay can only be used once")
+		}
+		getOverlaySettings(transformParams).file = value
+		transformParams.transformList = append(transformParams.transformList, Overlay)
+	case "-overlay-gravity":
+		gravity, err := parseGravity(value)
+		if err != nil {
+			return err
+		}
+		getOverlaySettings(transformParams).gravity = gravity
+	case "-overlay-offset":
+		offsetX, offsetY, err := parseOffset(value)
+		if err != nil {
+			return err
+		}
+		getOverlaySettings(transformParams).offsetX = offsetX
+		getOverlaySettings(transformParams).offsetY = offsetY
+	case "-overlay-scale":
+		scale, err := strconv.ParseFloat(value, 64)
+		if err != nil || scale <= 0 || scale > maxOverlayScale {
+			return fmt.Errorf("invalid overlay scale value: %v (at most %v)", value, maxOverlayScale)
+		}
+		getOverlaySettings(transformParams).scale = scale / 100
+	case "-overlay-opacity":
+		opacity, err := strconv.ParseFloat(value, 64)
+		if err != nil || opacity < 0 || opacity > 100 {
+			return fmt.Errorf("invalid overlay opacity value: %v", value)
+		}
+		getOverlaySettings(transformParams).opacity = opacity / 100
+	case "-text":
+		if slices.Contains(transformParams.transformList, Text) {
+			return errors.New("-text can only be used once")
+		}
+		getTextSettings(transformParams).template = value
+		transformParams.transformList = append(transformParams.transformList, Text)
+	case "-text-font":
+		getTextSettings(transformParams).fontFile = value
+	case "-text-size":
+		size, err := strconv.ParseFloat(value, 64)
+		if err != nil || size <= 0 || size > maxTextSize {
+			return fmt.Errorf("invalid text size value: %v (at most %v)", value, maxTextSize)
+		}
+		getTextSettings(transformParams).size = size
+	case "-text-color", "-text-outline", "-text-shadow":
+		textColor, err := parseHexColor(value)
+		if err != nil {
+			return err
+		}
+		switch flag {
+		case "-text-color":
+			getTextSettings(transformParams).color = textColor
+		case "-text-outline":
+			getTextSettings(transformParams).outlineColor = textColor
+		case "-text-shadow":
+			getTextSettings(transformParams).shadowColor = textColor
+		}
+	case "-text-outline-width", "-text-wrap":
+		pixels, err := strconv.Atoi(value)
+		if err != nil || pixels < 0 {
+			return fmt.Errorf("invalid %v value: %v", strings.TrimPrefix(flag, "-"), value)
+		}
+		if flag == "-text-outline-width" && pixels > maxTextOutlineWidth {
+			return fmt.Errorf("invalid text-outline-width value: %v (at most %v)", value, maxTextOutlineWidth)
+		}
+		if flag == "-text-wrap" {
+			getTextSettings(transformParams).wrapWidth = pixels
+		} else {
+			getTextSettings(transformParams).outlineWidth = pixels
+		}
+	case "-text-shadow-offset", "-text-offset":
+		offsetX, offsetY, err := parseOffset(value)
+		if err != nil {
+			return err
+		}
+		if flag == "-text-offset" {
+			getTextSettings(transformParams).offsetX = offsetX
+			getTextSettings(transformParams).offsetY = offsetY
+		} else {
+			getTextSettings(transformParams).shadowOffsetX = offsetX
+			getTextSettings(transformParams).shadowOffsetY = offsetY
+		}
+	case "-text-align":
+		align, err := parseTextAlign(value)
+		if err != nil {
+			return err
+		}
+		getTextSettings(transformParams).align = align
+	case "-text-gravity":
+		gravity, err := parseGravity(value)
+		if err != nil {
+			return err
+		}
+		getTextSettings(transformParams).gravity = gravity
+	case "-clahe-grid":
+		grid, err := strconv.Atoi(value)
+		if err != nil || grid < 1 || grid > maxClaheGrid {
+			return fmt.Errorf("invalid clahe grid value: %v (at most %v)", value, maxClaheGrid)
+		}
+		transformParams.options.claheGrid = grid
+	case "-clahe-clip":
+		clipLimit, err := strconv.ParseFloat(value, 64)
+		if err != nil || clipLimit < 1 {
+			return fmt.Errorf("invalid clahe clip value: %v", value)
+		}
+		transformParams.options.claheClip = clipLimit
+	case "-al-clip":
+		clipPercent, err := strconv.ParseFloat(value, 64)
+		if err != nil || clipPercent <= 0 || clipPercent >= 50 {
+			return fmt.Errorf("invalid auto-levels clip value: %v", value)
+		}
+		transformParams.options.levelsClip = clipPercent
+	case "-temp":
+		kelvin, err := strconv.ParseFloat(value, 64)
+		if err != nil || kelvin < 1000 || kelvin > 40000 {
+			return fmt.Errorf("invalid temperature value: %v", value)
+		}
+		if slices.Contains(transformParams.transformList, Temperature) {
+			return errors.New("-temp can only be used once")
+		}
+		transformParams.options.temperature = kelvin
+		transformParams.transformList = append(transformParams.transformList, Temperature)
+	case "-tint":
+		tint, err := strconv.ParseFloat(value, 64)
+		if err != nil || tint < -100 || tint > 100 {
+			return fmt.Errorf("invalid tint value: %v", value)
+		}
+		if slices.Contains(transformParams.transformList, Tint) {
+			return errors.New("-tint can only be used once")
+		}
+		transformParams.options.tint = tint
+		transformParams.transformList = append(transformParams.transformList, Tint)
+	default:
+		return fmt.Errorf("unknown parameter flag: %v", flag)
+	}
+	return nil
+}
+
+// getCompositeSettings turns on compositing the first time one of its flags
+// is used and returns the settings to change.
+func getCompositeSettings(transformParams *Transformation) *CompositeSettings {
+	if transformParams.options.composite == nil {
+		settings := getDefaultCompositeSettings()
+		transformParams.options.composite = &settings
+	}
+	return transformParams.options.composite
+}
+
+func getOverlaySettings(transformParams *Transformation) *OverlaySettings {
+	if transformParams.options.overlay == nil {
+		settings := getDefaultOverlaySettings()
+		transformParams.options.overlay = &settings
+	}
+	return transformParams.options.overlay
+}
+
+func getTextSettings(transformParams *Transformation) *TextSettings {
+	if transformParams.options.text == nil {
+		settings := getDefaultTextSettings()
+		transformParams.options.text = &settings
+	}
+	return transformParams.options.text
+}
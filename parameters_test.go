@@ -37,6 +37,32 @@ func TestGetEmptyTransformationParams(t *testing.T) {
 	}
 }
 
+func TestParseCompositeParameters(t *testing.T) {
+	result, err := parseParameters([]string{"-i", "a.jpg", "-o", "b.jpg", "-gg"})
+	if err != nil {
+		t.Fatalf("parseParameters returned an unexpected error: %v", err)
+	}
+	if result.options.composite != nil {
+		t.Errorf("parseParameters turned on compositing without a compositing flag")
+	}
+
+	result, err = parseParameters([]string{"-i", "a.jpg", "-o", "b.jpg", "-gg", "-opacity", "25", "-blend", "screen", "-bg", "c.png"})
+	if err != nil {
+		t.Fatalf("parseParameters returned an unexpected error: %v", err)
+	}
+	if result.options.composite == nil {
+		t.Fatalf("parseParameters did not turn on compositing")
+	}
+
+	expected := CompositeSettings{BlendScreen, CompositeSourceOver, 0.25}
+	if *result.options.composite != expected {
+		t.Errorf("parseParameters returned invalid composite settings: Expect: %v. Got: %v", expected, *result.options.composite)
+	}
+	if result.options.backgroundFile != "c.png" {
+		t.Errorf("parseParameters returned invalid background file: Expect: %v. Got: %v", "c.png", result.options.backgroundFile)
+	}
+}
+
 func TestParseParameters(t *testing.T) {
 	var emptyParams []string
 	showHelpParams := []string{"-help"}
@@ -54,6 +80,14 @@ func TestParseParameters(t *testing.T) {
 	pixel10Params := []string{"-p10"}
 	pixel20Params := []string{"-p20"}
 	pixel50Params := []string{"-p50"}
+	downsample3Params := []string{"-d3"}
+	downsample10Params := []string{"-d10"}
+	downsample20Params := []string{"-d20"}
+	downsample50Params := []string{"-d50"}
+	upscale2Params := []string{"-u2"}
+	upscale3Params := []string{"-u3"}
+	upscale4Params := []string{"-u4"}
+	upscale10Params := []string{"-u10"}
 	invalidParams := []string{"-x"}
 	inputFileFlagOnly := []string{"-o", "abc.jpg", "-i"}
 	inputFileFlagOnly2 := []string{"-i", "-o", "abc.jpg"}
@@ -76,6 +110,14 @@ func TestParseParameters(t *testing.T) {
 	pixel10Xfm := []TransformationType{Pixel10}
 	pixel20Xfm := []TransformationType{Pixel20}
 	pixel50Xfm := []TransformationType{Pixel50}
+	downsample3Xfm := []TransformationType{Downsample3}
+	downsample10Xfm := []TransformationType{Downsample10}
+	downsample20Xfm := []TransformationType{Downsample20}
+	downsample50Xfm := []TransformationType{Downsample50}
+	upscale2Xfm := []TransformationType{Upscale2}
+	upscale3Xfm := []TransformationType{Upscale3}
+	upscale4Xfm := []TransformationType{Upscale4}
+	upscale10Xfm := []TransformationType{Upscale10}
 
 	var tests = []ParamTest{
 		{"NoParams", emptyParams, emptyXfm, false, "", "", true, "input file not properly defined"},
@@ -101,8 +143,78 @@ func TestParseParameters(t *testing.T) {
 		{"Pixel3Only", append(pixel10Params, bothFileParams...), pixel10Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
 		{"Pixel3Only", append(pixel20Params, bothFileParams...), pixel20Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
 		{"Pixel3Only", append(pixel50Params, bothFileParams...), pixel50Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Downsample3Only", append(downsample3Params, bothFileParams...), downsample3Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Downsample10Only", append(downsample10Params, bothFileParams...), downsample10Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Downsample20Only", append(downsample20Params, bothFileParams...), downsample20Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Downsample50Only", append(downsample50Params, bothFileParams...), downsample50Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Upscale2Only", append(upscale2Params, bothFileParams...), upscale2Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Upscale3Only", append(upscale3Params, bothFileParams...), upscale3Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Upscale4Only", append(upscale4Params, bothFileParams...), upscale4Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Upscale10Only", append(upscale10Params, bothFileParams...), upscale10Xfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Hexagon10Only", append([]string{"-hex10"}, bothFileParams...), []TransformationType{Hexagon10}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Hexagon20Only", append([]string{"-hex20"}, bothFileParams...), []TransformationType{Hexagon20}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Triangle10Only", append([]string{"-tri10"}, bothFileParams...), []TransformationType{Triangle10}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Triangle20Only", append([]string{"-tri20"}, bothFileParams...), []TransformationType{Triangle20}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Dot10Only", append([]string{"-dot10"}, bothFileParams...), []TransformationType{Dot10}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Dot20Only", append([]string{"-dot20"}, bothFileParams...), []TransformationType{Dot20}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Voronoi100Only", append([]string{"-vor100"}, bothFileParams...), []TransformationType{Voronoi100}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"Voronoi500Only", append([]string{"-vor500"}, bothFileParams...), []TransformationType{Voronoi500}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"MaskRect", append([]string{"-m", "rect:1,2,3,4", "-g"}, bothFileParams...), grayXfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"MaskFeather", append([]string{"-feather", "5", "-m", "ellipse:1,2,3,4", "-g"}, bothFileParams...), grayXfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"MaskInvalid", append([]string{"-m", "rect:1,2", "-g"}, bothFileParams...), grayXfm, false, "xyz.jpg", "abc.jpg", true, "rect mask needs"},
+		{"MaskMissingValue", append([]string{"-m", "-g"}, bothFileParams...), grayXfm, false, "xyz.jpg", "abc.jpg", true, "missing value for flag: -m"},
+		{"MaskMissingValueAtEnd", append(bothFileParams, "-m"), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "missing value for flag: -m"},
+		{"MaskWithDownsample", append([]string{"-m", "rect:1,2,3,4", "-d10"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "masks cannot be combined with"},
+		{"BackgroundWithDownsample", append([]string{"-d10", "-bg", "bg.png"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "compositing cannot be combined with downsample10"},
+		{"BlendWithUpscale", append([]string{"-blend", "multiply", "-u2"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "compositing cannot be combined with upscale2"},
+		{"MaskWithUpscale", append([]string{"-u2", "-m", "rect:1,2,3,4", "-g"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "masks cannot be combined with"},
+		{"FeatherInvalid", append([]string{"-feather", "abc"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid feather value"},
+		{"FeatherTooLarge", append([]string{"-feather", "101"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid feather value: 101 (at most 100)"},
+		{"BlendMode", append([]string{"-gg", "-blend", "multiply", "-opacity", "50"}, bothFileParams...), grayGreenXfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"BlendOperator", append([]string{"-op", "xor", "-bg", "bg.png"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"BlendInvalidMode", append([]string{"-blend", "sparkle"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "unknown blend mode"},
+		{"BlendInvalidOperator", append([]string{"-op", "under"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "unknown composite operator"},
+		{"BlendInvalidOpacity", append([]string{"-opacity", "150"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid opacity value"},
+		{"OverlayOnly", append([]string{"-overlay", "logo.png"}, bothFileParams...), []TransformationType{Overlay}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"OverlaySettings", append([]string{"-g", "-overlay", "logo.png", "-overlay-gravity", "nw", "-overlay-offset", "5,5", "-overlay-scale", "20", "-overlay-opacity", "50", "-overlay-tile"}, bothFileParams...), []TransformationType{Gray, Overlay}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"OverlayBadGravity", append([]string{"-overlay-gravity", "up"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "unknown gravity"},
+		{"OverlayBadOffset", append([]string{"-overlay-offset", "5"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid offset"},
+		{"OverlayBadScale", append([]string{"-overlay-scale", "0"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid overlay scale value"},
+		{"OverlayLargeScale", append([]string{"-overlay", "logo.png", "-overlay-scale", "100000"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid overlay scale value: 100000 (at most 100)"},
+		{"OverlayBadOpacity", append([]string{"-overlay-opacity", "x"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid overlay opacity value"},
+		{"OverlayTwice", append([]string{"-overlay", "logo.png", "-overlay", "badge.png"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "-overlay can only be used once"},
+		{"OverlayFlagsWithoutOverlay", append([]string{"-g", "-overlay-gravity", "ne"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "overlay flags need an -overlay image"},
+		{"TextOnly", append([]string{"-text", "{filename}"}, bothFileParams...), []TransformationType{Text}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"TextSettings", append([]string{"-text", "hello", "-text-size", "20", "-text-color", "ff0000", "-text-outline", "000000", "-text-outline-width", "2", "-text-shadow", "00000080", "-text-shadow-offset", "3,3", "-text-align", "center", "-text-gravity", "n", "-text-offset", "0,5", "-text-wrap", "200", "-text-font", "a.ttf"}, bothFileParams...), []TransformationType{Text}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"TextFlagsWithoutText", append([]string{"-g", "-text-size", "20", "-text-color", "ff0000"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "text flags need a -text template"},
+		{"TextTwice", append([]string{"-text", "top", "-text", "bottom"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "-text can only be used once"},
+		{"TextBadSize", append([]string{"-text-size", "0"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid text size value"},
+		{"TextSizeTooLarge", append([]string{"-text-size", "1001"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid text size value: 1001 (at most 1000)"},
+		{"TextOutlineTooWide", append([]string{"-text-outline-width", "51"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid text-outline-width value: 51 (at most 50)"},
+		{"TextBadColor", append([]string{"-text-color", "red"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid color"},
+		{"TextBadWrap", append([]string{"-text-wrap", "x"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid text-wrap value"},
+		{"TextBadAlign", append([]string{"-text-align", "justify"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "unknown text alignment"},
+		{"TextBadGravity", append([]string{"-text-gravity", "up"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "unknown gravity"},
+		{"TextBadOffset", append([]string{"-text-offset", "1"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid offset"},
+		{"EqualizeOnly", append([]string{"-eq"}, bothFileParams...), []TransformationType{Equalize}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"ClaheOnly", append([]string{"-clahe", "-clahe-grid", "4", "-clahe-clip", "3.5"}, bothFileParams...), []TransformationType{Clahe}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"ClaheBadGrid", append([]string{"-clahe-grid", "0"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid clahe grid value"},
+		{"ClaheLargeGrid", append([]string{"-clahe-grid", "65"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid clahe grid value: 65 (at most 64)"},
+		{"ClaheBadClip", append([]string{"-clahe-clip", "0.5"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid clahe clip value"},
+		{"AutoCorrections", append([]string{"-ac", "-al", "-al-clip", "1", "-wbg", "-wbw"}, bothFileParams...), []TransformationType{AutoContrast, AutoLevels, WhiteBalanceGray, WhiteBalanceWhite}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"TemperatureAndTint", append([]string{"-temp", "3200", "-tint", "-20"}, bothFileParams...), []TransformationType{Temperature, Tint}, false, "xyz.jpg", "abc.jpg", false, ""},
+		{"TemperatureBad", append([]string{"-temp", "100"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid temperature value"},
+		{"TintBad", append([]string{"-tint", "-200"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid tint value"},
+		{"TemperatureTwice", append([]string{"-temp", "3200", "-g", "-temp", "6500"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "-temp can only be used once"},
+		{"TintTwice", append([]string{"-tint", "20", "-tint", "-20"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "-tint can only be used once"},
+		{"LevelsClipBad", append([]string{"-al-clip", "60"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "invalid auto-levels clip value"},
+		{"NegativeOffset", append([]string{"-text", "hi", "-text-offset", "-5,10"}, bothFileParams...), []TransformationType{Text}, false, "xyz.jpg", "abc.jpg", false, ""},
 		{"ParamCombo", append(append(swapRBParams, shiftLeftParams...), bothFileParams...), append(swapRBXfm, shiftLeftXfm...), false, "xyz.jpg", "abc.jpg", false, ""},
 		{"InvalidCombo", append(append(swapRBParams, invalidParams...), bothFileParams...), swapRBXfm, false, "xyz.jpg", "abc.jpg", true, ""},
+		{"StdinStdout", []string{"-i", "-", "-o", "-", "-g"}, grayXfm, false, "-", "-", false, ""},
+		{"StdoutFormat", []string{"-i", "xyz.jpg", "-o", "-", "--format", "png"}, emptyXfm, false, "xyz.jpg", "-", false, ""},
+		{"FormatBad", append([]string{"-format", "webp"}, bothFileParams...), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "unknown image format"},
+		{"FormatMissing", append(bothFileParams, "--format"), emptyXfm, false, "xyz.jpg", "abc.jpg", true, "missing value for flag: --format"},
 	}
 
 	for _, tt := range tests {
@@ -151,3 +263,36 @@ func TestParseParameters(t *testing.T) {
 		})
 	}
 }
+
+func FuzzParseParameters(f *testing.F) {
+	f.Add("-i\nin.jpg\n-o\nout.jpg\n-g")
+	f.Add("-i\nin.jpg\n-o\nout.jpg\n-temp\n-20\n-tint\n5")
+	f.Add("-i\nin.jpg\n-o\nout.jpg\n-m\nrect:0,0,10,10\n-feather\n3\n-p10")
+	f.Add("-text\n{filename}\n-text-offset\n-5,10\n-i\nin.jpg\n-o\nout.jpg")
+	f.Add("-h")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		args := strings.Split(input, "\n")
+		params, err := parseParameters(args)
+		if err != nil || params.showHelp {
+			return
+		}
+
+		if strings.TrimSpace(params.inputFile) == "" || strings.TrimSpace(params.outputFile) == "" {
+			t.Errorf("parseParameters accepted %q without input and output files", args)
+		}
+	})
+}
+
+func TestParseStreamParameters(t *testing.T) {
+	params, err := parseParameters([]string{"-i", "-", "-o", "-", "-format", "JPG", "-text", "{filename}"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.outputFormat != "jpeg" {
+		t.Errorf("expected jpeg output format, got %v", params.outputFormat)
+	}
+	if params.options.sourceName != "stdin" {
+		t.Errorf("expected stdin as the source name, got %v", params.options.sourceName)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const defaultPreviewColumns = 80
+
+// Width in pixels of a terminal cell, used to size sixel and kitty images.
+const previewCellWidth = 10
+
+const kittyChunkSize = 4096
+
+var previewModes = map[string]bool{
+	"auto":  true,
+	"ansi":  true,
+	"sixel": true,
+	"kitty": true,
+}
+
+type PreviewSettings struct {
+	enabled bool
+	mode    string
+	// Width in terminal columns, 0 uses the terminal width
+	width int
+}
+
+func parsePreviewMode(value string) (string, error) {
+	mode := strings.ToLower(value)
+	if !previewModes[mode] {
+		return "", fmt.Errorf("unknown preview mode: %v (use auto, ansi, sixel or kitty)", value)
+	}
+	return mode, nil
+}
+
+// detectPreviewMode picks the graphics protocol the terminal advertises in
+// its environment.  Every truecolor terminal can show the ANSI preview.
+func detectPreviewMode(getenv func(string) string) string {
+	term := getenv("TERM")
+	termProgram := getenv("TERM_PROGRAM")
+
+	switch {
+	case getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || termProgram == "WezTerm" || termProgram == "ghostty":
+		return "kitty"
+	case strings.Contains(term, "sixel") || term == "mlterm" || strings.HasPrefix(term, "foot") || term == "yaft-256color":
+		return "sixel"
+	}
+	return "ansi"
+}
+
+func previewColumns(settings PreviewSettings, getenv func(string) string) int {
+	if settings.width > 0 {
+		return settings.width
+	}
+	if columns, err := strconv.Atoi(getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return defaultPreviewColumns
+}
+
+// scalePreview shrinks the pixels to the width keeping the aspect ratio.
+// Small images are never enlarged.
+func scalePreview(pixels [][]color.Color, width int) ([][]color.Color, error) {
+	if len(pixels) == 0 || len(pixels[0]) == 0 {
+		return nil, errors.New("cannot preview an empty pixel array")
+	}
+	if width >= len(pixels) {
+		return pixels, nil
+	}
+	height := max(1, (len(pixels[0])*width+len(pixels)/2)/len(pixels))
+	return ResizePixels(pixels, width, height)
+}
+
+// writePreview renders the pixels for the terminal, scaled to its width.
+func writePreview(w io.Writer, pixels [][]color.Color, settings PreviewSettings, getenv func(string) string) error {
+	mode := settings.mode
+	if mode == "" || mode == "auto" {
+		mode = detectPreviewMode(getenv)
+	}
+	columns := previewColumns(settings, getenv)
+
+	var err error
+	switch mode {
+	case "sixel":
+		pixels, err = scalePreview(pixels, columns*previewCellWidth)
+		if err == nil {
+			err = writeSixel(w, pixels)
+		}
+	case "kitty":
+		pixels, err = scalePreview(pixels, columns*previewCellWidth)
+		if err == nil {
+			err = writeKitty(w, pixels)
+		}
+	default:
+		// Each character shows two pixels, one above the other
+		pixels, err = scalePreview(pixels, columns)
+		if err == nil {
+			err = writeHalfBlocks(w, pixels)
+		}
+	}
+	return err
+}
+
+// previewRGB drops the alpha channel, transparent pixels show as black.
+func previewRGB(c color.Color) (uint8, uint8, uint8) {
+	r, g, b, _ := c.RGBA()
+	return uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)
+}
+
+// writeHalfBlocks draws the upper pixel in the foreground color of ▀ and the
+// lower pixel in its background color, using 24-bit ANSI colors.
+func writeHalfBlocks(w io.Writer, pixels [][]color.Color) error {
+	out := bufio.NewWriter(w)
+	width := len(pixels)
+	height := len(pixels[0])
+
+	for y := 0; y < height; y += 2 {
+		for x := 0; x < width; x++ {
+			r, g, b := previewRGB(pixels[x][y])
+			fmt.Fprintf(out, "\x1b[38;2;%d;%d;%dm", r, g, b)
+			if y+1 < height {
+				r, g, b = previewRGB(pixels[x][y+1])
+				fmt.Fprintf(out, "\x1b[48;2;%d;%d;%dm", r, g, b)
+			} else {
+				out.WriteString("\x1b[49m")
+			}
+			out.WriteString("▀")
+		}
+		out.WriteString("\x1b[0m\n")
+	}
+	return out.Flush()
+}
+
+// sixelColorIndex maps a color to the 6x6x6 color cube used as the palette.
+func sixelColorIndex(c color.Color) int {
+	r, g, b := previewRGB(c)
+	level := func(value uint8) int { return (int(value)*5 + 127) / 255 }
+	return level(r)*36 + level(g)*6 + level(b)
+}
+
+// writeSixel encodes the pixels as DEC sixel graphics.  Every band of six
+// rows is drawn once per color in the band, with repeated columns run length
+// encoded.
+func writeSixel(w io.Writer, pixels [][]color.Color) error {
+	out := bufio.NewWriter(w)
+	width := len(pixels)
+	height := len(pixels[0])
+
+	indices := make([][]int, width)
+	var used [216]bool
+	for x := range pixels {
+		indices[x] = make([]int, height)
+		for y := range pixels[x] {
+			indices[x][y] = sixelColorIndex(pixels[x][y])
+			used[indices[x][y]] = true
+		}
+	}
+
+	fmt.Fprintf(out, "\x1bPq\"1;1;%d;%d", width, height)
+	for index, isUsed := range used {
+		if isUsed {
+			// Sixel colors are percentages
+			fmt.Fprintf(out, "#%d;2;%d;%d;%d", index, index/36*20, index/6%6*20, index%6*20)
+		}
+	}
+
+	for top := 0; top < height; top += 6 {
+		var bandColors []int
+		var inBand [216]bool
+		for x := 0; x < width; x++ {
+			for y := top; y < min(top+6, height); y++ {
+				if !inBand[indices[x][y]] {
+					inBand[indices[x][y]] = true
+					bandColors = append(bandColors, indices[x][y])
+				}
+			}
+		}
+
+		for colorNumber, index := range bandColors {
+			if colorNumber > 0 {
+				// Return to the start of the band to draw the next color
+				out.WriteByte('$')
+			}
+			fmt.Fprintf(out, "#%d", index)
+
+			var previous byte
+			count := 0
+			for x := 0; x < width; x++ {
+				bits := 0
+				for y := top; y < min(top+6, height); y++ {
+					if indices[x][y] == index {
+						bits |= 1 << (y - top)
+					}
+				}
+				sixel := byte(63 + bits)
+				if count > 0 && sixel != previous {
+					writeSixelRun(out, previous, count)
+					count = 0
+				}
+				previous = sixel
+				count++
+			}
+			writeSixelRun(out, previous, count)
+		}
+		out.WriteByte('-')
+	}
+	out.WriteString("\x1b\\\n")
+	return out.Flush()
+}
+
+func writeSixelRun(out *bufio.Writer, sixel byte, count int) {
+	if count > 3 {
+		fmt.Fprintf(out, "!%d%c", count, sixel)
+		return
+	}
+	for i := 0; i < count; i++ {
+		out.WriteByte(sixel)
+	}
+}
+
+// writeKitty sends the pixels as a PNG with the kitty graphics protocol, in
+// base64 chunks of at most 4096 bytes.
+func writeKitty(w io.Writer, pixels [][]color.Color) error {
+	var encoded bytes.Buffer
+	if err := encodeImage(&encoded, pixels, "png", "preview"); err != nil {
+		return err
+	}
+	data := base64.StdEncoding.EncodeToString(encoded.Bytes())
+
+	out := bufio.NewWriter(w)
+	for start := 0; start < len(data); start += kittyChunkSize {
+		end := min(start+kittyChunkSize, len(data))
+		more := 0
+		if end < len(data) {
+			more = 1
+		}
+		if start == 0 {
+			fmt.Fprintf(out, "\x1b_Ga=T,f=100,m=%d;%v\x1b\\", more, data[start:end])
+		} else {
+			fmt.Fprintf(out, "\x1b_Gm=%d;%v\x1b\\", more, data[start:end])
+		}
+	}
+	out.WriteString("\n")
+	return out.Flush()
+}
+
+func showPreviewHelp() {
+	fmt.Println("imagesTx.exe preview -i <input file> [-o <output file>] [preview flags] [transformation flags]")
+	fmt.Println("")
+	fmt.Println("Shows the result in the terminal instead of an image viewer, e.g. over SSH.  The file is only")
+	fmt.Println("written when -o is given.  All transformation flags of the main command can be used.")
+	fmt.Println("")
+	fmt.Println("  -preview-mode <mode>     auto (default), ansi, sixel or kitty.  auto picks sixel or kitty when")
+	fmt.Println("                           the terminal advertises it and 24-bit ANSI half blocks otherwise")
+	fmt.Printf("  -preview-width <columns> Width of the preview (default $COLUMNS or %v)\n", defaultPreviewColumns)
+	fmt.Println("")
+}
+
+func runPreview(args []string) error {
+	// Without -o only the preview is shown
+	params, err := parseParameters(append([]string{"-o", streamPath}, args...))
+	if err != nil {
+		return err
+	}
+	if params.showHelp {
+		showPreviewHelp()
+		return nil
+	}
+
+	params.preview.enabled = true
+	outputFile := params.outputFile
+	if outputFile == streamPath {
+		outputFile = ""
+	}
+	return processImageFile(params, params.inputFile, outputFile)
+}
+
+// previewWriter keeps the preview away from an image written to stdout.
+func previewWriter(outputFile string) io.Writer {
+	if outputFile == streamPath {
+		return stderr
+	}
+	return stdout
+}
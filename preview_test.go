@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+var previewRed = color.RGBA{255, 0, 0, 255}
+var previewBlue = color.RGBA{0, 0, 255, 255}
+var previewWhite = color.RGBA{255, 255, 255, 255}
+
+func fakeEnv(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func TestDetectPreviewMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{"Plain", map[string]string{"TERM": "xterm-256color"}, "ansi"},
+		{"Kitty", map[string]string{"TERM": "xterm-kitty"}, "kitty"},
+		{"KittyWindow", map[string]string{"TERM": "xterm-256color", "KITTY_WINDOW_ID": "1"}, "kitty"},
+		{"WezTerm", map[string]string{"TERM_PROGRAM": "WezTerm"}, "kitty"},
+		{"Foot", map[string]string{"TERM": "foot-extra"}, "sixel"},
+		{"Mlterm", map[string]string{"TERM": "mlterm"}, "sixel"},
+		{"Empty", map[string]string{}, "ansi"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if mode := detectPreviewMode(fakeEnv(test.env)); mode != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, mode)
+			}
+		})
+	}
+}
+
+func TestPreviewColumns(t *testing.T) {
+	if columns := previewColumns(PreviewSettings{width: 40}, fakeEnv(map[string]string{"COLUMNS": "120"})); columns != 40 {
+		t.Errorf("expected the flag to win, got %v", columns)
+	}
+	if columns := previewColumns(PreviewSettings{}, fakeEnv(map[string]string{"COLUMNS": "120"})); columns != 120 {
+		t.Errorf("expected $COLUMNS, got %v", columns)
+	}
+	if columns := previewColumns(PreviewSettings{}, fakeEnv(nil)); columns != defaultPreviewColumns {
+		t.Errorf("expected the default, got %v", columns)
+	}
+}
+
+func TestScalePreview(t *testing.T) {
+	pixels := make([][]color.Color, 100)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, 50)
+		for y := range pixels[x] {
+			pixels[x][y] = color.Gray{127}
+		}
+	}
+
+	scaled, err := scalePreview(pixels, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scaled) != 20 || len(scaled[0]) != 10 {
+		t.Errorf("expected 20x10, got %vx%v", len(scaled), len(scaled[0]))
+	}
+
+	scaled, _ = scalePreview(pixels, 200)
+	if len(scaled) != 100 {
+		t.Errorf("expected small images to keep their size, got width %v", len(scaled))
+	}
+
+	if _, err := scalePreview(nil, 20); err == nil {
+		t.Errorf("expected an error for an empty array")
+	}
+}
+
+func TestWriteHalfBlocks(t *testing.T) {
+	// 2x3 pixels: red over blue in the first row of cells, a lone row after
+	pixels := [][]color.Color{
+		{previewRed, previewBlue, previewWhite},
+		{previewRed, previewBlue, previewWhite},
+	}
+	var output bytes.Buffer
+	if err := writeHalfBlocks(&output, pixels); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %v: %q", len(lines), output.String())
+	}
+	cell := "\x1b[38;2;255;0;0m\x1b[48;2;0;0;255m▀"
+	if lines[0] != cell+cell+"\x1b[0m" {
+		t.Errorf("unexpected first line %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "\x1b[38;2;255;255;255m\x1b[49m▀") {
+		t.Errorf("expected the last row without a background, got %q", lines[1])
+	}
+}
+
+func TestWriteSixel(t *testing.T) {
+	// 8x7 red with a blue bottom row, two bands
+	pixels := make([][]color.Color, 8)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, 7)
+		for y := range pixels[x] {
+			pixels[x][y] = previewRed
+		}
+		pixels[x][6] = previewBlue
+	}
+	var output bytes.Buffer
+	if err := writeSixel(&output, pixels); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "\x1bPq\"1;1;8;7" +
+		"#5;2;0;0;100#180;2;100;0;0" +
+		"#180!8~-" +
+		"#5!8@-" +
+		"\x1b\\\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
+
+func TestWriteKitty(t *testing.T) {
+	var output bytes.Buffer
+	if err := writeKitty(&output, createGray2DArray()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(output.String(), "\x1b_Ga=T,f=100,m=0;iVBORw0KGgo") || !strings.HasSuffix(output.String(), "\x1b\\\n") {
+		t.Errorf("unexpected kitty output %q", output.String())
+	}
+
+	// Large images are split into chunks
+	pixels := make([][]color.Color, 200)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, 200)
+		for y := range pixels[x] {
+			pixels[x][y] = color.RGBA{uint8(x), uint8(y), uint8(x * y), 255}
+		}
+	}
+	output.Reset()
+	writeKitty(&output, pixels)
+	if !strings.HasPrefix(output.String(), "\x1b_Ga=T,f=100,m=1;") || !strings.Contains(output.String(), "\x1b_Gm=0;") {
+		t.Errorf("expected chunked output")
+	}
+}
+
+func TestParsePreviewParameters(t *testing.T) {
+	params, err := parseParameters([]string{"-i", "in.png", "-o", "out.png", "--preview", "-preview-mode", "sixel", "-preview-width", "60"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := PreviewSettings{enabled: true, mode: "sixel", width: 60}
+	if params.preview != expected {
+		t.Errorf("expected %+v, got %+v", expected, params.preview)
+	}
+
+	for _, args := range [][]string{
+		{"-i", "in.png", "-o", "out.png", "-preview-mode", "png"},
+		{"-i", "in.png", "-o", "out.png", "-preview-width", "0"},
+	} {
+		if _, err := parseParameters(args); exitCodeForError(err) != exitInvalidParameter {
+			t.Errorf("%v: expected an invalid parameter error, got %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const proxyPrefix = "/t/"
+const defaultCacheMB = 256
+
+// ProxyRequest is a parsed proxy URL such as /t/gg,r,p10/q80/photos/cat.jpg.
+// The first segment is the comma separated pipeline of CLI flags without the
+// dash, with values after a colon (temp:3200), or _ for no transformations.
+// Option segments follow: qNN sets the JPEG quality and f:png the format.
+// The rest is the image path below the root directory.
+type ProxyRequest struct {
+	args    []string
+	quality int
+	format  string
+	source  string
+}
+
+func parseProxyPath(urlPath string) (ProxyRequest, error) {
+	proxyRequest := ProxyRequest{quality: 90}
+	segments := strings.Split(strings.TrimPrefix(urlPath, proxyPrefix), "/")
+	if len(segments) < 2 {
+		return proxyRequest, &InvalidParameterError{Err: errors.New("proxy path must be /t/<pipeline>/[options/]<image path>")}
+	}
+
+	if segments[0] != "_" {
+		for _, item := range strings.Split(segments[0], ",") {
+			if item == "" {
+				continue
+			}
+			flag, value, hasValue := strings.Cut(item, ":")
+			proxyRequest.args = append(proxyRequest.args, "-"+flag)
+			if hasValue {
+				proxyRequest.args = append(proxyRequest.args, value)
+			}
+		}
+	}
+
+	rest := segments[1:]
+	for len(rest) > 1 {
+		option := rest[0]
+		if quality, err := strconv.Atoi(strings.TrimPrefix(option, "q")); strings.HasPrefix(option, "q") && err == nil {
+			if quality < 1 || quality > 100 {
+				return proxyRequest, &InvalidParameterError{Err: fmt.Errorf("invalid quality: %v", option)}
+			}
+			proxyRequest.quality = quality
+		} else if value, ok := strings.CutPrefix(option, "f:"); ok {
+			format, err := parseImageFormat(value)
+			if err != nil {
+				return proxyRequest, &InvalidParameterError{Err: err}
+			}
+			proxyRequest.format = format
+		} else {
+			break
+		}
+		rest = rest[1:]
+	}
+
+	// Cleaning from the root keeps the path inside the root directory
+	proxyRequest.source = strings.TrimPrefix(path.Clean("/"+strings.Join(rest, "/")), "/")
+	if proxyRequest.source == "" {
+		return proxyRequest, &InvalidParameterError{Err: errors.New("missing image path")}
+	}
+	return proxyRequest, nil
+}
+
+// proxyCacheKey addresses a result by the source content and everything that
+// changes the output, so editing the source or the URL never serves a stale
+// image.
+func proxyCacheKey(source []byte, proxyRequest ProxyRequest, format string) string {
+	sourceHash := sha256.Sum256(source)
+	keyHash := sha256.New()
+	fmt.Fprintf(keyHash, "%x\n%v\n%v\n%v", sourceHash, strings.Join(proxyRequest.args, "\x00"), proxyRequest.quality, format)
+	return hex.EncodeToString(keyHash.Sum(nil))
+}
+
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(candidate), "W/"))
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func handleProxy(serveParams ServeParameters, cache *DiskCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSONStatus(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "use GET to fetch an image", Code: "method"})
+			return
+		}
+
+		proxyRequest, err := parseProxyPath(r.URL.Path)
+		if err == nil {
+			err = checkServerPipeline(proxyRequest.args)
+		}
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+
+		params, err := parseParameters(append([]string{"-i", proxyRequest.source, "-o", streamPath}, proxyRequest.args...))
+		if err == nil && params.showHelp {
+			err = &InvalidParameterError{Flag: "-h", Err: errors.New("help is not available in server mode")}
+		}
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+
+		sourcePath := filepath.Join(serveParams.rootDir, filepath.FromSlash(proxyRequest.source))
+		source, err := os.ReadFile(sourcePath)
+		if err != nil {
+			writeJSONError(w, &IOError{Path: proxyRequest.source, Err: err})
+			return
+		}
+
+		format := proxyRequest.format
+		if format == "" {
+			_, format, err = image.DecodeConfig(bytes.NewReader(source))
+			if err != nil {
+				writeJSONError(w, &DecodeError{Path: proxyRequest.source, Err: err})
+				return
+			}
+		}
+		if _, ok := imageContentTypes[format]; !ok {
+			format = "png"
+		}
+
+		key := proxyCacheKey(source, proxyRequest, format)
+		etag := "\"" + key + "\""
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		var result []byte
+		cacheStatus := "MISS"
+		if cache != nil {
+			if data, _, ok := cache.Get(key); ok {
+				result = data
+				cacheStatus = "HIT"
+			}
+		}
+
+		if result == nil {
+			img, _, err := decodeImageWithLimit(bytes.NewReader(source), proxyRequest.source, serveParams.maxPixels)
+			if err != nil {
+				writeJSONError(w, err)
+				return
+			}
+			bounds := img.Bounds()
+			if err := checkPipelineCost(bounds.Dx(), bounds.Dy(), params, serveParams.maxPixels); err != nil {
+				writeJSONError(w, err)
+				return
+			}
+			pixels, err := transformImage(img, params)
+			if err != nil {
+				writeJSONError(w, err)
+				return
+			}
+
+			var encoded bytes.Buffer
+			if err := encodeImageWithQuality(&encoded, pixels, format, "response", proxyRequest.quality); err != nil {
+				writeJSONError(w, err)
+				return
+			}
+			result = encoded.Bytes()
+
+			if cache != nil {
+				if err := cache.Put(key, format, result); err != nil {
+					// The image is still good, only the cache is missing out
+					log.Printf("Could not cache %v: %v", proxyRequest.source, err)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", imageContentTypes[format])
+		w.Header().Set("Content-Length", strconv.Itoa(len(result)))
+		w.Header().Set("X-Cache", cacheStatus)
+		if r.Method == http.MethodGet {
+			w.Write(result)
+		}
+	}
+}
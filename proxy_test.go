@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseProxyPath(t *testing.T) {
+	proxyRequest, err := parseProxyPath("/t/gg,temp:3200,p10/q80/f:png/photos/../cat.jpg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := ProxyRequest{args: []string{"-gg", "-temp", "3200", "-p10"}, quality: 80, format: "png", source: "cat.jpg"}
+	if !reflect.DeepEqual(proxyRequest, expected) {
+		t.Errorf("expected %+v, got %+v", expected, proxyRequest)
+	}
+
+	proxyRequest, err = parseProxyPath("/t/_/../../etc/passwd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if proxyRequest.args != nil || proxyRequest.source != "etc/passwd" {
+		t.Errorf("expected the path to stay below the root, got %+v", proxyRequest)
+	}
+
+	for _, urlPath := range []string{"/t/gg", "/t/gg/q80/", "/t/gg/q0/cat.jpg", "/t/gg/f:webp/cat.jpg"} {
+		if _, err := parseProxyPath(urlPath); exitCodeForError(err) != exitInvalidParameter {
+			t.Errorf("%v: expected an invalid parameter error, got %v", urlPath, err)
+		}
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	if !etagMatches(`"a", W/"b"`, `"b"`) || !etagMatches("*", `"b"`) {
+		t.Errorf("expected a match")
+	}
+	if etagMatches(`"a"`, `"b"`) || etagMatches("", `"b"`) {
+		t.Errorf("expected no match")
+	}
+}
+
+func newTestProxy(t *testing.T) (http.Handler, *DiskCache) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "gray.png"), encodeTestPng(t), 0644); err != nil {
+		t.Fatalf("could not write test image: %v", err)
+	}
+	cache, err := NewDiskCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	serveParams := getDefaultServeParameters()
+	serveParams.rootDir = root
+	return newServeHandler(serveParams, cache), cache
+}
+
+func getProxy(handler http.Handler, target string, ifNoneMatch string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	if ifNoneMatch != "" {
+		request.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestProxyCachesAndRevalidates(t *testing.T) {
+	handler, cache := newTestProxy(t)
+
+	first := getProxy(handler, "/t/g,p10/gray.png", "")
+	if first.Code != http.StatusOK || first.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("expected a cache miss, got %v %v: %v", first.Code, first.Header().Get("X-Cache"), first.Body.String())
+	}
+	if first.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("expected the input format, got %v", first.Header().Get("Content-Type"))
+	}
+	if _, err := png.Decode(bytes.NewReader(first.Body.Bytes())); err != nil {
+		t.Errorf("expected a PNG response: %v", err)
+	}
+	if cache.Size() != int64(first.Body.Len()) {
+		t.Errorf("expected the result to be cached, cache size %v", cache.Size())
+	}
+
+	second := getProxy(handler, "/t/g,p10/gray.png", "")
+	if second.Header().Get("X-Cache") != "HIT" || !bytes.Equal(first.Body.Bytes(), second.Body.Bytes()) {
+		t.Errorf("expected the same image from the cache, got %v", second.Header().Get("X-Cache"))
+	}
+
+	etag := first.Header().Get("ETag")
+	if etag == "" || etag != second.Header().Get("ETag") {
+		t.Fatalf("expected a stable ETag, got %v and %v", etag, second.Header().Get("ETag"))
+	}
+	notModified := getProxy(handler, "/t/g,p10/gray.png", etag)
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Errorf("expected 304 without a body, got %v", notModified.Code)
+	}
+
+	// Another pipeline is another result
+	other := getProxy(handler, "/t/g/gray.png", etag)
+	if other.Code != http.StatusOK || other.Header().Get("ETag") == etag {
+		t.Errorf("expected a different result, got %v %v", other.Code, other.Header().Get("ETag"))
+	}
+}
+
+func TestProxyOptions(t *testing.T) {
+	handler, _ := newTestProxy(t)
+
+	recorder := getProxy(handler, "/t/_/q50/f:jpeg/gray.png", "")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("expected a JPEG, got %v %v: %v", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body.String())
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(recorder.Body.Bytes())); err != nil {
+		t.Errorf("expected a JPEG response: %v", err)
+	}
+}
+
+func TestProxyErrors(t *testing.T) {
+	handler, _ := newTestProxy(t)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		code   string
+	}{
+		{"Missing", "/t/g/missing.png", http.StatusNotFound, "not_found"},
+		{"Unknown", "/t/nope/gray.png", http.StatusBadRequest, "unknown_transform"},
+		{"Forbidden", "/t/overlay:x.png/gray.png", http.StatusBadRequest, "invalid_parameter"},
+		{"TooLarge", "/t/u10,u10,u10/gray.png", http.StatusRequestEntityTooLarge, "too_large"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := getProxy(handler, test.target, "")
+			if recorder.Code != test.status {
+				t.Fatalf("expected %v, got %v: %v", test.status, recorder.Code, recorder.Body.String())
+			}
+			if test.code != "" {
+				if response := decodeErrorResponse(t, recorder); response.Code != test.code {
+					t.Errorf("expected code %v, got %v", test.code, response.Code)
+				}
+			}
+		})
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/t/g/gray.png", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %v", recorder.Code)
+	}
+}
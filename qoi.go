@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+const qoiMagic = "qoif"
+
+// QOI chunk tags.  The 2-bit tags are in the top bits of the first byte, the
+// 8-bit RGB and RGBA tags take the whole byte.
+const (
+	qoiOpIndex = 0x00
+	qoiOpDiff  = 0x40
+	qoiOpLuma  = 0x80
+	qoiOpRun   = 0xc0
+	qoiOpRGB   = 0xfe
+	qoiOpRGBA  = 0xff
+	qoiMask2   = 0xc0
+)
+
+var qoiEndMarker = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+func init() {
+	image.RegisterFormat("qoi", qoiMagic, decodeQOI, decodeQOIConfig)
+}
+
+func qoiHash(pixel color.NRGBA) int {
+	return (int(pixel.R)*3 + int(pixel.G)*5 + int(pixel.B)*7 + int(pixel.A)*11) % 64
+}
+
+// readQOIHeader reads the 14 byte header: magic, width, height, channels and
+// colorspace.
+func readQOIHeader(reader io.Reader) (int, int, error) {
+	header := make([]byte, 14)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, 0, err
+	}
+	if string(header[:4]) != qoiMagic {
+		return 0, 0, errors.New("qoi: invalid magic")
+	}
+	width := int(binary.BigEndian.Uint32(header[4:]))
+	height := int(binary.BigEndian.Uint32(header[8:]))
+	if !validCodecSize(width, height) {
+		return 0, 0, fmt.Errorf("qoi: invalid size %vx%v", width, height)
+	}
+	if header[12] != 3 && header[12] != 4 {
+		return 0, 0, fmt.Errorf("qoi: invalid channel count %v", header[12])
+	}
+	return width, height, nil
+}
+
+func decodeQOIConfig(r io.Reader) (image.Config, error) {
+	width, height, err := readQOIHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: width, Height: height}, nil
+}
+
+func decodeQOI(r io.Reader) (image.Image, error) {
+	reader := bufio.NewReader(r)
+	width, height, err := readQOIHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var seen [64]color.NRGBA
+	pixel := color.NRGBA{0, 0, 0, 255}
+	run := 0
+	truncated := func(err error) error {
+		return fmt.Errorf("qoi: truncated data: %w", err)
+	}
+
+	for offset := 0; offset < len(img.Pix); offset += 4 {
+		if run > 0 {
+			run--
+		} else {
+			tag, err := reader.ReadByte()
+			if err != nil {
+				return nil, truncated(err)
+			}
+
+			switch {
+			case tag == qoiOpRGB || tag == qoiOpRGBA:
+				values := make([]byte, 3+int(tag-qoiOpRGB))
+				if _, err := io.ReadFull(reader, values); err != nil {
+					return nil, truncated(err)
+				}
+				pixel.R, pixel.G, pixel.B = values[0], values[1], values[2]
+				if tag == qoiOpRGBA {
+					pixel.A = values[3]
+				}
+			case tag&qoiMask2 == qoiOpIndex:
+				pixel = seen[tag]
+			case tag&qoiMask2 == qoiOpDiff:
+				pixel.R += (tag>>4)&0x03 - 2
+				pixel.G += (tag>>2)&0x03 - 2
+				pixel.B += tag&0x03 - 2
+			case tag&qoiMask2 == qoiOpLuma:
+				next, err := reader.ReadByte()
+				if err != nil {
+					return nil, truncated(err)
+				}
+				greenDiff := tag&0x3f - 32
+				pixel.R += greenDiff - 8 + (next>>4)&0x0f
+				pixel.G += greenDiff
+				pixel.B += greenDiff - 8 + next&0x0f
+			default:
+				run = int(tag & 0x3f)
+			}
+			seen[qoiHash(pixel)] = pixel
+		}
+		copy(img.Pix[offset:], []byte{pixel.R, pixel.G, pixel.B, pixel.A})
+	}
+	return img, nil
+}
+
+// encodeQOI writes the image as 4 channel sRGB QOI.
+func encodeQOI(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	out := bufio.NewWriter(w)
+
+	header := []byte(qoiMagic)
+	header = binary.BigEndian.AppendUint32(header, uint32(bounds.Dx()))
+	header = binary.BigEndian.AppendUint32(header, uint32(bounds.Dy()))
+	header = append(header, 4, 0)
+	out.Write(header)
+
+	var seen [64]color.NRGBA
+	previous := color.NRGBA{0, 0, 0, 255}
+	run := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			last := x == bounds.Max.X-1 && y == bounds.Max.Y-1
+
+			if pixel == previous {
+				run++
+				if run == 62 || last {
+					out.WriteByte(qoiOpRun | byte(run-1))
+					run = 0
+				}
+				continue
+			}
+			if run > 0 {
+				out.WriteByte(qoiOpRun | byte(run-1))
+				run = 0
+			}
+
+			hash := qoiHash(pixel)
+			switch {
+			case seen[hash] == pixel:
+				out.WriteByte(qoiOpIndex | byte(hash))
+			case pixel.A != previous.A:
+				out.Write([]byte{qoiOpRGBA, pixel.R, pixel.G, pixel.B, pixel.A})
+			default:
+				// The differences wrap around like the decoder's byte arithmetic
+				dr := int8(pixel.R - previous.R)
+				dg := int8(pixel.G - previous.G)
+				db := int8(pixel.B - previous.B)
+				drg := dr - dg
+				dbg := db - dg
+				switch {
+				case dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1:
+					out.WriteByte(qoiOpDiff | byte(dr+2)<<4 | byte(dg+2)<<2 | byte(db+2))
+				case dg >= -32 && dg <= 31 && drg >= -8 && drg <= 7 && dbg >= -8 && dbg <= 7:
+					out.Write([]byte{qoiOpLuma | byte(dg+32), byte(drg+8)<<4 | byte(dbg+8)})
+				default:
+					out.Write([]byte{qoiOpRGB, pixel.R, pixel.G, pixel.B})
+				}
+			}
+			seen[hash] = pixel
+			previous = pixel
+		}
+	}
+
+	out.Write(qoiEndMarker)
+	return out.Flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQOIRoundTrip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 70, 4))
+	for x := 0; x < 70; x++ {
+		// A long run, small and large differences, repeats and alpha changes
+		img.Set(x, 0, color.NRGBA{10, 20, 30, 255})
+		img.Set(x, 1, color.NRGBA{uint8(x), uint8(x + 1), uint8(x * 2), 255})
+		img.Set(x, 2, color.NRGBA{uint8(x * 37), uint8(x * 91), uint8(x * 13), 255})
+		img.Set(x, 3, color.NRGBA{uint8(x % 3 * 100), 0, 0, uint8(x * 3)})
+	}
+
+	var data bytes.Buffer
+	if err := encodeQOI(&data, img); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.HasSuffix(data.Bytes(), qoiEndMarker) {
+		t.Error("expected the end marker")
+	}
+
+	decoded, format, err := image.Decode(bytes.NewReader(data.Bytes()))
+	if err != nil || format != "qoi" {
+		t.Fatalf("expected to decode qoi, got %v %v", format, err)
+	}
+	if decoded.Bounds() != img.Bounds() {
+		t.Fatalf("expected bounds %v, got %v", img.Bounds(), decoded.Bounds())
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 70; x++ {
+			if decoded.At(x, y) != img.At(x, y) {
+				t.Fatalf("pixel %v,%v: expected %v, got %v", x, y, img.At(x, y), decoded.At(x, y))
+			}
+		}
+	}
+}
+
+func TestDecodeQOIErrors(t *testing.T) {
+	var data bytes.Buffer
+	encodeQOI(&data, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	valid := data.Bytes()
+
+	badChannels := bytes.Clone(valid)
+	badChannels[12] = 5
+	huge := bytes.Clone(valid)
+	copy(huge[4:12], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	for name, input := range map[string][]byte{
+		"Magic":     append([]byte("qoix"), valid[4:]...),
+		"Channels":  badChannels,
+		"Size":      huge,
+		"Truncated": valid[:15],
+	} {
+		if _, err := decodeQOI(bytes.NewReader(input)); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
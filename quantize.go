@@ -0,0 +1,136 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// Pixels with less alpha are written with the transparent palette entry.
+const transparentAlpha = 128
+
+// colorBucket sums the pixels that share the top 5 bits of every channel.
+type colorBucket struct {
+	r, g, b int
+	count   int
+}
+
+func (bucket colorBucket) channel(index int) int {
+	switch index {
+	case 0:
+		return bucket.r / bucket.count
+	case 1:
+		return bucket.g / bucket.count
+	}
+	return bucket.b / bucket.count
+}
+
+// medianCutQuantizer builds the palette for the image with median cut,
+// implementing draw.Quantizer for the gif encoder.
+type medianCutQuantizer struct{}
+
+func (quantizer medianCutQuantizer) Quantize(palette color.Palette, img image.Image) color.Palette {
+	return append(palette, MedianCutPalette([]image.Image{img}, cap(palette)-len(palette))...)
+}
+
+// MedianCutPalette picks up to count colors for all the images together.  The
+// colors are grouped into boxes, splitting the box with the widest channel at
+// its median until there are enough boxes, and every box contributes its
+// average color.  A transparent entry comes first when any pixel is
+// transparent.
+func MedianCutPalette(images []image.Image, count int) color.Palette {
+	buckets := make(map[int]*colorBucket)
+	transparent := false
+
+	for _, img := range images {
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				pixel := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				if pixel.A < transparentAlpha {
+					transparent = true
+					continue
+				}
+				key := int(pixel.R>>3)<<10 | int(pixel.G>>3)<<5 | int(pixel.B>>3)
+				bucket, ok := buckets[key]
+				if !ok {
+					bucket = &colorBucket{}
+					buckets[key] = bucket
+				}
+				bucket.r += int(pixel.R)
+				bucket.g += int(pixel.G)
+				bucket.b += int(pixel.B)
+				bucket.count++
+			}
+		}
+	}
+
+	var palette color.Palette
+	if transparent {
+		palette = append(palette, color.RGBA{})
+		count--
+	}
+	if len(buckets) == 0 || count < 1 {
+		return palette
+	}
+
+	var all []colorBucket
+	for _, bucket := range buckets {
+		all = append(all, *bucket)
+	}
+	// Map order is random, keep the palette the same on every run
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].channel(0)<<16|all[i].channel(1)<<8|all[i].channel(2) < all[j].channel(0)<<16|all[j].channel(1)<<8|all[j].channel(2)
+	})
+
+	boxes := [][]colorBucket{all}
+	for len(boxes) < count {
+		widest, channel, widestRange := -1, 0, 0
+		for index, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				low, high := 255, 0
+				for _, bucket := range box {
+					low = min(low, bucket.channel(c))
+					high = max(high, bucket.channel(c))
+				}
+				if high-low > widestRange || widest == -1 {
+					widest, channel, widestRange = index, c, high-low
+				}
+			}
+		}
+		if widest == -1 {
+			break
+		}
+
+		box := boxes[widest]
+		sort.SliceStable(box, func(i, j int) bool { return box[i].channel(channel) < box[j].channel(channel) })
+		total := 0
+		for _, bucket := range box {
+			total += bucket.count
+		}
+		// Split where half of the pixels are on each side, keeping both halves
+		// non-empty
+		split, seen := 1, box[0].count
+		for split < len(box)-1 && seen+box[split].count <= total/2 {
+			seen += box[split].count
+			split++
+		}
+		boxes = append(boxes, box[split:])
+		boxes[widest] = box[:split]
+	}
+
+	for _, box := range boxes {
+		var sum colorBucket
+		for _, bucket := range box {
+			sum.r += bucket.r
+			sum.g += bucket.g
+			sum.b += bucket.b
+			sum.count += bucket.count
+		}
+		palette = append(palette, color.RGBA{uint8(sum.r / sum.count), uint8(sum.g / sum.count), uint8(sum.b / sum.count), 255})
+	}
+	return palette
+}
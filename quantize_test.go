@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMedianCutPalette(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	colors := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {250, 250, 250, 255}}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, colors[y])
+		}
+	}
+
+	palette := MedianCutPalette([]image.Image{img}, 256)
+	if len(palette) != 4 {
+		t.Fatalf("expected one entry per color, got %v", palette)
+	}
+	for _, c := range colors {
+		if palette[palette.Index(c)] != c {
+			t.Errorf("expected %v in the palette %v", c, palette)
+		}
+	}
+
+	// Fewer entries than colors merge the closest ones
+	palette = MedianCutPalette([]image.Image{img}, 2)
+	if len(palette) != 2 {
+		t.Errorf("expected 2 entries, got %v", palette)
+	}
+}
+
+func TestMedianCutPaletteTransparent(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{10, 20, 30, 255})
+	img.Set(1, 0, color.NRGBA{200, 0, 0, 10})
+
+	palette := MedianCutPalette([]image.Image{img}, 256)
+	expected := color.Palette{color.RGBA{}, color.RGBA{10, 20, 30, 255}}
+	if len(palette) != 2 || palette[0] != expected[0] || palette[1] != expected[1] {
+		t.Errorf("expected %v, got %v", expected, palette)
+	}
+}
+
+func TestMedianCutPaletteManyColors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8((x + y) * 2), 255})
+		}
+	}
+
+	palette := MedianCutPalette([]image.Image{img}, 16)
+	if len(palette) != 16 {
+		t.Fatalf("expected 16 entries, got %v", len(palette))
+	}
+	// Every pixel should be reasonably close to its palette color
+	for y := 0; y < 64; y += 7 {
+		for x := 0; x < 64; x += 7 {
+			original := img.RGBAAt(x, y)
+			nearest := palette.Convert(original).(color.RGBA)
+			if abs(int(original.R)-int(nearest.R)) > 64 || abs(int(original.G)-int(nearest.G)) > 64 {
+				t.Errorf("pixel %v,%v: %v is far from %v", x, y, original, nearest)
+			}
+		}
+	}
+}
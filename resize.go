@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"math"
+)
+
+type resizeWeight struct {
+	index  int
+	weight float64
+}
+
+// ResizePixels scales the pixel array to the given size.  Shrinking averages
+// every source pixel covered by a destination pixel, enlarging interpolates
+// bilinearly between the nearest source pixels.
+func ResizePixels(originalPixels [][]color.Color, width int, height int) ([][]color.Color, error) {
+	if width < 1 || height < 1 {
+		return nil, errors.New("resize dimensions must be at least 1")
+	}
+	if len(originalPixels) == 0 || len(originalPixels[0]) == 0 {
+		return nil, errors.New("cannot resize an empty pixel array")
+	}
+
+	srcWidth := len(originalPixels)
+	srcHeight := len(originalPixels[0])
+	xWeights := calcResizeWeights(srcWidth, width)
+	yWeights := calcResizeWeights(srcHeight, height)
+
+	// Work on premultiplied values so transparent pixels don't bleed color
+	source := make([][][4]float64, srcWidth)
+	for xIndex := range source {
+		if len(originalPixels[xIndex]) != srcHeight {
+			return nil, errors.New("cannot resize a pixel array with uneven columns")
+		}
+		source[xIndex] = make([][4]float64, srcHeight)
+		for yIndex := range source[xIndex] {
+			r, g, b, a := originalPixels[xIndex][yIndex].RGBA()
+			source[xIndex][yIndex] = [4]float64{float64(r), float64(g), float64(b), float64(a)}
+		}
+	}
+
+	horizontal := make([][][4]float64, width)
+	for xIndex := range horizontal {
+		horizontal[xIndex] = make([][4]float64, srcHeight)
+		for yIndex := 0; yIndex < srcHeight; yIndex++ {
+			var total [4]float64
+			for _, w := range xWeights[xIndex] {
+				for channel := range total {
+					total[channel] += source[w.index][yIndex][channel] * w.weight
+				}
+			}
+			horizontal[xIndex][yIndex] = total
+		}
+	}
+
+	newPixels := make([][]color.Color, width)
+	for xIndex := range newPixels {
+		newPixels[xIndex] = make([]color.Color, height)
+		for yIndex := range newPixels[xIndex] {
+			var total [4]float64
+			for _, w := range yWeights[yIndex] {
+				for channel := range total {
+					total[channel] += horizontal[xIndex][w.index][channel] * w.weight
+				}
+			}
+			newPixels[xIndex][yIndex] = color.RGBAModel.Convert(color.RGBA64{
+				toUint16(total[0]), toUint16(total[1]), toUint16(total[2]), toUint16(total[3]),
+			})
+		}
+	}
+
+	return newPixels, nil
+}
+
+// calcResizeWeights lists, for every destination index, the source indexes
+// that contribute to it and how much.  The weights for each index sum to 1.
+func calcResizeWeights(srcSize int, dstSize int) [][]resizeWeight {
+	weights := make([][]resizeWeight, dstSize)
+	scale := float64(srcSize) / float64(dstSize)
+
+	for dstIndex := range weights {
+		if scale > 1 {
+			start := float64(dstIndex) * scale
+			end := start + scale
+			for srcIndex := int(start); srcIndex < srcSize && float64(srcIndex) < end; srcIndex++ {
+				overlap := math.Min(end, float64(srcIndex+1)) - math.Max(start, float64(srcIndex))
+				if overlap > 0 {
+					weights[dstIndex] = append(weights[dstIndex], resizeWeight{srcIndex, overlap / scale})
+				}
+			}
+		} else {
+			center := (float64(dstIndex)+0.5)*scale - 0.5
+			left := int(math.Floor(center))
+			fraction := center - float64(left)
+			weights[dstIndex] = []resizeWeight{
+				{min(max(left, 0), srcSize-1), 1 - fraction},
+				{min(max(left+1, 0), srcSize-1), fraction},
+			}
+		}
+	}
+	return weights
+}
+
+func toUint16(value float64) uint16 {
+	return uint16(math.Round(min(max(value, 0), math.MaxUint16)))
+}
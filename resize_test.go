@@ -0,0 +1,105 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+type ResizeTest struct {
+	name      string
+	input     [][]color.Color
+	width     int
+	height    int
+	expected  [][]color.Color
+	expectErr bool
+	errText   string
+}
+
+func TestResizePixels(t *testing.T) {
+	var tests = []ResizeTest{
+		{"Empty", [][]color.Color{}, 2, 2, nil, true, "cannot resize an empty pixel array"},
+		{"BadWidth", [][]color.Color{{testWhite.color}}, 0, 2, nil, true, "resize dimensions must be at least 1"},
+		{"Uneven", [][]color.Color{{testWhite.color}, {testWhite.color, testBlack.color}}, 1, 1, nil, true, "uneven columns"},
+		{"SameSize", [][]color.Color{{testWhite.color, testBlack.color}}, 1, 2, [][]color.Color{{testWhite.color, testBlack.color}}, false, ""},
+		{"Shrink", [][]color.Color{
+			{testWhite.color, testWhite.color},
+			{testBlack.color, testBlack.color},
+		}, 1, 1, [][]color.Color{{SetTestColor(128, 128, 128).color}}, false, ""},
+		{"ShrinkUneven", [][]color.Color{
+			{testRed.color, testRed.color},
+			{testRed.color, testRed.color},
+			{testBlue.color, testBlue.color},
+			{testBlue.color, testBlue.color},
+		}, 2, 1, [][]color.Color{{testRed.color}, {testBlue.color}}, false, ""},
+		{"GrowUniform", [][]color.Color{{testRed.color}}, 3, 2, [][]color.Color{
+			{testRed.color, testRed.color},
+			{testRed.color, testRed.color},
+			{testRed.color, testRed.color},
+		}, false, ""},
+		{"GrowInterpolates", [][]color.Color{{testBlack.color}, {testWhite.color}}, 4, 1, [][]color.Color{
+			{testBlack.color},
+			{SetTestColor(64, 64, 64).color},
+			{SetTestColor(191, 191, 191).color},
+			{testWhite.color},
+		}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ResizePixels(tt.input, tt.width, tt.height)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			if err != nil && tt.expectErr {
+				if !strings.Contains(err.Error(), tt.errText) {
+					t.Errorf("Test %s returned incorrect error. Want: %s. Got: %v", tt.name, tt.errText, err)
+				}
+			}
+
+			if err == nil && tt.expectErr {
+				t.Errorf("Test %s should have returned an error, but did not", tt.name)
+			}
+
+			if err == nil && !tt.expectErr {
+				if len(tt.expected) != len(result) || len(tt.expected[0]) != len(result[0]) {
+					t.Fatalf("Test %s returned invalid size: Expect: %vx%v. Got: %vx%v", tt.name, len(tt.expected), len(tt.expected[0]), len(result), len(result[0]))
+				}
+
+				for xIndex := 0; xIndex < len(tt.expected); xIndex++ {
+					for yIndex := 0; yIndex < len(tt.expected[xIndex]); yIndex++ {
+						if tt.expected[xIndex][yIndex] != result[xIndex][yIndex] {
+							t.Errorf("Test %s returned invalid pixel result at %d,%d: Expect: %v. Got: %v", tt.name, xIndex, yIndex, tt.expected[xIndex][yIndex], result[xIndex][yIndex])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCalcResizeWeights(t *testing.T) {
+	sizes := [][2]int{{10, 3}, {3, 10}, {7, 7}, {1, 5}, {5, 1}}
+
+	for _, size := range sizes {
+		weights := calcResizeWeights(size[0], size[1])
+		if len(weights) != size[1] {
+			t.Errorf("calcResizeWeights(%v, %v) returned %v entries", size[0], size[1], len(weights))
+		}
+
+		for dstIndex, entry := range weights {
+			total := 0.0
+			for _, w := range entry {
+				if w.index < 0 || w.index >= size[0] {
+					t.Errorf("calcResizeWeights(%v, %v) used invalid source index %v", size[0], size[1], w.index)
+				}
+				total += w.weight
+			}
+			if math.Abs(total-1) > 1e-9 {
+				t.Errorf("calcResizeWeights(%v, %v) weights for %v sum to %v", size[0], size[1], dstIndex, total)
+			}
+		}
+	}
+}
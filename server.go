@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultServeAddress = ":8080"
+const defaultMaxUploadMB = 20
+const defaultServeMaxPixels = 40_000_000
+
+// Comparisons a Voronoi mosaic or the masks may make in server mode.  Every
+// pixel is compared with every Voronoi cell and every polygon point, which
+// allows 500 cells on 4 megapixels.
+const serveMaxWork = 2_000_000_000
+
+// Time allowed to read a request and to write its response.
+const serveReadTimeout = 30 * time.Second
+const serveWriteTimeout = 2 * time.Minute
+
+var imageContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"bmp":  "image/bmp",
+	"tiff": "image/tiff",
+	"pbm":  "image/x-portable-bitmap",
+	"pgm":  "image/x-portable-graymap",
+	"ppm":  "image/x-portable-pixmap",
+	"pam":  "image/x-portable-arbitrarymap",
+	"qoi":  "image/qoi",
+	"ico":  "image/vnd.microsoft.icon",
+}
+
+// Flags that read files on the server are refused, only the uploaded image
+// can be used.
+var serverForbiddenFlags = map[string]bool{
+	"-i":         true,
+	"-o":         true,
+	"-bg":        true,
+	"-overlay":   true,
+	"-text-font": true,
+}
+
+type ServeParameters struct {
+	address        string
+	maxUploadBytes int64
+	maxPixels      int64
+	rootDir        string
+	cacheDir       string
+	cacheBytes     int64
+	showHelp       bool
+}
+
+// TransformRequest is the JSON body accepted by /transform.  The image is
+// base64 encoded and the pipeline lists CLI flags and values in order.
+type TransformRequest struct {
+	Image    []byte   `json:"image"`
+	Pipeline []string `json:"pipeline"`
+	Format   string   `json:"format"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+func getDefaultServeParameters() ServeParameters {
+	return ServeParameters{
+		address:        defaultServeAddress,
+		maxUploadBytes: defaultMaxUploadMB << 20,
+		maxPixels:      defaultServeMaxPixels,
+		cacheBytes:     defaultCacheMB << 20,
+	}
+}
+
+func parseServeParameters(args []string) (ServeParameters, error) {
+	serveParams := getDefaultServeParameters()
+	nextValueFlag := ""
+
+	for _, a := range args {
+		if nextValueFlag != "" {
+			switch nextValueFlag {
+			case "-addr":
+				serveParams.address = a
+			case "-root":
+				serveParams.rootDir = a
+			case "-cache-dir":
+				serveParams.cacheDir = a
+			case "-max-upload", "-max-pixels", "-cache-size":
+				number, err := strconv.ParseInt(a, 10, 64)
+				if err != nil || number < 1 {
+					return serveParams, fmt.Errorf("invalid value for %v: %v", nextValueFlag, a)
+				}
+				switch nextValueFlag {
+				case "-max-upload":
+					serveParams.maxUploadBytes = number << 20
+				case "-cache-size":
+					serveParams.cacheBytes = number << 20
+				default:
+					serveParams.maxPixels = number
+				}
+			}
+			nextValueFlag = ""
+			continue
+		}
+
+		switch a {
+		case "-addr", "-max-upload", "-max-pixels", "-root", "-cache-dir", "-cache-size":
+			nextValueFlag = a
+		case "-h", "-help":
+			return ServeParameters{showHelp: true}, nil
+		default:
+			return serveParams, fmt.Errorf("unknown serve flag: %v", a)
+		}
+	}
+
+	if nextValueFlag != "" {
+		return serveParams, fmt.Errorf("missing value for flag: %v", nextValueFlag)
+	}
+	if serveParams.cacheDir != "" && serveParams.rootDir == "" {
+		return serveParams, errors.New("-cache-dir needs -root")
+	}
+	if serveParams.cacheDir != "" && isPathInside(serveParams.cacheDir, serveParams.rootDir) {
+		return serveParams, errors.New("-cache-dir cannot be inside -root, the cache evicts files from it")
+	}
+	return serveParams, nil
+}
+
+// isPathInside reports whether the path is the directory or below it.
+func isPathInside(path string, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	relative, err := filepath.Rel(absDir, absPath)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// parsePipelineQuery turns a query string such as gr&p10&temp=3200 into the
+// CLI arguments -gr -p10 -temp 3200, keeping the order of the query.
+func parsePipelineQuery(rawQuery string) ([]string, error) {
+	var args []string
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(part, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			return nil, &InvalidParameterError{Err: fmt.Errorf("invalid query: %v", part)}
+		}
+		args = append(args, "-"+strings.TrimLeft(key, "-"))
+
+		if hasValue {
+			value, err = url.QueryUnescape(value)
+			if err != nil {
+				return nil, &InvalidParameterError{Err: fmt.Errorf("invalid query: %v", part)}
+			}
+			args = append(args, value)
+		}
+	}
+	return args, nil
+}
+
+func checkServerPipeline(args []string) error {
+	for index, a := range args {
+		forbidden := serverForbiddenFlags[a]
+		if a == "-m" && index+1 < len(args) && strings.HasPrefix(args[index+1], "image:") {
+			forbidden = true
+		}
+		if forbidden {
+			return &InvalidParameterError{Flag: a, Err: fmt.Errorf("flag not allowed in server mode: %v", a)}
+		}
+	}
+	return nil
+}
+
+// readTransformRequest collects the image and pipeline from a raw image body,
+// a multipart form with an image file or a JSON TransformRequest.
+func readTransformRequest(r *http.Request, maxUploadBytes int64) ([]byte, []string, string, error) {
+	args, err := parsePipelineQuery(r.URL.RawQuery)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	body := http.MaxBytesReader(nil, r.Body, maxUploadBytes)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/json":
+		var request TransformRequest
+		if err := json.NewDecoder(body).Decode(&request); err != nil {
+			return nil, nil, "", &InvalidParameterError{Err: fmt.Errorf("invalid JSON body: %w", err)}
+		}
+		args = append(args, request.Pipeline...)
+		if request.Format != "" {
+			args = append(args, "-format", request.Format)
+		}
+		return request.Image, args, "upload", nil
+
+	case "multipart/form-data":
+		r.Body = body
+		if err := r.ParseMultipartForm(maxUploadBytes); err != nil {
+			return nil, nil, "", &IOError{Path: "upload", Err: err}
+		}
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			return nil, nil, "", &InvalidParameterError{Flag: "image", Err: errors.New("missing image file in form field image")}
+		}
+		defer file.Close()
+
+		if pipeline := r.FormValue("pipeline"); pipeline != "" {
+			var formArgs []string
+			if err := json.Unmarshal([]byte(pipeline), &formArgs); err != nil {
+				return nil, nil, "", &InvalidParameterError{Flag: "pipeline", Err: fmt.Errorf("pipeline must be a JSON array of flags: %w", err)}
+			}
+			args = append(args, formArgs...)
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, nil, "", &IOError{Path: header.Filename, Err: err}
+		}
+		return data, args, header.Filename, nil
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, "", &IOError{Path: "upload", Err: err}
+	}
+	return data, args, "upload", nil
+}
+
+func httpStatusForError(err error) (int, string) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) || errors.Is(err, errImageTooLarge) {
+		return http.StatusRequestEntityTooLarge, "too_large"
+	}
+
+	switch exitCodeForError(err) {
+	case exitInvalidParameter:
+		return http.StatusBadRequest, "invalid_parameter"
+	case exitUnknownTransform:
+		return http.StatusBadRequest, "unknown_transform"
+	case exitDecode:
+		return http.StatusUnsupportedMediaType, "decode"
+	case exitIO:
+		if errors.Is(err, fs.ErrNotExist) {
+			return http.StatusNotFound, "not_found"
+		}
+		return http.StatusBadRequest, "io"
+	case exitEncode:
+		return http.StatusInternalServerError, "encode"
+	}
+	return http.StatusUnprocessableEntity, "transform"
+}
+
+func writeJSONError(w http.ResponseWriter, err error) {
+	status, code := httpStatusForError(err)
+	writeJSONStatus(w, status, ErrorResponse{Error: err.Error(), Code: code})
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, response ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func handleTransform(serveParams ServeParameters) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONStatus(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "use POST to transform an image", Code: "method"})
+			return
+		}
+
+		data, args, name, err := readTransformRequest(r, serveParams.maxUploadBytes)
+		if err == nil {
+			err = checkServerPipeline(args)
+		}
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+
+		params, err := parseParameters(append([]string{"-i", streamPath, "-o", streamPath}, args...))
+		if err == nil && params.showHelp {
+			err = &InvalidParameterError{Flag: "-h", Err: errors.New("help is not available in server mode")}
+		}
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+		params.options.sourceName = name
+
+		img, inputFormat, err := decodeImageWithLimit(bytes.NewReader(data), name, serveParams.maxPixels)
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+
+		bounds := img.Bounds()
+		if err := checkPipelineCost(bounds.Dx(), bounds.Dy(), params, serveParams.maxPixels); err != nil {
+			writeJSONError(w, err)
+			return
+		}
+
+		pixels, err := transformImage(img, params)
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+
+		format := params.outputFormat
+		if format == "" {
+			format = inputFormat
+		}
+		if _, ok := imageContentTypes[format]; !ok {
+			format = "png"
+		}
+
+		// Encode first so an error can still be reported as JSON
+		var result bytes.Buffer
+		if err := encodeImage(&result, pixels, format, "response"); err != nil {
+			writeJSONError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", imageContentTypes[format])
+		w.Header().Set("Content-Length", strconv.Itoa(result.Len()))
+		w.Write(result.Bytes())
+	}
+}
+
+// newServeHandler registers the endpoints.  The proxy is only served when a
+// root directory is set, the cache may be nil.
+func newServeHandler(serveParams ServeParameters, cache *DiskCache) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/transform", handleTransform(serveParams))
+	if serveParams.rootDir != "" {
+		mux.HandleFunc(proxyPrefix, handleProxy(serveParams, cache))
+	}
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{\"status\":\"ok\"}\n")
+	})
+	return mux
+}
+
+// checkPipelineCost follows the image size through the transformation list
+// and refuses pipelines that grow the image beyond the pixel limit, or build
+// masks or run a Voronoi mosaic on more pixels than the server allows.
+func checkPipelineCost(width int, height int, params Transformation, maxPixels int64) error {
+	// Masks cannot be combined with size changes, so they are built once at
+	// the input size
+	var maskWork int64
+	for _, maskSpec := range params.options.masks {
+		maskWork += max(1, int64(len(maskSpec.values)/2))
+	}
+	if pixels := int64(width) * int64(height); pixels*maskWork > serveMaxWork {
+		return &InvalidParameterError{Flag: "-m",
+			Err: fmt.Errorf("%w: %vx%v pixels is too large for %v masks with %v points", errImageTooLarge, width, height, len(params.options.masks), maskWork)}
+	}
+
+	for step, transformation := range params.transformList {
+		width, height = stepOutputSize(transformation, width, height)
+		pixels := int64(width) * int64(height)
+		if pixels > maxPixels {
+			return &TransformError{Step: step, Transformation: transformation,
+				Err: fmt.Errorf("%w: %vx%v pixels is above the %v pixel limit", errImageTooLarge, width, height, maxPixels)}
+		}
+		if cells, ok := voronoiCellCounts[transformation]; ok && pixels*int64(cells) > serveMaxWork {
+			return &TransformError{Step: step, Transformation: transformation,
+				Err: fmt.Errorf("%w: %vx%v pixels is too large for %v cells", errImageTooLarge, width, height, cells)}
+		}
+	}
+	return nil
+}
+
+// transformImage runs the transformation list of the parameters on a
+// decoded image.
+func transformImage(img image.Image, params Transformation) ([][]color.Color, error) {
+	pixels, err := CreatePixelArrayFromImage(img)
+	if err != nil {
+		return nil, &DecodeError{Path: params.inputFile, Err: err}
+	}
+	return ProcessListOfTransformationsWithOptions(pixels, params.transformList, params.options)
+}
+
+func showServeHelp() {
+	fmt.Println("imagesTx.exe serve [-addr <host:port>] [-max-upload <MB>] [-max-pixels <count>]")
+	fmt.Println("                   [-root <dir> [-cache-dir <dir>] [-cache-size <MB>]]")
+	fmt.Println("")
+	fmt.Println("Serves the transformations over HTTP.")
+	fmt.Println("")
+	fmt.Printf("  -addr <host:port>     Address to listen on (default %v)\n", defaultServeAddress)
+	fmt.Printf("  -max-upload <MB>      Largest accepted upload (default %v)\n", defaultMaxUploadMB)
+	fmt.Printf("  -max-pixels <count>   Largest image in pixels, before and after every step (default %v)\n", defaultServeMaxPixels)
+	fmt.Println("  -root <dir>           Directory of images served by the /t/ proxy")
+	fmt.Println("  -cache-dir <dir>      Directory outside -root caching proxy results, no cache when not set")
+	fmt.Printf("  -cache-size <MB>      Largest cache size, least recently used results are evicted (default %v)\n", defaultCacheMB)
+	fmt.Println("")
+	fmt.Println("Endpoints:")
+	fmt.Println("  POST /transform  Transform the image in the body.  The body is either the raw image,")
+	fmt.Println("                   a multipart form with an image file field (and optional pipeline field),")
+	fmt.Println("                   or JSON {\"image\": \"<base64>\", \"pipeline\": [\"-gr\", \"-p10\"], \"format\": \"png\"}.")
+	fmt.Println("                   The query string mirrors the CLI flags: /transform?gr&p10&temp=3200&format=png")
+	fmt.Println("  GET  /t/<pipeline>/[options/]<path>")
+	fmt.Println("                   Transform an image below -root.  The pipeline lists the CLI flags without the")
+	fmt.Println("                   dash, separated by commas, with values after a colon, or _ for none.  Options")
+	fmt.Println("                   are q<1-100> for the JPEG quality and f:<format>: /t/gg,temp:3200,p10/q80/f:png/cat.jpg")
+	fmt.Println("                   Responses carry an ETag and honor If-None-Match.")
+	fmt.Println("  GET  /health     Reports that the server is running")
+	fmt.Println("")
+	fmt.Println("Errors are returned as JSON {\"error\": \"...\", \"code\": \"...\"}.  Flags that read files on the server")
+	fmt.Println("(-overlay, -bg, -text-font and image masks) are refused.")
+	fmt.Println("")
+}
+
+func runServe(args []string) error {
+	serveParams, err := parseServeParameters(args)
+	if err != nil {
+		return &InvalidParameterError{Err: err}
+	}
+	if serveParams.showHelp {
+		showServeHelp()
+		return nil
+	}
+
+	var cache *DiskCache
+	if serveParams.cacheDir != "" {
+		cache, err = NewDiskCache(serveParams.cacheDir, serveParams.cacheBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Listening on %v", serveParams.address)
+	server := &http.Server{
+		Addr:         serveParams.address,
+		Handler:      newServeHandler(serveParams, cache),
+		ReadTimeout:  serveReadTimeout,
+		WriteTimeout: serveWriteTimeout,
+	}
+	err = server.ListenAndServe()
+	if err != nil {
+		return &IOError{Path: serveParams.address, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func encodeTestPng(t *testing.T) []byte {
+	var data bytes.Buffer
+	if err := encodeImage(&data, createGray2DArray(), "png", "test"); err != nil {
+		t.Fatalf("could not encode test image: %v", err)
+	}
+	return data.Bytes()
+}
+
+func postTransform(t *testing.T, handler http.Handler, target string, contentType string, body []byte) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func decodeErrorResponse(t *testing.T, recorder *httptest.ResponseRecorder) ErrorResponse {
+	if recorder.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON error, got %v: %v", recorder.Header().Get("Content-Type"), recorder.Body.String())
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid JSON error: %v", err)
+	}
+	return response
+}
+
+func TestParsePipelineQuery(t *testing.T) {
+	args, err := parsePipelineQuery("gr&p10&text=hello%20world&-temp=3200")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"-gr", "-p10", "-text", "hello world", "-temp", "3200"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	if _, err := parsePipelineQuery("text=%zz"); exitCodeForError(err) != exitInvalidParameter {
+		t.Errorf("expected an invalid parameter error, got %v", err)
+	}
+}
+
+func TestServeRawBody(t *testing.T) {
+	handler := newServeHandler(getDefaultServeParameters(), nil)
+
+	recorder := postTransform(t, handler, "/transform?gr&u2", "image/png", encodeTestPng(t))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected response %v %v: %v", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body.String())
+	}
+	img, err := png.Decode(recorder.Body)
+	if err != nil || img.Bounds().Dx() != 20 {
+		t.Errorf("expected a 20 pixel wide png, got %v %v", img, err)
+	}
+
+	recorder = postTransform(t, handler, "/transform?g&format=jpeg", "", encodeTestPng(t))
+	if recorder.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("expected a jpeg, got %v", recorder.Header().Get("Content-Type"))
+	}
+	if _, err := jpeg.Decode(recorder.Body); err != nil {
+		t.Errorf("response is not a jpeg: %v", err)
+	}
+}
+
+func TestServeJSONBody(t *testing.T) {
+	handler := newServeHandler(getDefaultServeParameters(), nil)
+	body, _ := json.Marshal(TransformRequest{Image: encodeTestPng(t), Pipeline: []string{"-d3"}, Format: "gif"})
+
+	recorder := postTransform(t, handler, "/transform", "application/json", body)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "image/gif" {
+		t.Fatalf("unexpected response %v %v: %v", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body.String())
+	}
+
+	recorder = postTransform(t, handler, "/transform", "application/json", []byte("{"))
+	if recorder.Code != http.StatusBadRequest || decodeErrorResponse(t, recorder).Code != "invalid_parameter" {
+		t.Errorf("expected a bad request for invalid JSON, got %v", recorder.Code)
+	}
+}
+
+func TestServeMultipart(t *testing.T) {
+	handler := newServeHandler(getDefaultServeParameters(), nil)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("image", "photo.png")
+	part.Write(encodeTestPng(t))
+	writer.WriteField("pipeline", `["-u3"]`)
+	writer.Close()
+
+	recorder := postTransform(t, handler, "/transform", writer.FormDataContentType(), body.Bytes())
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected response %v: %v", recorder.Code, recorder.Body.String())
+	}
+	img, err := png.Decode(recorder.Body)
+	if err != nil || img.Bounds().Dx() != 30 {
+		t.Errorf("expected a 30 pixel wide png, got %v %v", img, err)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	serveParams := getDefaultServeParameters()
+	handler := newServeHandler(serveParams, nil)
+
+	var tests = []struct {
+		name   string
+		target string
+		body   []byte
+		status int
+		code   string
+	}{
+		{"UnknownTransform", "/transform?sparkle", encodeTestPng(t), http.StatusBadRequest, "unknown_transform"},
+		{"InvalidValue", "/transform?temp=10", encodeTestPng(t), http.StatusBadRequest, "invalid_parameter"},
+		{"ServerFile", "/transform?overlay=/etc/passwd", encodeTestPng(t), http.StatusBadRequest, "invalid_parameter"},
+		{"ServerMaskImage", "/transform?m=image:/etc/passwd&g", encodeTestPng(t), http.StatusBadRequest, "invalid_parameter"},
+		{"Help", "/transform?h", encodeTestPng(t), http.StatusBadRequest, "invalid_parameter"},
+		{"NotAnImage", "/transform?g", []byte("not an image"), http.StatusUnsupportedMediaType, "decode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := postTransform(t, handler, tt.target, "", tt.body)
+			if recorder.Code != tt.status {
+				t.Errorf("Test %s returned status %v, want %v", tt.name, recorder.Code, tt.status)
+			}
+			if response := decodeErrorResponse(t, recorder); response.Code != tt.code || response.Error == "" {
+				t.Errorf("Test %s returned %+v, want code %v", tt.name, response, tt.code)
+			}
+		})
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/transform", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected method not allowed for GET, got %v", recorder.Code)
+	}
+}
+
+func TestServeLimits(t *testing.T) {
+	serveParams := getDefaultServeParameters()
+	serveParams.maxUploadBytes = 50
+	recorder := postTransform(t, newServeHandler(serveParams, nil), "/transform?g", "", encodeTestPng(t))
+	if recorder.Code != http.StatusRequestEntityTooLarge || decodeErrorResponse(t, recorder).Code != "too_large" {
+		t.Errorf("expected the upload to be too large, got %v: %v", recorder.Code, recorder.Body.String())
+	}
+
+	serveParams = getDefaultServeParameters()
+	serveParams.maxPixels = 99
+	recorder = postTransform(t, newServeHandler(serveParams, nil), "/transform?g", "", encodeTestPng(t))
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected the 100 pixel image to be too large, got %v: %v", recorder.Code, recorder.Body.String())
+	}
+
+	// The 10x10 image only grows too large during the pipeline
+	recorder = postTransform(t, newServeHandler(getDefaultServeParameters(), nil), "/transform?u10&u10&u10", "", encodeTestPng(t))
+	if recorder.Code != http.StatusRequestEntityTooLarge || decodeErrorResponse(t, recorder).Code != "too_large" {
+		t.Errorf("expected the upscaled image to be too large, got %v: %v", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestCheckPipelineCost(t *testing.T) {
+	rect := MaskSpec{MaskRectangle, []float64{0, 0, 10, 10}, ""}
+	// A polygon of 400 points
+	poly := MaskSpec{MaskPolygon, make([]float64, 800), ""}
+	manyRects := make([]MaskSpec, 400)
+	for index := range manyRects {
+		manyRects[index] = rect
+	}
+
+	var tests = []struct {
+		name          string
+		width, height int
+		transformList []TransformationType
+		masks         []MaskSpec
+		wantErr       bool
+	}{
+		{"Empty", 100, 100, nil, nil, false},
+		{"ShrinkThenGrow", 3001, 3001, []TransformationType{Downsample10, Upscale10}, nil, false},
+		{"GrowTooLarge", 1000, 1000, []TransformationType{Gray, Upscale10}, nil, true},
+		{"Voronoi", 3000, 2000, []TransformationType{Voronoi100}, nil, false},
+		{"VoronoiTooLarge", 3000, 2000, []TransformationType{Voronoi500}, nil, true},
+		{"Masks", 3000, 2000, []TransformationType{Gray}, []MaskSpec{rect, rect}, false},
+		{"PolygonTooLarge", 3000, 2000, []TransformationType{Gray}, []MaskSpec{poly}, true},
+		{"TooManyMasks", 3000, 2000, []TransformationType{Gray}, manyRects, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := Transformation{transformList: tt.transformList, options: TransformOptions{masks: tt.masks}}
+			err := checkPipelineCost(tt.width, tt.height, params, 50_000_000)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, errImageTooLarge)) {
+				t.Errorf("Test %s returned %v, want error %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServeHealth(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newServeHandler(getDefaultServeParameters(), nil).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "{\"status\":\"ok\"}\n" {
+		t.Errorf("unexpected health response %v %v", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestParseServeParameters(t *testing.T) {
+	serveParams, err := parseServeParameters([]string{"-addr", ":9000", "-max-upload", "5", "-max-pixels", "1000"})
+	if err != nil || serveParams.address != ":9000" || serveParams.maxUploadBytes != 5<<20 || serveParams.maxPixels != 1000 {
+		t.Errorf("unexpected parameters %+v %v", serveParams, err)
+	}
+
+	serveParams, err = parseServeParameters([]string{"-root", "photos", "-cache-dir", "photos-cache"})
+	if err != nil || serveParams.cacheDir != "photos-cache" {
+		t.Errorf("expected a cache next to the root, got %+v %v", serveParams, err)
+	}
+
+	for _, args := range [][]string{{"-max-upload", "0"}, {"-addr"}, {"-port", "80"}, {"-root", "photos", "-cache-dir", "photos"}, {"-root", "photos", "-cache-dir", "photos/cache"}} {
+		if _, err := parseServeParameters(args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
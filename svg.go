@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SVGRect is a run of pixels of one color, in pixels.
+type SVGRect struct {
+	x, y          int
+	width, height int
+	color         color.NRGBA
+}
+
+func isSVGFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".svg"
+}
+
+// MeshRectangles covers the pixels with as few rectangles of one color as
+// the greedy approach finds: from the first uncovered pixel, grow a run to the
+// right, then grow it down while the rows below match.  Transparent pixels
+// and, for opaque images, pixels of the background color are not covered;
+// the background is returned to be drawn under the rectangles.
+func MeshRectangles(pixels [][]color.Color) ([]SVGRect, *color.NRGBA, error) {
+	if len(pixels) == 0 || len(pixels[0]) == 0 {
+		return nil, nil, errors.New("cannot mesh an empty pixel array")
+	}
+	width := len(pixels)
+	height := len(pixels[0])
+
+	colors := make([][]color.NRGBA, width)
+	counts := make(map[color.NRGBA]int)
+	opaque := true
+	for x := range colors {
+		if len(pixels[x]) != height {
+			return nil, nil, errors.New("cannot mesh a pixel array with uneven columns")
+		}
+		colors[x] = make([]color.NRGBA, height)
+		for y := range colors[x] {
+			colors[x][y] = color.NRGBAModel.Convert(pixels[x][y]).(color.NRGBA)
+			counts[colors[x][y]]++
+			opaque = opaque && colors[x][y].A == 255
+		}
+	}
+
+	// Rectangles drawn over a background only look right when nothing shows
+	// through them
+	var background *color.NRGBA
+	if opaque {
+		for c, count := range counts {
+			if background == nil || count > counts[*background] || (count == counts[*background] && colorKey(c) < colorKey(*background)) {
+				background = &c
+			}
+		}
+	}
+
+	covered := make([][]bool, width)
+	for x := range covered {
+		covered[x] = make([]bool, height)
+	}
+	skip := func(x int, y int) bool {
+		return covered[x][y] || colors[x][y].A == 0 || background != nil && colors[x][y] == *background
+	}
+
+	var rects []SVGRect
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if skip(x, y) {
+				continue
+			}
+			c := colors[x][y]
+
+			runWidth := 1
+			for x+runWidth < width && !skip(x+runWidth, y) && colors[x+runWidth][y] == c {
+				runWidth++
+			}
+			runHeight := 1
+		grow:
+			for y+runHeight < height {
+				for runX := x; runX < x+runWidth; runX++ {
+					if skip(runX, y+runHeight) || colors[runX][y+runHeight] != c {
+						break grow
+					}
+				}
+				runHeight++
+			}
+
+			for runX := x; runX < x+runWidth; runX++ {
+				for runY := y; runY < y+runHeight; runY++ {
+					covered[runX][runY] = true
+				}
+			}
+			rects = append(rects, SVGRect{x, y, runWidth, runHeight, c})
+		}
+	}
+	return rects, background, nil
+}
+
+// colorKey orders colors so ties are broken the same way on every run.
+func colorKey(c color.NRGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+func gcd(a int, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// svgGridSize is the largest block size every rectangle lines up with, 10
+// after -p10, so coordinates can be written in blocks.
+func svgGridSize(width int, height int, rects []SVGRect) int {
+	grid := gcd(width, height)
+	for _, rect := range rects {
+		grid = gcd(grid, gcd(gcd(rect.x, rect.y), gcd(rect.width, rect.height)))
+		if grid == 1 {
+			break
+		}
+	}
+	return grid
+}
+
+func svgFill(c color.NRGBA) string {
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 255 {
+		fill += fmt.Sprintf(` fill-opacity="%.3g"`, float64(c.A)/255)
+	}
+	return fill
+}
+
+// WriteSVG writes the pixels as an SVG of flat rectangles, grouped by color.
+// The view box counts blocks rather than pixels, and crisp edges keep the
+// blocks sharp at any size.
+func WriteSVG(w io.Writer, pixels [][]color.Color) error {
+	rects, background, err := MeshRectangles(pixels)
+	if err != nil {
+		return err
+	}
+	width := len(pixels)
+	height := len(pixels[0])
+	grid := svgGridSize(width, height, rects)
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		width, height, width/grid, height/grid)
+	if background != nil {
+		fmt.Fprintf(out, `<rect width="%d" height="%d" %v/>`+"\n", width/grid, height/grid, svgFill(*background))
+	}
+
+	// Groups in the order their colors first appear
+	var order []color.NRGBA
+	groups := make(map[color.NRGBA][]SVGRect)
+	for _, rect := range rects {
+		if _, ok := groups[rect.color]; !ok {
+			order = append(order, rect.color)
+		}
+		groups[rect.color] = append(groups[rect.color], rect)
+	}
+	for _, c := range order {
+		fmt.Fprintf(out, "<g %v>\n", svgFill(c))
+		for _, rect := range groups[c] {
+			fmt.Fprintf(out, `<rect x="%d" y="%d" width="%d" height="%d"/>`+"\n",
+				rect.x/grid, rect.y/grid, rect.width/grid, rect.height/grid)
+		}
+		fmt.Fprintln(out, "</g>")
+	}
+	fmt.Fprintln(out, "</svg>")
+	return out.Flush()
+}
+
+func writeSVGFile(pixels [][]color.Color, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return &IOError{Path: filePath, Err: err}
+	}
+	defer file.Close()
+
+	if err := WriteSVG(file, pixels); err != nil {
+		return &EncodeError{Path: filePath, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rasterizeRects paints the background and rectangles back onto a canvas.
+func rasterizeRects(width int, height int, rects []SVGRect, background *color.NRGBA) [][]color.NRGBA {
+	canvas := make([][]color.NRGBA, width)
+	for x := range canvas {
+		canvas[x] = make([]color.NRGBA, height)
+		if background != nil {
+			for y := range canvas[x] {
+				canvas[x][y] = *background
+			}
+		}
+	}
+	for _, rect := range rects {
+		for x := rect.x; x < rect.x+rect.width; x++ {
+			for y := rect.y; y < rect.y+rect.height; y++ {
+				canvas[x][y] = rect.color
+			}
+		}
+	}
+	return canvas
+}
+
+func TestMeshRectangles(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	blue := color.NRGBA{0, 0, 255, 255}
+
+	// Blue everywhere except a red L in the top left 2x2 blocks
+	pixels := make([][]color.Color, 40)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, 30)
+		for y := range pixels[x] {
+			pixels[x][y] = blue
+			if (x < 20 && y < 10) || (x < 10 && y < 20) {
+				pixels[x][y] = red
+			}
+		}
+	}
+
+	rects, background, err := MeshRectangles(pixels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if background == nil || *background != blue {
+		t.Fatalf("expected a blue background, got %v", background)
+	}
+	if len(rects) != 2 {
+		t.Errorf("expected the L to take 2 rectangles, got %v", rects)
+	}
+	if grid := svgGridSize(40, 30, rects); grid != 10 {
+		t.Errorf("expected a grid of 10, got %v", grid)
+	}
+
+	canvas := rasterizeRects(40, 30, rects, background)
+	for x := range pixels {
+		for y := range pixels[x] {
+			if canvas[x][y] != pixels[x][y] {
+				t.Fatalf("pixel %v,%v: expected %v, got %v", x, y, pixels[x][y], canvas[x][y])
+			}
+		}
+	}
+}
+
+func TestMeshRectanglesTransparent(t *testing.T) {
+	half := color.NRGBA{0, 255, 0, 128}
+	pixels := make([][]color.Color, 3)
+	for x := range pixels {
+		pixels[x] = []color.Color{color.NRGBA{}, half, color.NRGBA{}}
+	}
+
+	rects, background, err := MeshRectangles(pixels)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if background != nil {
+		t.Errorf("expected no background under translucent pixels, got %v", background)
+	}
+	if len(rects) != 1 || rects[0] != (SVGRect{0, 1, 3, 1, half}) {
+		t.Errorf("expected one translucent row, got %v", rects)
+	}
+
+	if _, _, err := MeshRectangles(nil); err == nil {
+		t.Error("expected an error for an empty pixel array")
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	// Red and blue halves with a green block, all lined up with 5x5 blocks
+	pixels := make([][]color.Color, 20)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, 10)
+		for y := range pixels[x] {
+			switch {
+			case x >= 5 && x < 10 && y >= 5:
+				pixels[x][y] = color.NRGBA{0, 255, 0, 255}
+			case x < 10:
+				pixels[x][y] = color.NRGBA{255, 0, 0, 255}
+			default:
+				pixels[x][y] = color.NRGBA{0, 0, 255, 255}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if err := WriteSVG(&out, pixels); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svg := out.String()
+	for _, expected := range []string{`width="20" height="10" viewBox="0 0 4 2"`, `<rect width="4" height="2" fill="#0000ff"/>`, `<g fill="#00ff00">`, `<rect x="1" y="1" width="1" height="1"/>`, "</svg>"} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("expected %q in %v", expected, svg)
+		}
+	}
+
+	translucent := [][]color.Color{{color.NRGBA{255, 0, 0, 51}}}
+	out.Reset()
+	if err := WriteSVG(&out, translucent); err != nil || !strings.Contains(out.String(), `fill="#ff0000" fill-opacity="0.2"`) {
+		t.Errorf("expected the opacity in the fill, got %v %v", out.String(), err)
+	}
+}
+
+func TestWriteResultSVG(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "result.svg")
+	params := getEmptyTransformationParams()
+	if err := writeResult(params, createGray2DArray(), "png", output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil || !strings.HasPrefix(string(data), "<svg") {
+		t.Errorf("expected an SVG file, got %q %v", data, err)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+type TextAlign int64
+
+const (
+	AlignLeft TextAlign = iota
+	AlignCenter
+	AlignRight
+)
+
+const defaultTextSize = 13
+
+// Largest text size and outline width accepted.  The outline looks at the
+// square of its width for every pixel of the text.
+const maxTextSize = 1000
+const maxTextOutlineWidth = 50
+
+// textNow is replaced in tests so {date} and {time} are predictable.
+var textNow = time.Now
+
+type TextSettings struct {
+	template      string
+	fontFile      string
+	size          float64
+	color         color.Color
+	outlineColor  color.Color
+	outlineWidth  int
+	shadowColor   color.Color
+	shadowOffsetX int
+	shadowOffsetY int
+	align         TextAlign
+	gravity       Gravity
+	offsetX       int
+	offsetY       int
+	wrapWidth     int
+}
+
+func getDefaultTextSettings() TextSettings {
+	var settings TextSettings
+	settings.size = defaultTextSize
+	settings.color = color.RGBA{255, 255, 255, 255}
+	settings.outlineWidth = 1
+	settings.shadowOffsetX = 2
+	settings.shadowOffsetY = 2
+	settings.align = AlignLeft
+	settings.gravity = GravitySouthWest
+	settings.offsetX = 10
+	settings.offsetY = 10
+	return settings
+}
+
+func parseTextAlign(name string) (TextAlign, error) {
+	switch strings.ToLower(name) {
+	case "left":
+		return AlignLeft, nil
+	case "center":
+		return AlignCenter, nil
+	case "right":
+		return AlignRight, nil
+	}
+	return AlignLeft, fmt.Errorf("unknown text alignment: %v", name)
+}
+
+// parseHexColor reads RRGGBB or RRGGBBAA with an optional leading #.
+func parseHexColor(value string) (color.Color, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return nil, fmt.Errorf("invalid color: %v", value)
+	}
+
+	parsed, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color: %v", value)
+	}
+
+	if len(hex) == 6 {
+		parsed = parsed<<8 | 0xff
+	}
+	return color.NRGBA{uint8(parsed >> 24), uint8(parsed >> 16), uint8(parsed >> 8), uint8(parsed)}, nil
+}
+
+// expandTextTemplate replaces {filename}, {width}, {height}, {date}, {time}
+// and the two character sequence \n in the text.
+func expandTextTemplate(template string, filename string, width int, height int) string {
+	now := textNow()
+	replacer := strings.NewReplacer(
+		"{filename}", filename,
+		"{width}", strconv.Itoa(width),
+		"{height}", strconv.Itoa(height),
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("15:04:05"),
+		`\n`, "\n",
+	)
+	return replacer.Replace(template)
+}
+
+// loadFontFace returns the embedded bitmap font when no font file is given,
+// otherwise the TrueType or OpenType font at the requested size.
+func loadFontFace(settings TextSettings) (font.Face, int, error) {
+	if settings.fontFile == "" {
+		// The bitmap font only comes in one size, so scale it by whole pixels
+		scale := max(1, int(math.Round(settings.size/defaultTextSize)))
+		return basicfont.Face7x13, scale, nil
+	}
+
+	data, err := os.ReadFile(settings.fontFile)
+	if err != nil {
+		return nil, 0, &IOError{Path: settings.fontFile, Err: err}
+	}
+
+	parsedFont, err := opentype.Parse(data)
+	if err != nil {
+		return nil, 0, &DecodeError{Path: settings.fontFile, Err: err}
+	}
+
+	face, err := opentype.NewFace(parsedFont, &opentype.FaceOptions{Size: settings.size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, 0, err
+	}
+	return face, 1, nil
+}
+
+// wrapText splits the text into lines no wider than maxWidth pixels, breaking
+// between words.  A single word wider than maxWidth gets a line of its own.
+func wrapText(face font.Face, text string, maxWidth int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if maxWidth <= 0 || len(words) == 0 {
+			lines = append(lines, paragraph)
+			continue
+		}
+
+		line := words[0]
+		for _, word := range words[1:] {
+			candidate := line + " " + word
+			if font.MeasureString(face, candidate).Ceil() > maxWidth {
+				lines = append(lines, line)
+				line = word
+			} else {
+				line = candidate
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// renderTextMask draws the lines in white on a transparent mask just large
+// enough to hold them.
+func renderTextMask(face font.Face, lines []string, align TextAlign) *image.Alpha {
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	ascent := metrics.Ascent.Ceil()
+
+	width := 0
+	for _, line := range lines {
+		width = max(width, font.MeasureString(face, line).Ceil())
+	}
+
+	mask := image.NewAlpha(image.Rect(0, 0, max(width, 1), max(lineHeight*len(lines), 1)))
+	drawer := font.Drawer{Dst: mask, Src: image.Opaque, Face: face}
+	for index, line := range lines {
+		lineWidth := font.MeasureString(face, line).Ceil()
+		x := 0
+		switch align {
+		case AlignCenter:
+			x = (width - lineWidth) / 2
+		case AlignRight:
+			x = width - lineWidth
+		}
+		drawer.Dot = fixed.P(x, index*lineHeight+ascent)
+		drawer.DrawString(line)
+	}
+	return mask
+}
+
+func scaleMask(mask *image.Alpha, scale int) *image.Alpha {
+	if scale <= 1 {
+		return mask
+	}
+	bounds := mask.Bounds()
+	scaled := image.NewAlpha(image.Rect(0, 0, bounds.Dx()*scale, bounds.Dy()*scale))
+	for x := 0; x < scaled.Rect.Dx(); x++ {
+		for y := 0; y < scaled.Rect.Dy(); y++ {
+			scaled.SetAlpha(x, y, mask.AlphaAt(bounds.Min.X+x/scale, bounds.Min.Y+y/scale))
+		}
+	}
+	return scaled
+}
+
+// dilateMask grows the mask by radius pixels in every direction, which gives
+// the shape of an outline drawn around the text.
+func dilateMask(mask *image.Alpha, radius int) *image.Alpha {
+	bounds := mask.Bounds()
+	dilated := image.NewAlpha(bounds)
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			var strongest uint8
+			for dx := -radius; dx <= radius; dx++ {
+				for dy := -radius; dy <= radius; dy++ {
+					if dx*dx+dy*dy <= radius*radius {
+						strongest = max(strongest, mask.AlphaAt(x+dx, y+dy).A)
+					}
+				}
+			}
+			dilated.SetAlpha(x, y, color.Alpha{strongest})
+		}
+	}
+	return dilated
+}
+
+// TextTransformation returns a transform that draws the text settings onto
+// the pixels it is given.  The filename fills the {filename} template.
+func TextTransformation(settings TextSettings, filename string) TransformFn {
+	return func(originalPixels [][]color.Color) ([][]color.Color, error) {
+		return TransformPixelsText(originalPixels, settings, filename)
+	}
+}
+
+func TransformPixelsText(originalPixels [][]color.Color, settings TextSettings, filename string) ([][]color.Color, error) {
+	if len(originalPixels) == 0 {
+		return originalPixels, nil
+	}
+	if settings.color == nil {
+		return nil, errors.New("no text color defined")
+	}
+
+	width := len(originalPixels)
+	height := len(originalPixels[0])
+	text := expandTextTemplate(settings.template, filename, width, height)
+
+	face, scale, err := loadFontFace(settings)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	// Leave room for the outline and shadow around the text
+	padding := 0
+	if settings.outlineColor != nil {
+		padding = settings.outlineWidth
+	}
+	if settings.shadowColor != nil {
+		padding = max(padding, abs(settings.shadowOffsetX), abs(settings.shadowOffsetY))
+	}
+
+	wrapWidth := settings.wrapWidth
+	if wrapWidth == 0 {
+		wrapWidth = width - 2*settings.offsetX - 2*padding
+	}
+	lines := wrapText(face, text, max(1, wrapWidth/scale))
+
+	textMask := scaleMask(renderTextMask(face, lines, settings.align), scale)
+	padded := image.NewAlpha(image.Rect(0, 0, textMask.Rect.Dx()+2*padding, textMask.Rect.Dy()+2*padding))
+	draw.Draw(padded, textMask.Rect.Add(image.Pt(padding, padding)), textMask, image.Point{}, draw.Src)
+
+	startX, startY := placeWithGravity(settings.gravity, width, height, padded.Rect.Dx(), padded.Rect.Dy(), settings.offsetX, settings.offsetY)
+	area := padded.Rect.Add(image.Pt(startX, startY))
+
+	img, err := CreateImageFromPixelArray(originalPixels)
+	if err != nil {
+		return nil, err
+	}
+	canvas := img.(*image.RGBA)
+
+	if settings.shadowColor != nil {
+		shadowArea := area.Add(image.Pt(settings.shadowOffsetX, settings.shadowOffsetY))
+		draw.DrawMask(canvas, shadowArea, image.NewUniform(settings.shadowColor), image.Point{}, padded, image.Point{}, draw.Over)
+	}
+	if settings.outlineColor != nil && settings.outlineWidth > 0 {
+		draw.DrawMask(canvas, area, image.NewUniform(settings.outlineColor), image.Point{}, dilateMask(padded, settings.outlineWidth), image.Point{}, draw.Over)
+	}
+	draw.DrawMask(canvas, area, image.NewUniform(settings.color), image.Point{}, padded, image.Point{}, draw.Over)
+
+	return CreatePixelArrayFromImage(canvas)
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
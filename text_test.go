@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font/basicfont"
+)
+
+type HexColorTest struct {
+	name      string
+	input     string
+	expected  color.Color
+	expectErr bool
+}
+
+type WrapTextTest struct {
+	name     string
+	input    string
+	maxWidth int
+	expected []string
+}
+
+const systemFont = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+
+func countColor(pixels [][]color.Color, c color.Color) int {
+	target := color.RGBAModel.Convert(c)
+	count := 0
+	for xIndex := range pixels {
+		for yIndex := range pixels[xIndex] {
+			if color.RGBAModel.Convert(pixels[xIndex][yIndex]) == target {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestParseHexColor(t *testing.T) {
+	var tests = []HexColorTest{
+		{"WithHash", "#ff8000", color.NRGBA{255, 128, 0, 255}, false},
+		{"WithoutHash", "00ff00", color.NRGBA{0, 255, 0, 255}, false},
+		{"WithAlpha", "0000ff80", color.NRGBA{0, 0, 255, 128}, false},
+		{"TooShort", "fff", nil, true},
+		{"NotHex", "gggggg", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseHexColor(tt.input)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			if err == nil && tt.expectErr {
+				t.Errorf("Test %s should have returned an error, but did not", tt.name)
+			}
+
+			if err == nil && tt.expected != result {
+				t.Errorf("Test %s returned invalid color: Expect: %v. Got: %v", tt.name, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseTextAlign(t *testing.T) {
+	align, err := parseTextAlign("Center")
+	if err != nil || align != AlignCenter {
+		t.Errorf("parseTextAlign returned invalid result: %v %v", align, err)
+	}
+
+	_, err = parseTextAlign("justify")
+	if err == nil || !strings.Contains(err.Error(), "unknown text alignment") {
+		t.Errorf("parseTextAlign should have returned an error. Got: %v", err)
+	}
+}
+
+func TestExpandTextTemplate(t *testing.T) {
+	textNow = func() time.Time { return time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC) }
+	defer func() { textNow = time.Now }()
+
+	result := expandTextTemplate(`{filename} {width}x{height}\n{date} {time}`, "cat.jpg", 640, 480)
+	expected := "cat.jpg 640x480\n2024-03-05 14:07:09"
+	if result != expected {
+		t.Errorf("expandTextTemplate returned invalid text: Expect: %q. Got: %q", expected, result)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	// Every character of the bitmap font is 7 pixels wide
+	var tests = []WrapTextTest{
+		{"NoWrap", "aaa bbb ccc", 0, []string{"aaa bbb ccc"}},
+		{"FitsExactly", "aaa bbb ccc", 49, []string{"aaa bbb", "ccc"}},
+		{"OneWordPerLine", "aaa bbb ccc", 30, []string{"aaa", "bbb", "ccc"}},
+		{"LongWord", "aaaaaaaaaa b", 30, []string{"aaaaaaaaaa", "b"}},
+		{"Newlines", "aaa\nbbb ccc", 100, []string{"aaa", "bbb ccc"}},
+		{"EmptyLine", "aaa\n\nbbb", 100, []string{"aaa", "", "bbb"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := wrapText(basicfont.Face7x13, tt.input, tt.maxWidth)
+			if strings.Join(result, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Test %s returned invalid lines: Expect: %q. Got: %q", tt.name, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTransformPixelsText(t *testing.T) {
+	base := make([][]color.Color, 60)
+	for xIndex := range base {
+		base[xIndex] = make([]color.Color, 30)
+		for yIndex := range base[xIndex] {
+			base[xIndex][yIndex] = testBlack.color
+		}
+	}
+
+	settings := getDefaultTextSettings()
+	settings.template = "Hi"
+	settings.gravity = GravityNorthWest
+	settings.offsetX = 0
+	settings.offsetY = 0
+
+	result, err := TransformPixelsText(base, settings, "")
+	if err != nil {
+		t.Fatalf("TransformPixelsText returned an unexpected error: %v", err)
+	}
+
+	if countColor(result, testWhite.color) == 0 {
+		t.Errorf("TransformPixelsText did not draw any text")
+	}
+
+	for xIndex := 20; xIndex < 60; xIndex++ {
+		for yIndex := 0; yIndex < 30; yIndex++ {
+			if result[xIndex][yIndex] != testBlack.color {
+				t.Fatalf("TransformPixelsText drew outside the text area at %d,%d", xIndex, yIndex)
+			}
+		}
+	}
+
+	if countColor(base, testWhite.color) != 0 {
+		t.Errorf("TransformPixelsText changed the original pixels")
+	}
+
+	settings.outlineColor = testRed.color
+	settings.shadowColor = testBlue.color
+	result, err = TransformPixelsText(base, settings, "")
+	if err != nil {
+		t.Fatalf("TransformPixelsText returned an unexpected error: %v", err)
+	}
+
+	if countColor(result, testRed.color) == 0 {
+		t.Errorf("TransformPixelsText did not draw an outline")
+	}
+
+	if countColor(result, testBlue.color) == 0 {
+		t.Errorf("TransformPixelsText did not draw a shadow")
+	}
+
+	settings = getDefaultTextSettings()
+	settings.template = "Hi"
+	settings.size = 26
+	small, _ := TransformPixelsText(base, getDefaultTextSettingsWith("Hi"), "")
+	large, err := TransformPixelsText(base, settings, "")
+	if err != nil {
+		t.Fatalf("TransformPixelsText returned an unexpected error: %v", err)
+	}
+
+	if countColor(large, testWhite.color) <= countColor(small, testWhite.color) {
+		t.Errorf("TransformPixelsText did not scale the bitmap font")
+	}
+}
+
+func getDefaultTextSettingsWith(template string) TextSettings {
+	settings := getDefaultTextSettings()
+	settings.template = template
+	return settings
+}
+
+func TestTransformPixelsTextFonts(t *testing.T) {
+	settings := getDefaultTextSettingsWith("Hello")
+	settings.fontFile = "missing.ttf"
+	_, err := TransformPixelsText(create2DArraySingleColor(testBlack), settings, "")
+	if err == nil {
+		t.Errorf("TransformPixelsText should have returned an error for a missing font")
+	}
+
+	badFont := fmt.Sprintf("%v/%v", t.TempDir(), "bad.ttf")
+	if err := os.WriteFile(badFont, []byte("not a font"), 0o644); err != nil {
+		t.Fatalf("could not write font file: %v", err)
+	}
+	settings.fontFile = badFont
+	_, err = TransformPixelsText(create2DArraySingleColor(testBlack), settings, "")
+	var decodeError *DecodeError
+	if !errors.As(err, &decodeError) {
+		t.Errorf("TransformPixelsText should have returned a parse error. Got: %v", err)
+	}
+
+	if _, statErr := os.Stat(systemFont); statErr != nil {
+		t.Skipf("no TrueType font available at %v", systemFont)
+	}
+
+	base := make([][]color.Color, 100)
+	for xIndex := range base {
+		base[xIndex] = make([]color.Color, 40)
+		for yIndex := range base[xIndex] {
+			base[xIndex][yIndex] = testBlack.color
+		}
+	}
+
+	settings.fontFile = systemFont
+	settings.size = 24
+	result, err := TransformPixelsText(base, settings, "")
+	if err != nil {
+		t.Fatalf("TransformPixelsText returned an unexpected error: %v", err)
+	}
+
+	if countColor(result, testWhite.color) == 0 {
+		t.Errorf("TransformPixelsText did not draw any TrueType text")
+	}
+}
+
+func TestProcessListWithText(t *testing.T) {
+	settings := getDefaultTextSettingsWith("{width}")
+	options := TransformOptions{text: &settings, sourceName: "a.jpg"}
+
+	result, err := ProcessListOfTransformationsWithOptions(create2DArraySingleColor(testBlack), []TransformationType{Text}, options)
+	if err != nil {
+		t.Fatalf("ProcessListOfTransformationsWithOptions returned an unexpected error: %v", err)
+	}
+
+	if len(result) != 10 || len(result[0]) != 10 {
+		t.Errorf("text step changed the image size")
+	}
+
+	_, err = ProcessListOfTransformationsWithOptions(create2DArraySingleColor(testBlack), []TransformationType{Text}, TransformOptions{})
+	if err == nil || !strings.Contains(err.Error(), "no text defined") {
+		t.Errorf("text step without text should have returned an error. Got: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Characters from the darkest to the brightest pixels, dense characters read
+// as dark on a light background.
+const defaultArtRamp = "@%#*+=-:. "
+const defaultArtColumns = 80
+
+// Bits of the braille dots in a 2x4 cell, indexed [x][y].
+var brailleDots = [2][4]rune{
+	{0x01, 0x02, 0x04, 0x40},
+	{0x08, 0x10, 0x20, 0x80},
+}
+
+type TextArtSettings struct {
+	ramp    string
+	braille bool
+	color   bool
+	columns int
+}
+
+func getDefaultTextArtSettings() TextArtSettings {
+	return TextArtSettings{ramp: defaultArtRamp, columns: defaultArtColumns}
+}
+
+// isTextArtFile reports whether the output file asks for text art instead of
+// an image.  .ans files are always colored.
+func isTextArtFile(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	return extension == ".txt" || extension == ".ans"
+}
+
+// artBlocks averages the pixels into one color per character or braille dot
+// with the pixelation block averaging.  A character cell is about twice as
+// high as it is wide, braille dots are about square.
+func artBlocks(pixels [][]color.Color, settings TextArtSettings) ([][]color.Color, error) {
+	if len(pixels) == 0 || len(pixels[0]) == 0 {
+		return nil, errors.New("cannot convert an empty pixel array to text")
+	}
+
+	across := settings.columns
+	if settings.braille {
+		across *= 2
+	}
+	blockWidth := max(1, (len(pixels)+across-1)/across)
+	blockHeight := blockWidth * 2
+	if settings.braille {
+		blockHeight = blockWidth
+	}
+	return TransformPixelsDownsampleRect(pixels, blockWidth, blockHeight)
+}
+
+func writeArtColor(out *bufio.Writer, c color.Color) {
+	r, g, b := previewRGB(c)
+	fmt.Fprintf(out, "\x1b[38;2;%d;%d;%dm", r, g, b)
+}
+
+func writeArtLineEnd(out *bufio.Writer, settings TextArtSettings) {
+	if settings.color {
+		out.WriteString("\x1b[0m")
+	}
+	out.WriteByte('\n')
+}
+
+// writeTextArt writes the pixels as lines of characters from the ramp, or as
+// braille patterns with a dot for every pixel darker than the average.
+func writeTextArt(w io.Writer, pixels [][]color.Color, settings TextArtSettings) error {
+	if utf8.RuneCountInString(settings.ramp) < 2 {
+		return errors.New("the character ramp needs at least 2 characters")
+	}
+
+	blocks, err := artBlocks(pixels, settings)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	if settings.braille {
+		writeBraille(out, blocks, settings)
+	} else {
+		ramp := []rune(settings.ramp)
+		for y := 0; y < len(blocks[0]); y++ {
+			for x := 0; x < len(blocks); x++ {
+				if settings.color {
+					writeArtColor(out, blocks[x][y])
+				}
+				out.WriteRune(ramp[int(pixelLuminance(blocks[x][y]))*(len(ramp)-1)/255])
+			}
+			writeArtLineEnd(out, settings)
+		}
+	}
+	return out.Flush()
+}
+
+func writeBraille(out *bufio.Writer, dots [][]color.Color, settings TextArtSettings) {
+	width := len(dots)
+	height := len(dots[0])
+
+	total := 0
+	for x := range dots {
+		for y := range dots[x] {
+			total += int(pixelLuminance(dots[x][y]))
+		}
+	}
+	threshold := total / (width * height)
+
+	for top := 0; top < height; top += 4 {
+		for left := 0; left < width; left += 2 {
+			pattern := rune(0x2800)
+			var cell []color.Color
+			for dx := 0; dx < 2 && left+dx < width; dx++ {
+				for dy := 0; dy < 4 && top+dy < height; dy++ {
+					cell = append(cell, dots[left+dx][top+dy])
+					if int(pixelLuminance(dots[left+dx][top+dy])) < threshold {
+						pattern |= brailleDots[dx][dy]
+					}
+				}
+			}
+
+			if settings.color {
+				average, _ := PixelBlockTransformation(cell)
+				writeArtColor(out, average)
+			}
+			out.WriteRune(pattern)
+		}
+		writeArtLineEnd(out, settings)
+	}
+}
+
+func writeTextArtFile(pixels [][]color.Color, filePath string, settings TextArtSettings) error {
+	if strings.ToLower(filepath.Ext(filePath)) == ".ans" {
+		settings.color = true
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return &IOError{Path: filePath, Err: err}
+	}
+	defer file.Close()
+
+	if err := writeTextArt(file, pixels, settings); err != nil {
+		return &EncodeError{Path: filePath, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"os"
+	"strings"
+	"testing"
+)
+
+// createArtGradient is black on the left half and white on the right half.
+func createArtGradient(width int, height int) [][]color.Color {
+	pixels := make([][]color.Color, width)
+	for x := range pixels {
+		pixels[x] = make([]color.Color, height)
+		for y := range pixels[x] {
+			pixels[x][y] = color.Gray{0}
+			if x >= width/2 {
+				pixels[x][y] = color.Gray{255}
+			}
+		}
+	}
+	return pixels
+}
+
+func TestWriteTextArtRamp(t *testing.T) {
+	settings := getDefaultTextArtSettings()
+	settings.columns = 8
+	settings.ramp = "#. "
+
+	var output bytes.Buffer
+	if err := writeTextArt(&output, createArtGradient(16, 8), settings); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 2x4 pixel blocks keep the aspect ratio of the character cells
+	expected := "####    \n####    \n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
+
+func TestWriteTextArtUnicodeRamp(t *testing.T) {
+	settings := getDefaultTextArtSettings()
+	settings.columns = 2
+	settings.ramp = "█░"
+
+	var output bytes.Buffer
+	writeTextArt(&output, createArtGradient(2, 4), settings)
+	if output.String() != "█░\n█░\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+func TestWriteTextArtBraille(t *testing.T) {
+	settings := getDefaultTextArtSettings()
+	settings.columns = 2
+	settings.braille = true
+
+	var output bytes.Buffer
+	if err := writeTextArt(&output, createArtGradient(4, 4), settings); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The dark half has every dot set, the bright half none
+	if output.String() != "⣿⠀\n" {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+func TestWriteTextArtColor(t *testing.T) {
+	settings := getDefaultTextArtSettings()
+	settings.columns = 1
+	settings.color = true
+
+	pixels := [][]color.Color{{color.RGBA{255, 0, 0, 255}, color.RGBA{255, 0, 0, 255}}}
+	var output bytes.Buffer
+	writeTextArt(&output, pixels, settings)
+	if !strings.HasPrefix(output.String(), "\x1b[38;2;255;0;0m") || !strings.HasSuffix(output.String(), "\x1b[0m\n") {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+func TestWriteTextArtErrors(t *testing.T) {
+	settings := getDefaultTextArtSettings()
+	if err := writeTextArt(&bytes.Buffer{}, nil, settings); err == nil {
+		t.Errorf("expected an error for an empty array")
+	}
+	settings.ramp = "#"
+	if err := writeTextArt(&bytes.Buffer{}, createGray2DArray(), settings); err == nil {
+		t.Errorf("expected an error for a short ramp")
+	}
+}
+
+func TestWriteTextArtFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	settings := getDefaultTextArtSettings()
+
+	if err := writeTextArtFile(createGray2DArray(), tmpDir+"/art.txt", settings); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(tmpDir + "/art.txt"); bytes.Contains(data, []byte("\x1b[")) || len(data) == 0 {
+		t.Errorf("expected plain text, got %q", data)
+	}
+
+	if err := writeTextArtFile(createGray2DArray(), tmpDir+"/art.ANS", settings); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(tmpDir + "/art.ANS"); !bytes.Contains(data, []byte("\x1b[38;2;")) {
+		t.Errorf("expected ANSI colors, got %q", data)
+	}
+
+	if err := writeTextArtFile(createGray2DArray(), tmpDir+"/missing/art.txt", settings); exitCodeForError(err) != exitIO {
+		t.Errorf("expected an IO error, got %v", err)
+	}
+}
+
+func TestParseTextArtParameters(t *testing.T) {
+	params, err := parseParameters([]string{"-i", "in.png", "-o", "out.txt", "-art-ramp", " .#", "-art-width", "40", "-art-braille", "-art-color"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := TextArtSettings{ramp: " .#", braille: true, color: true, columns: 40}
+	if params.textArt != expected {
+		t.Errorf("expected %+v, got %+v", expected, params.textArt)
+	}
+
+	for _, args := range [][]string{
+		{"-i", "in.png", "-o", "out.txt", "-art-ramp", "#"},
+		{"-i", "in.png", "-o", "out.txt", "-art-width", "0"},
+	} {
+		if _, err := parseParameters(args); exitCodeForError(err) != exitInvalidParameter {
+			t.Errorf("%v: expected an invalid parameter error, got %v", args, err)
+		}
+	}
+}
@@ -3,11 +3,30 @@ package main
 import (
 	"errors"
 	"image/color"
-	"log"
+	"slices"
 )
 
 type TransformFn func([][]color.Color) ([][]color.Color, error)
 
+// TransformOptions holds settings that apply to the whole list of
+// transformations rather than to a single step.
+type TransformOptions struct {
+	masks          []MaskSpec
+	feather        int
+	composite      *CompositeSettings
+	backgroundFile string
+	overlay        *OverlaySettings
+	text           *TextSettings
+	sourceName     string
+	claheGrid      int
+	claheClip      float64
+	levelsClip     float64
+	temperature    float64
+	tint           float64
+	// onStep is called with the result of every step, used to record them
+	onStep func(step int, transformation TransformationType, pixels [][]color.Color)
+}
+
 func Grayscale(originalPixels [][]color.Color) ([][]color.Color, error) {
 	return TransformPixelsOneByOne(GrayscaleTransformation, originalPixels)
 }
@@ -60,60 +79,242 @@ func Pixelate50x50(originalPixels [][]color.Color) ([][]color.Color, error) {
 	return TransformPixelsFiftyByFify((originalPixels))
 }
 
+func Downsample3x3(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsDownsampleNxN(originalPixels, 3)
+}
+
+func Downsample10x10(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsDownsampleNxN(originalPixels, 10)
+}
+
+func Downsample20x20(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsDownsampleNxN(originalPixels, 20)
+}
+
+func Downsample50x50(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsDownsampleNxN(originalPixels, 50)
+}
+
+func Upscale2x(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsUpscale(originalPixels, 2)
+}
+
+func Upscale3x(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsUpscale(originalPixels, 3)
+}
+
+func Upscale4x(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsUpscale(originalPixels, 4)
+}
+
+func Upscale10x(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsUpscale(originalPixels, 10)
+}
+
+// Block sizes of the downsample steps and factors of the upscale steps, the
+// only steps that change the size of the image.
+var downsampleBlocks = map[TransformationType]int{Downsample3: 3, Downsample10: 10, Downsample20: 20, Downsample50: 50}
+var upscaleFactors = map[TransformationType]int{Upscale2: 2, Upscale3: 3, Upscale4: 4, Upscale10: 10}
+
+func changesImageSize(transformation TransformationType) bool {
+	_, downsample := downsampleBlocks[transformation]
+	_, upscale := upscaleFactors[transformation]
+	return downsample || upscale
+}
+
+// stepOutputSize returns the size of the image after the transformation.
+func stepOutputSize(transformation TransformationType, width int, height int) (int, int) {
+	if block, ok := downsampleBlocks[transformation]; ok {
+		return (width + block - 1) / block, (height + block - 1) / block
+	}
+	if factor, ok := upscaleFactors[transformation]; ok {
+		return width * factor, height * factor
+	}
+	return width, height
+}
+
 func TransformImage(TxFn TransformFn, originalPixels [][]color.Color) ([][]color.Color, error) {
 	newPixels, err := TxFn(originalPixels)
 	if err != nil {
-		log.Printf("Error transforming original image: %v", err)
 		return nil, err
 	}
 
 	return newPixels, nil
 }
 
+// TransformImageWithMask runs the transform on a copy of the pixels and blends
+// the result back over the original using the mask.  A nil mask transforms
+// the whole image.
+func TransformImageWithMask(TxFn TransformFn, originalPixels [][]color.Color, mask Mask) ([][]color.Color, error) {
+	if mask == nil {
+		return TransformImage(TxFn, originalPixels)
+	}
+
+	newPixels, err := TransformImage(TxFn, CopyPixelArray(originalPixels))
+	if err != nil {
+		return nil, err
+	}
+
+	return ApplyMask(originalPixels, newPixels, mask)
+}
+
 func ProcessListOfTransformations(pixels [][]color.Color, transformationList []TransformationType) ([][]color.Color, error) {
+	return ProcessListOfTransformationsWithOptions(pixels, transformationList, TransformOptions{})
+}
+
+func ProcessListOfTransformationsWithOptions(pixels [][]color.Color, transformationList []TransformationType, options TransformOptions) ([][]color.Color, error) {
 	workingPixels := pixels
+	var mask Mask
 	var err error
-	for _, transformVal := range transformationList {
+
+	// Keep the backdrop aside before any transform can change the pixels.
+	// It serves the whole list, so a failure is reported at the first step
+	var backdrop [][]color.Color
+	if options.composite != nil {
+		backdrop, err = loadBackdrop(pixels, options.backgroundFile)
+		if err != nil {
+			firstTransformation := Undefined
+			if len(transformationList) > 0 {
+				firstTransformation = transformationList[0]
+			}
+			return workingPixels, &TransformError{Step: 0, Transformation: firstTransformation, Err: err}
+		}
+	}
+
+	var overlayPixels [][]color.Color
+	if overlayStep := slices.Index(transformationList, Overlay); options.overlay != nil && overlayStep >= 0 {
+		overlayPixels, err = loadOverlay(*options.overlay)
+		if err != nil {
+			return workingPixels, &TransformError{Step: overlayStep, Transformation: Overlay, Err: err}
+		}
+	}
+
+	for step, transformVal := range transformationList {
+		// Only rebuild the mask when an earlier step changed the image size
+		if len(options.masks) > 0 && len(workingPixels) > 0 &&
+			(len(mask) != len(workingPixels) || len(mask[0]) != len(workingPixels[0])) {
+			mask, err = BuildMask(options.masks, len(workingPixels), len(workingPixels[0]), options.feather)
+			if err != nil {
+				return workingPixels, &TransformError{Step: step, Transformation: transformVal, Err: err}
+			}
+		}
+
 		var transformedPixels [][]color.Color
 		switch transformVal {
 		case SwapRG:
-			transformedPixels, err = TransformImage(SwapRandGValues, workingPixels)
+			transformedPixels, err = TransformImageWithMask(SwapRandGValues, workingPixels, mask)
 		case SwapGB:
-			transformedPixels, err = TransformImage(SwapGandBValues, workingPixels)
+			transformedPixels, err = TransformImageWithMask(SwapGandBValues, workingPixels, mask)
 		case SwapRB:
-			transformedPixels, err = TransformImage(SwapRandBValues, workingPixels)
+			transformedPixels, err = TransformImageWithMask(SwapRandBValues, workingPixels, mask)
 		case Gray:
-			transformedPixels, err = TransformImage(Grayscale, workingPixels)
+			transformedPixels, err = TransformImageWithMask(Grayscale, workingPixels, mask)
 		case GrayBlue:
-			transformedPixels, err = TransformImage(GrayAndBlue, workingPixels)
+			transformedPixels, err = TransformImageWithMask(GrayAndBlue, workingPixels, mask)
 		case GrayGreen:
-			transformedPixels, err = TransformImage(GrayAndGreen, workingPixels)
+			transformedPixels, err = TransformImageWithMask(GrayAndGreen, workingPixels, mask)
 		case GrayRed:
-			transformedPixels, err = TransformImage(GrayAndRed, workingPixels)
+			transformedPixels, err = TransformImageWithMask(GrayAndRed, workingPixels, mask)
 		case ShiftLeft:
-			transformedPixels, err = TransformImage(ShiftRGBValuesLeft, workingPixels)
+			transformedPixels, err = TransformImageWithMask(ShiftRGBValuesLeft, workingPixels, mask)
 		case ShiftRight:
-			transformedPixels, err = TransformImage(ShiftRGBValuesRight, workingPixels)
+			transformedPixels, err = TransformImageWithMask(ShiftRGBValuesRight, workingPixels, mask)
 		case Pixel3:
-			transformedPixels, err = TransformImage(Pixelate3x3, workingPixels)
+			transformedPixels, err = TransformImageWithMask(Pixelate3x3, workingPixels, mask)
 		case Pixel10:
-			transformedPixels, err = TransformImage(Pixelate10x10, workingPixels)
+			transformedPixels, err = TransformImageWithMask(Pixelate10x10, workingPixels, mask)
 		case Pixel20:
-			transformedPixels, err = TransformImage(Pixelate20x20, workingPixels)
+			transformedPixels, err = TransformImageWithMask(Pixelate20x20, workingPixels, mask)
 		case Pixel50:
-			transformedPixels, err = TransformImage(Pixelate50x50, workingPixels)
+			transformedPixels, err = TransformImageWithMask(Pixelate50x50, workingPixels, mask)
+		case Downsample3:
+			transformedPixels, err = TransformImageWithMask(Downsample3x3, workingPixels, mask)
+		case Downsample10:
+			transformedPixels, err = TransformImageWithMask(Downsample10x10, workingPixels, mask)
+		case Downsample20:
+			transformedPixels, err = TransformImageWithMask(Downsample20x20, workingPixels, mask)
+		case Downsample50:
+			transformedPixels, err = TransformImageWithMask(Downsample50x50, workingPixels, mask)
+		case Upscale2:
+			transformedPixels, err = TransformImageWithMask(Upscale2x, workingPixels, mask)
+		case Upscale3:
+			transformedPixels, err = TransformImageWithMask(Upscale3x, workingPixels, mask)
+		case Upscale4:
+			transformedPixels, err = TransformImageWithMask(Upscale4x, workingPixels, mask)
+		case Upscale10:
+			transformedPixels, err = TransformImageWithMask(Upscale10x, workingPixels, mask)
+		case Hexagon10:
+			transformedPixels, err = TransformImageWithMask(HexagonMosaic10, workingPixels, mask)
+		case Hexagon20:
+			transformedPixels, err = TransformImageWithMask(HexagonMosaic20, workingPixels, mask)
+		case Triangle10:
+			transformedPixels, err = TransformImageWithMask(TriangleMosaic10, workingPixels, mask)
+		case Triangle20:
+			transformedPixels, err = TransformImageWithMask(TriangleMosaic20, workingPixels, mask)
+		case Dot10:
+			transformedPixels, err = TransformImageWithMask(DotMosaic10, workingPixels, mask)
+		case Dot20:
+			transformedPixels, err = TransformImageWithMask(DotMosaic20, workingPixels, mask)
+		case Voronoi100:
+			transformedPixels, err = TransformImageWithMask(VoronoiMosaic100, workingPixels, mask)
+		case Voronoi500:
+			transformedPixels, err = TransformImageWithMask(VoronoiMosaic500, workingPixels, mask)
+		case Overlay:
+			if overlayPixels == nil {
+				return workingPixels, &TransformError{Step: step, Transformation: transformVal, Err: errors.New("no overlay image defined")}
+			}
+			transformedPixels, err = TransformImageWithMask(OverlayTransformation(*options.overlay, overlayPixels), workingPixels, mask)
+		case Equalize:
+			transformedPixels, err = TransformImageWithMask(EqualizeHistogram, workingPixels, mask)
+		case Clahe:
+			transformedPixels, err = TransformImageWithMask(ClaheTransformation(options.claheGrid, options.claheClip), workingPixels, mask)
+		case AutoLevels:
+			transformedPixels, err = TransformImageWithMask(AutoLevelsTransformation(options.levelsClip), workingPixels, mask)
+		case AutoContrast:
+			transformedPixels, err = TransformImageWithMask(AutoContrastLuminance, workingPixels, mask)
+		case WhiteBalanceGray:
+			transformedPixels, err = TransformImageWithMask(WhiteBalanceGrayWorld, workingPixels, mask)
+		case WhiteBalanceWhite:
+			transformedPixels, err = TransformImageWithMask(WhiteBalanceWhitePatch, workingPixels, mask)
+		case Temperature:
+			transformedPixels, err = TransformImageWithMask(TemperatureTransformation(options.temperature), workingPixels, mask)
+		case Tint:
+			transformedPixels, err = TransformImageWithMask(TintTransformation(options.tint), workingPixels, mask)
+		case Text:
+			if options.text == nil {
+				return workingPixels, &TransformError{Step: step, Transformation: transformVal, Err: errors.New("no text defined")}
+			}
+			transformedPixels, err = TransformImageWithMask(TextTransformation(*options.text, options.sourceName), workingPixels, mask)
 		default:
-			return workingPixels, errors.New("unknown transformation")
+			return workingPixels, &UnknownTransformError{Name: transformVal.String()}
 		}
 		if err != nil {
-			log.Fatalf("Cannot transform Image: %v: %v", transformVal, err)
-			return workingPixels, err
+			return workingPixels, &TransformError{Step: step, Transformation: transformVal, Err: err}
 		}
 		workingPixels = transformedPixels
+		if options.onStep != nil {
+			options.onStep(step, transformVal, workingPixels)
+		}
+	}
+
+	if options.composite != nil {
+		return CompositePixels(backdrop, workingPixels, *options.composite)
 	}
 	return workingPixels, nil
 }
 
+func loadBackdrop(pixels [][]color.Color, backgroundFile string) ([][]color.Color, error) {
+	if backgroundFile == "" {
+		return CopyPixelArray(pixels), nil
+	}
+
+	img, err := openJpeg(backgroundFile)
+	if err != nil {
+		return nil, err
+	}
+	return CreatePixelArrayFromImage(img)
+}
+
 func TransformPixelsOneByOne(TxPixel TransformSinglePixelFn, originalPixels [][]color.Color) ([][]color.Color, error) {
 	var newPixels [][]color.Color
 	for xIndex := 0; xIndex < len(originalPixels); xIndex++ {
@@ -122,7 +323,6 @@ func TransformPixelsOneByOne(TxPixel TransformSinglePixelFn, originalPixels [][]
 		for yIndex := 0; yIndex < len(pixelCol); yIndex++ {
 			newPixel, err := TxPixel(pixelCol[yIndex])
 			if err != nil {
-				log.Printf("error transforming 1x1: %v", err)
 				return nil, err
 			}
 			newCol = append(newCol, newPixel)
@@ -149,6 +349,10 @@ func TransformPixelsFiftyByFify(originalPixels [][]color.Color) ([][]color.Color
 }
 
 func TransformPixelsNxN(originalPixels [][]color.Color, size int) ([][]color.Color, error) {
+	if size < 1 {
+		return nil, errors.New("block size must be at least 1")
+	}
+
 	var transformedPixels [][]color.Color
 	transformedPixels = originalPixels
 
@@ -176,7 +380,73 @@ func TransformPixelsNxN(originalPixels [][]color.Color, size int) ([][]color.Col
 	return transformedPixels, nil
 }
 
+// TransformPixelsDownsampleNxN averages each NxN block into a single pixel.
+// Partial blocks on the right and bottom edges still produce one pixel each.
+func TransformPixelsDownsampleNxN(originalPixels [][]color.Color, size int) ([][]color.Color, error) {
+	return TransformPixelsDownsampleRect(originalPixels, size, size)
+}
+
+// TransformPixelsDownsampleRect averages each width x height block into a
+// single pixel, like TransformPixelsDownsampleNxN with rectangular blocks.
+func TransformPixelsDownsampleRect(originalPixels [][]color.Color, width int, height int) ([][]color.Color, error) {
+	if width < 1 || height < 1 {
+		return nil, errors.New("block size must be at least 1")
+	}
+
+	var transformedPixels [][]color.Color
+
+	for xIndex := 0; xIndex < len(originalPixels); xIndex += width {
+		var newCol []color.Color
+		for yIndex := 0; yIndex < len(originalPixels[xIndex]); yIndex += height {
+
+			pixelBlock, err := getPixelBlockRect(originalPixels, xIndex, yIndex, width, height)
+			if err != nil {
+				return nil, errors.New("could not get pixel block")
+			}
+
+			newColor, err := PixelBlockTransformation(pixelBlock)
+			if err != nil {
+				return nil, errors.New("could not calculate pixel block color")
+			}
+
+			newCol = append(newCol, newColor)
+		}
+		transformedPixels = append(transformedPixels, newCol)
+	}
+
+	return transformedPixels, nil
+}
+
+// TransformPixelsUpscale enlarges the image by an integer factor using nearest
+// neighbor sampling, so every source pixel becomes a factor x factor square.
+func TransformPixelsUpscale(originalPixels [][]color.Color, factor int) ([][]color.Color, error) {
+	if factor < 1 {
+		return nil, errors.New("upscale factor must be at least 1")
+	}
+
+	var transformedPixels [][]color.Color
+
+	for xIndex := 0; xIndex < len(originalPixels); xIndex++ {
+		pixelCol := originalPixels[xIndex]
+		for xRepeat := 0; xRepeat < factor; xRepeat++ {
+			newCol := make([]color.Color, 0, len(pixelCol)*factor)
+			for yIndex := 0; yIndex < len(pixelCol); yIndex++ {
+				for yRepeat := 0; yRepeat < factor; yRepeat++ {
+					newCol = append(newCol, pixelCol[yIndex])
+				}
+			}
+			transformedPixels = append(transformedPixels, newCol)
+		}
+	}
+
+	return transformedPixels, nil
+}
+
 func getPixelBlock(originalPixels [][]color.Color, startX int, startY int, size int) ([]color.Color, error) {
+	return getPixelBlockRect(originalPixels, startX, startY, size, size)
+}
+
+func getPixelBlockRect(originalPixels [][]color.Color, startX int, startY int, width int, height int) ([]color.Color, error) {
 	var pixelsInBlock []color.Color
 
 	if startX >= len(originalPixels) {
@@ -187,8 +457,8 @@ func getPixelBlock(originalPixels [][]color.Color, startX int, startY int, size
 		return pixelsInBlock, errors.New("y value too big for available pixel array")
 	}
 
-	for xIndex := startX; xIndex < len(originalPixels) && xIndex < startX+size; xIndex++ {
-		for yIndex := startY; yIndex < len(originalPixels[xIndex]) && yIndex < startY+size; yIndex++ {
+	for xIndex := startX; xIndex < len(originalPixels) && xIndex < startX+width; xIndex++ {
+		for yIndex := startY; yIndex < len(originalPixels[xIndex]) && yIndex < startY+height; yIndex++ {
 			pixelsInBlock = append(pixelsInBlock, originalPixels[xIndex][yIndex])
 		}
 	}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"math"
+)
+
+const defaultLevelsClip = 0.5
+const neutralTemperature = 6500.0
+
+type channelStatistics struct {
+	histograms [3][256]int
+	totals     [3]float64
+	count      int
+}
+
+func AutoContrastLuminance(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsAutoContrast(originalPixels, defaultLevelsClip)
+}
+
+func WhiteBalanceGrayWorld(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsGrayWorld(originalPixels)
+}
+
+func WhiteBalanceWhitePatch(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsWhitePatch(originalPixels, defaultLevelsClip)
+}
+
+// AutoLevelsTransformation returns an auto-levels transform that ignores the
+// given percentage of the darkest and brightest values.  Zero uses the default.
+func AutoLevelsTransformation(clipPercent float64) TransformFn {
+	if clipPercent == 0 {
+		clipPercent = defaultLevelsClip
+	}
+	return func(originalPixels [][]color.Color) ([][]color.Color, error) {
+		return TransformPixelsAutoLevels(originalPixels, clipPercent)
+	}
+}
+
+func TemperatureTransformation(kelvin float64) TransformFn {
+	return func(originalPixels [][]color.Color) ([][]color.Color, error) {
+		return TransformPixelsTemperature(originalPixels, kelvin)
+	}
+}
+
+func TintTransformation(tint float64) TransformFn {
+	return func(originalPixels [][]color.Color) ([][]color.Color, error) {
+		return TransformPixelsTint(originalPixels, tint)
+	}
+}
+
+// TransformPixelsAutoLevels stretches each channel separately so its clipped
+// range covers 0-255.  This also removes color casts.
+func TransformPixelsAutoLevels(originalPixels [][]color.Color, clipPercent float64) ([][]color.Color, error) {
+	stats := gatherChannelStatistics(originalPixels)
+	var low, high [3]float64
+	for channel := range low {
+		low[channel] = float64(histogramPercentile(stats.histograms[channel], clipPercent))
+		high[channel] = float64(histogramPercentile(stats.histograms[channel], 100-clipPercent))
+	}
+	return TransformPixelsOneByOne(levelsTransformation(low, high), originalPixels)
+}
+
+// TransformPixelsAutoContrast stretches all channels by the same amount, based
+// on the luminance range, so the color balance is kept.
+func TransformPixelsAutoContrast(originalPixels [][]color.Color, clipPercent float64) ([][]color.Color, error) {
+	var histogram [256]int
+	for xIndex := range originalPixels {
+		for yIndex := range originalPixels[xIndex] {
+			if _, _, _, alpha := originalPixels[xIndex][yIndex].RGBA(); alpha > 0 {
+				histogram[pixelLuminance(originalPixels[xIndex][yIndex])]++
+			}
+		}
+	}
+
+	low := float64(histogramPercentile(histogram, clipPercent))
+	high := float64(histogramPercentile(histogram, 100-clipPercent))
+	return TransformPixelsOneByOne(levelsTransformation([3]float64{low, low, low}, [3]float64{high, high, high}), originalPixels)
+}
+
+// TransformPixelsGrayWorld assumes the average color of the scene is gray and
+// scales each channel so its mean matches the overall mean.
+func TransformPixelsGrayWorld(originalPixels [][]color.Color) ([][]color.Color, error) {
+	stats := gatherChannelStatistics(originalPixels)
+	if stats.count == 0 {
+		return originalPixels, nil
+	}
+
+	gray := (stats.totals[0] + stats.totals[1] + stats.totals[2]) / 3
+	var factors [3]float64
+	for channel := range factors {
+		if stats.totals[channel] == 0 {
+			factors[channel] = 1
+		} else {
+			factors[channel] = gray / stats.totals[channel]
+		}
+	}
+	return TransformPixelsOneByOne(scaleChannelsTransformation(factors), originalPixels)
+}
+
+// TransformPixelsWhitePatch assumes the brightest part of the scene is white
+// and scales each channel so that its bright end reaches 255.
+func TransformPixelsWhitePatch(originalPixels [][]color.Color, clipPercent float64) ([][]color.Color, error) {
+	stats := gatherChannelStatistics(originalPixels)
+	var factors [3]float64
+	for channel := range factors {
+		brightest := histogramPercentile(stats.histograms[channel], 100-clipPercent)
+		if brightest == 0 {
+			factors[channel] = 1
+		} else {
+			factors[channel] = 255 / float64(brightest)
+		}
+	}
+	return TransformPixelsOneByOne(scaleChannelsTransformation(factors), originalPixels)
+}
+
+// TransformPixelsTemperature tints the image with the color of a light source
+// of the given color temperature.  6500K is neutral, lower values are warmer
+// and higher values are cooler.
+func TransformPixelsTemperature(originalPixels [][]color.Color, kelvin float64) ([][]color.Color, error) {
+	if kelvin < 1000 || kelvin > 40000 {
+		return nil, errors.New("temperature must be between 1000K and 40000K")
+	}
+
+	target := kelvinToRGB(kelvin)
+	neutral := kelvinToRGB(neutralTemperature)
+	var factors [3]float64
+	for channel := range factors {
+		factors[channel] = target[channel] / neutral[channel]
+	}
+
+	// Keep the overall brightness the same
+	brightness := 0.299*factors[0] + 0.587*factors[1] + 0.114*factors[2]
+	for channel := range factors {
+		factors[channel] /= brightness
+	}
+	return TransformPixelsOneByOne(scaleChannelsTransformation(factors), originalPixels)
+}
+
+// TransformPixelsTint shifts the image between green (negative values) and
+// magenta (positive values).  The range is -100 to 100.
+func TransformPixelsTint(originalPixels [][]color.Color, tint float64) ([][]color.Color, error) {
+	if tint < -100 || tint > 100 {
+		return nil, errors.New("tint must be between -100 and 100")
+	}
+
+	shift := tint / 400
+	factors := [3]float64{1 + shift, 1 - 2*shift, 1 + shift}
+	return TransformPixelsOneByOne(scaleChannelsTransformation(factors), originalPixels)
+}
+
+// gatherChannelStatistics counts the unpremultiplied channel values of the
+// visible pixels.  Transparent pixels carry no color and would count as black.
+func gatherChannelStatistics(originalPixels [][]color.Color) channelStatistics {
+	var stats channelStatistics
+	for xIndex := range originalPixels {
+		for yIndex := range originalPixels[xIndex] {
+			pixel := color.NRGBAModel.Convert(originalPixels[xIndex][yIndex]).(color.NRGBA)
+			if pixel.A == 0 {
+				continue
+			}
+			values := [3]uint8{pixel.R, pixel.G, pixel.B}
+			for channel, value := range values {
+				stats.histograms[channel][value]++
+				stats.totals[channel] += float64(value)
+			}
+			stats.count++
+		}
+	}
+	if stats.count > 0 {
+		for channel := range stats.totals {
+			stats.totals[channel] /= float64(stats.count)
+		}
+	}
+	return stats
+}
+
+// histogramPercentile returns the smallest value with at least percent of the
+// counted values at or below it.
+func histogramPercentile(histogram [256]int, percent float64) uint8 {
+	total := 0
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	target := max(1, int(math.Ceil(float64(total)*percent/100)))
+	cumulative := 0
+	for value, count := range histogram {
+		cumulative += count
+		if cumulative >= target {
+			return uint8(value)
+		}
+	}
+	return 255
+}
+
+func levelsTransformation(low [3]float64, high [3]float64) TransformSinglePixelFn {
+	return straightChannelsTransformation(func(channel int, value float64) float64 {
+		if high[channel] <= low[channel] {
+			return value
+		}
+		return (value - low[channel]) * 255 / (high[channel] - low[channel])
+	})
+}
+
+func scaleChannelsTransformation(factors [3]float64) TransformSinglePixelFn {
+	return straightChannelsTransformation(func(channel int, value float64) float64 {
+		return value * factors[channel]
+	})
+}
+
+// straightChannelsTransformation maps the red, green and blue values before
+// they are premultiplied, so the results never exceed the pixel's alpha.
+func straightChannelsTransformation(mapChannel func(channel int, value float64) float64) TransformSinglePixelFn {
+	return func(original color.Color) (color.Color, error) {
+		pixel := color.NRGBAModel.Convert(original).(color.NRGBA)
+		values := []*uint8{&pixel.R, &pixel.G, &pixel.B}
+		for channel, value := range values {
+			*value = clampToUint8(mapChannel(channel, float64(*value)))
+		}
+		return color.RGBAModel.Convert(pixel), nil
+	}
+}
+
+// kelvinToRGB approximates the color of a black body at the given temperature
+// using Tanner Helland's curve fit.
+func kelvinToRGB(kelvin float64) [3]float64 {
+	temperature := kelvin / 100
+	var rgb [3]float64
+
+	if temperature <= 66 {
+		rgb[0] = 255
+		rgb[1] = 99.4708025861*math.Log(temperature) - 161.1195681661
+	} else {
+		rgb[0] = 329.698727446 * math.Pow(temperature-60, -0.1332047592)
+		rgb[1] = 288.1221695283 * math.Pow(temperature-60, -0.0755148492)
+	}
+
+	if temperature >= 66 {
+		rgb[2] = 255
+	} else if temperature <= 19 {
+		rgb[2] = 0
+	} else {
+		rgb[2] = 138.5177312231*math.Log(temperature-10) - 305.0447927307
+	}
+
+	for channel := range rgb {
+		// Avoid dividing by zero for very warm light with no blue at all
+		rgb[channel] = min(max(rgb[channel], 1), 255)
+	}
+	return rgb
+}
+
+func clampToUint8(value float64) uint8 {
+	return uint8(math.Round(min(max(value, 0), 255)))
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+type PercentileTest struct {
+	name     string
+	values   map[int]int
+	percent  float64
+	expected uint8
+}
+
+func toRGBA(pixel color.Color) color.RGBA {
+	return color.RGBAModel.Convert(pixel).(color.RGBA)
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	var tests = []PercentileTest{
+		{"Empty", map[int]int{}, 50, 0},
+		{"SingleValue", map[int]int{42: 10}, 0.5, 42},
+		{"Low", map[int]int{10: 1, 100: 98, 250: 1}, 0.5, 10},
+		{"ClippedLow", map[int]int{10: 1, 100: 98, 250: 1}, 2, 100},
+		{"High", map[int]int{10: 1, 100: 98, 250: 1}, 100, 250},
+		{"ClippedHigh", map[int]int{10: 1, 100: 98, 250: 1}, 98, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var histogram [256]int
+			for value, count := range tt.values {
+				histogram[value] = count
+			}
+			result := histogramPercentile(histogram, tt.percent)
+			if tt.expected != result {
+				t.Errorf("Test %s returned invalid percentile: Expect: %v. Got: %v", tt.name, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTransformPixelsAutoLevels(t *testing.T) {
+	input := createTwoToneArray(SetTestColor(50, 60, 70), SetTestColor(200, 160, 120))
+
+	result, err := TransformPixelsAutoLevels(input, 0.5)
+	if err != nil {
+		t.Fatalf("TransformPixelsAutoLevels returned an unexpected error: %v", err)
+	}
+
+	if result[0][0] != testBlack.color || result[0][1] != testWhite.color {
+		t.Errorf("TransformPixelsAutoLevels did not stretch each channel: %v %v", result[0][0], result[0][1])
+	}
+
+	// Mostly transparent, the transparent pixels must not count as black
+	sparse := create2DArraySingleColor(testBlack)
+	for xIndex := range sparse {
+		for yIndex := range sparse[xIndex] {
+			sparse[xIndex][yIndex] = color.RGBA{}
+		}
+	}
+	sparse[0][0] = SetTestColor(100, 100, 100).color
+	sparse[9][9] = SetTestColor(150, 150, 150).color
+	for _, transform := range []func([][]color.Color, float64) ([][]color.Color, error){TransformPixelsAutoLevels, TransformPixelsAutoContrast} {
+		result, err = transform(sparse, 0.5)
+		if err != nil || result[0][0] != testBlack.color || result[9][9] != testWhite.color {
+			t.Errorf("transparent pixels changed the levels: %v %v %v", result[0][0], result[9][9], err)
+		}
+	}
+
+	uniform, err := TransformPixelsAutoLevels(create2DArraySingleColor(testGray), 0.5)
+	if err != nil || uniform[0][0] != testGray.color {
+		t.Errorf("TransformPixelsAutoLevels changed a uniform image: %v %v", uniform[0][0], err)
+	}
+}
+
+func TestTransformPixelsAutoContrast(t *testing.T) {
+	input := createTwoToneArray(SetTestColor(100, 100, 100), SetTestColor(150, 150, 150))
+
+	result, err := TransformPixelsAutoContrast(input, 0.5)
+	if err != nil {
+		t.Fatalf("TransformPixelsAutoContrast returned an unexpected error: %v", err)
+	}
+
+	if result[0][0] != testBlack.color || result[0][1] != testWhite.color {
+		t.Errorf("TransformPixelsAutoContrast did not stretch the range: %v %v", result[0][0], result[0][1])
+	}
+
+	// Every channel moves by the same amount, so a colored pixel keeps its cast
+	tinted := createTwoToneArray(SetTestColor(100, 100, 120), SetTestColor(140, 140, 160))
+	result, err = TransformPixelsAutoContrast(tinted, 0.5)
+	if err != nil {
+		t.Fatalf("TransformPixelsAutoContrast returned an unexpected error: %v", err)
+	}
+
+	pixel := toRGBA(result[0][0])
+	if pixel.B <= pixel.R {
+		t.Errorf("TransformPixelsAutoContrast removed the color cast: %v", pixel)
+	}
+}
+
+func TestTransformPixelsGrayWorld(t *testing.T) {
+	input := createTwoToneArray(SetTestColor(100, 100, 150), SetTestColor(50, 50, 75))
+
+	result, err := TransformPixelsGrayWorld(input)
+	if err != nil {
+		t.Fatalf("TransformPixelsGrayWorld returned an unexpected error: %v", err)
+	}
+
+	for _, pixel := range []color.RGBA{toRGBA(result[0][0]), toRGBA(result[0][1])} {
+		if pixel.R != pixel.G || pixel.G != pixel.B {
+			t.Errorf("TransformPixelsGrayWorld did not remove the cast: %v", pixel)
+		}
+	}
+
+	empty, err := TransformPixelsGrayWorld([][]color.Color{})
+	if err != nil || len(empty) != 0 {
+		t.Errorf("TransformPixelsGrayWorld returned invalid result for an empty array: %v %v", empty, err)
+	}
+}
+
+func TestTransformPixelsWhitePatch(t *testing.T) {
+	input := createTwoToneArray(SetTestColor(200, 220, 250), SetTestColor(80, 88, 100))
+
+	result, err := TransformPixelsWhitePatch(input, 0.5)
+	if err != nil {
+		t.Fatalf("TransformPixelsWhitePatch returned an unexpected error: %v", err)
+	}
+
+	if result[0][0] != testWhite.color {
+		t.Errorf("TransformPixelsWhitePatch did not make the brightest color white: %v", result[0][0])
+	}
+
+	darker := toRGBA(result[0][1])
+	if darker.R != 102 || darker.G != 102 || darker.B != 102 {
+		t.Errorf("TransformPixelsWhitePatch returned invalid darker color: %v", darker)
+	}
+}
+
+func TestTransformPixelsTemperature(t *testing.T) {
+	neutral, err := TransformPixelsTemperature(create2DArraySingleColor(testGray), neutralTemperature)
+	if err != nil || neutral[0][0] != testGray.color {
+		t.Errorf("TransformPixelsTemperature changed the image at 6500K: %v %v", neutral[0][0], err)
+	}
+
+	warm, err := TransformPixelsTemperature(create2DArraySingleColor(testGray), 3000)
+	if err != nil {
+		t.Fatalf("TransformPixelsTemperature returned an unexpected error: %v", err)
+	}
+	warmPixel := toRGBA(warm[0][0])
+	if warmPixel.R <= warmPixel.B {
+		t.Errorf("TransformPixelsTemperature did not warm the image: %v", warmPixel)
+	}
+
+	cool, err := TransformPixelsTemperature(create2DArraySingleColor(testGray), 12000)
+	if err != nil {
+		t.Fatalf("TransformPixelsTemperature returned an unexpected error: %v", err)
+	}
+	coolPixel := toRGBA(cool[0][0])
+	if coolPixel.B <= coolPixel.R {
+		t.Errorf("TransformPixelsTemperature did not cool the image: %v", coolPixel)
+	}
+
+	_, err = TransformPixelsTemperature(create2DArraySingleColor(testGray), 500)
+	if err == nil || !strings.Contains(err.Error(), "temperature must be between") {
+		t.Errorf("TransformPixelsTemperature should have returned an error. Got: %v", err)
+	}
+}
+
+func TestTransformPixelsTint(t *testing.T) {
+	neutral, err := TransformPixelsTint(create2DArraySingleColor(testGray), 0)
+	if err != nil || neutral[0][0] != testGray.color {
+		t.Errorf("TransformPixelsTint changed the image at 0: %v %v", neutral[0][0], err)
+	}
+
+	magenta, err := TransformPixelsTint(create2DArraySingleColor(testGray), 50)
+	if err != nil {
+		t.Fatalf("TransformPixelsTint returned an unexpected error: %v", err)
+	}
+	magentaPixel := toRGBA(magenta[0][0])
+	if magentaPixel.G >= magentaPixel.R || magentaPixel.R != magentaPixel.B {
+		t.Errorf("TransformPixelsTint did not shift toward magenta: %v", magentaPixel)
+	}
+
+	green, err := TransformPixelsTint(create2DArraySingleColor(testGray), -50)
+	if err != nil {
+		t.Fatalf("TransformPixelsTint returned an unexpected error: %v", err)
+	}
+	greenPixel := toRGBA(green[0][0])
+	if greenPixel.G <= greenPixel.R {
+		t.Errorf("TransformPixelsTint did not shift toward green: %v", greenPixel)
+	}
+
+	_, err = TransformPixelsTint(create2DArraySingleColor(testGray), 150)
+	if err == nil || !strings.Contains(err.Error(), "tint must be between") {
+		t.Errorf("TransformPixelsTint should have returned an error. Got: %v", err)
+	}
+}
+
+func TestScaleChannelsKeepsAlpha(t *testing.T) {
+	// Half transparent, premultiplied, so the channels are already at alpha
+	halfRed := color.RGBA{128, 64, 0, 128}
+	result, err := scaleChannelsTransformation([3]float64{2, 1, 1})(halfRed)
+	if err != nil {
+		t.Fatalf("scaleChannelsTransformation returned an unexpected error: %v", err)
+	}
+	if pixel := toRGBA(result); pixel.R != pixel.A || pixel.A != 128 {
+		t.Errorf("scaling a translucent pixel returned an invalid color: %v", pixel)
+	}
+
+	result, _ = levelsTransformation([3]float64{0, 0, 0}, [3]float64{128, 128, 128})(halfRed)
+	if pixel := toRGBA(result); pixel.R > pixel.A || pixel.G > pixel.A {
+		t.Errorf("levels on a translucent pixel returned an invalid color: %v", pixel)
+	}
+}
+
+func TestKelvinToRGB(t *testing.T) {
+	daylight := kelvinToRGB(6600)
+	if daylight[0] != 255 || daylight[2] != 255 {
+		t.Errorf("kelvinToRGB returned invalid daylight color: %v", daylight)
+	}
+
+	candle := kelvinToRGB(1500)
+	if candle[0] != 255 || candle[2] != 1 || candle[1] >= candle[0] {
+		t.Errorf("kelvinToRGB returned invalid candle color: %v", candle)
+	}
+}
+
+func TestProcessListWithAutoCorrections(t *testing.T) {
+	input := createTwoToneArray(SetTestColor(100, 100, 150), SetTestColor(50, 50, 75))
+	list := []TransformationType{WhiteBalanceGray, WhiteBalanceWhite, AutoLevels, AutoContrast, Temperature, Tint}
+	options := TransformOptions{temperature: 5000, tint: -10}
+
+	result, err := ProcessListOfTransformationsWithOptions(input, list, options)
+	if err != nil {
+		t.Fatalf("ProcessListOfTransformationsWithOptions returned an unexpected error: %v", err)
+	}
+
+	if len(result) != 16 || len(result[0]) != 16 {
+		t.Errorf("auto corrections changed the image size")
+	}
+
+	_, err = ProcessListOfTransformationsWithOptions(input, []TransformationType{Temperature}, TransformOptions{})
+	if err == nil {
+		t.Errorf("temperature step without a temperature should have returned an error")
+	}
+}
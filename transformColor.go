@@ -1,9 +1,8 @@
 package main
 
 import (
-	"errors"
+	"fmt"
 	"image/color"
-	"log"
 )
 
 type TransformSinglePixelFn func(color.Color) (color.Color, error)
@@ -13,16 +12,14 @@ func SinglePixelTransformation(original color.Color, transformRGBA TransformRGBA
 	if ok {
 		newRGBA, err := transformRGBA(pixelRGBA)
 		if err != nil {
-			log.Printf("could not transform RGBA: %v", pixelRGBA)
-			return nil, errors.New("could not transform RGBA data")
+			return nil, fmt.Errorf("could not transform RGBA data %v: %w", pixelRGBA, err)
 		}
 
 		newPixel := color.RGBAModel.Convert(newRGBA)
 		return newPixel, nil
 
 	} else {
-		log.Printf("could not transform pixel: %v", original)
-		return nil, errors.New("could not transform pixel")
+		return nil, fmt.Errorf("could not transform pixel %v", original)
 	}
 }
 
@@ -37,8 +34,7 @@ func PixelBlockTransformation(originals []color.Color) (color.Color, error) {
 
 	newRGBA, err := RGBAAverage(rgbaPixels)
 	if err != nil {
-		log.Printf("could not average RGBA: %v", err)
-		return nil, errors.New("could not average RGBA data")
+		return nil, fmt.Errorf("could not average RGBA data: %w", err)
 	}
 
 	newPixel := color.RGBAModel.Convert(newRGBA)
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+)
+
+const defaultClaheGrid = 8
+
+// Every tile keeps a 256 entry lookup table, so the grid is bounded rather
+// than allowed to approach one tile per pixel.
+const maxClaheGrid = 64
+const defaultClaheClip = 2.0
+
+func EqualizeHistogram(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsEqualize(originalPixels)
+}
+
+// ClaheTransformation returns a CLAHE transform with the given tile grid and
+// clip limit.  Zero values use the defaults.
+func ClaheTransformation(grid int, clipLimit float64) TransformFn {
+	if grid == 0 {
+		grid = defaultClaheGrid
+	}
+	if clipLimit == 0 {
+		clipLimit = defaultClaheClip
+	}
+	return func(originalPixels [][]color.Color) ([][]color.Color, error) {
+		return TransformPixelsClahe(originalPixels, grid, clipLimit)
+	}
+}
+
+// TransformPixelsEqualize spreads the luminance histogram of the whole image
+// evenly over the full range.  Only luminance changes, so hues are kept.
+func TransformPixelsEqualize(originalPixels [][]color.Color) ([][]color.Color, error) {
+	if len(originalPixels) == 0 {
+		return originalPixels, nil
+	}
+
+	histogram := calcLuminanceHistogram(originalPixels, 0, 0, len(originalPixels), len(originalPixels[0]))
+	lookup := calcEqualizeLookup(histogram)
+	return mapLuminance(originalPixels, func(x int, y int, luminance uint8) uint8 {
+		return lookup[luminance]
+	}), nil
+}
+
+// TransformPixelsClahe performs contrast limited adaptive histogram
+// equalization.  The image is split into grid x grid tiles, each tile's
+// histogram is clipped at clipLimit times the average bin count, and every
+// pixel interpolates between the mappings of the four nearest tiles.
+func TransformPixelsClahe(originalPixels [][]color.Color, grid int, clipLimit float64) ([][]color.Color, error) {
+	if grid < 1 || grid > maxClaheGrid {
+		return nil, fmt.Errorf("tile grid must be between 1 and %v", maxClaheGrid)
+	}
+	if clipLimit < 1 {
+		return nil, errors.New("clip limit must be at least 1")
+	}
+	if len(originalPixels) == 0 {
+		return originalPixels, nil
+	}
+
+	width := len(originalPixels)
+	height := len(originalPixels[0])
+	tileWidth := max(1, (width+grid-1)/grid)
+	tileHeight := max(1, (height+grid-1)/grid)
+	tilesX := (width + tileWidth - 1) / tileWidth
+	tilesY := (height + tileHeight - 1) / tileHeight
+
+	lookups := make([][][256]uint8, tilesX)
+	for tileX := range lookups {
+		lookups[tileX] = make([][256]uint8, tilesY)
+		for tileY := range lookups[tileX] {
+			histogram := calcLuminanceHistogram(originalPixels, tileX*tileWidth, tileY*tileHeight, tileWidth, tileHeight)
+			lookups[tileX][tileY] = calcEqualizeLookup(clipHistogram(histogram, clipLimit))
+		}
+	}
+
+	return mapLuminance(originalPixels, func(x int, y int, luminance uint8) uint8 {
+		// Position relative to the tile centers, clamped at the image edges
+		fx := min(max((float64(x)+0.5)/float64(tileWidth)-0.5, 0), float64(tilesX-1))
+		fy := min(max((float64(y)+0.5)/float64(tileHeight)-0.5, 0), float64(tilesY-1))
+		x0, y0 := int(fx), int(fy)
+		x1, y1 := min(x0+1, tilesX-1), min(y0+1, tilesY-1)
+		wx, wy := fx-float64(x0), fy-float64(y0)
+
+		top := float64(lookups[x0][y0][luminance])*(1-wx) + float64(lookups[x1][y0][luminance])*wx
+		bottom := float64(lookups[x0][y1][luminance])*(1-wx) + float64(lookups[x1][y1][luminance])*wx
+		return uint8(math.Round(top*(1-wy) + bottom*wy))
+	}), nil
+}
+
+func pixelLuminance(pixel color.Color) uint8 {
+	pixelRGBA := color.NRGBAModel.Convert(pixel).(color.NRGBA)
+	luminance, _, _ := color.RGBToYCbCr(pixelRGBA.R, pixelRGBA.G, pixelRGBA.B)
+	return luminance
+}
+
+// calcLuminanceHistogram counts the luminance values in a block of pixels,
+// gathered with the same block logic used for pixelation.
+func calcLuminanceHistogram(originalPixels [][]color.Color, startX int, startY int, width int, height int) [256]int {
+	var histogram [256]int
+	pixelBlock, err := getPixelBlockRect(originalPixels, startX, startY, width, height)
+	if err != nil {
+		return histogram
+	}
+	for _, pixel := range pixelBlock {
+		histogram[pixelLuminance(pixel)]++
+	}
+	return histogram
+}
+
+// clipHistogram limits every bin to clipLimit times the average bin count and
+// spreads the excess evenly over all bins.
+func clipHistogram(histogram [256]int, clipLimit float64) [256]int {
+	total := 0
+	for _, count := range histogram {
+		total += count
+	}
+
+	limit := max(1, int(clipLimit*float64(total)/256))
+	excess := 0
+	for index, count := range histogram {
+		if count > limit {
+			excess += count - limit
+			histogram[index] = limit
+		}
+	}
+
+	for index := range histogram {
+		histogram[index] += excess / 256
+	}
+
+	// Spread the remainder over the whole range rather than the lowest bins,
+	// which would brighten the darkest values
+	residual := excess % 256
+	if residual > 0 {
+		step := max(1, 256/residual)
+		for index := 0; index < 256 && residual > 0; index += step {
+			histogram[index]++
+			residual--
+		}
+	}
+	return histogram
+}
+
+func calcEqualizeLookup(histogram [256]int) [256]uint8 {
+	var lookup [256]uint8
+	total := 0
+	cdfMin := 0
+	for _, count := range histogram {
+		if cdfMin == 0 && count > 0 {
+			cdfMin = count
+		}
+		total += count
+	}
+
+	cumulative := 0
+	for index, count := range histogram {
+		cumulative += count
+		if total == cdfMin {
+			// A single luminance value has nothing to spread
+			lookup[index] = uint8(index)
+			continue
+		}
+		lookup[index] = uint8(math.Round(float64(max(cumulative-cdfMin, 0)) / float64(total-cdfMin) * 255))
+	}
+	return lookup
+}
+
+// mapLuminance replaces the luminance of every pixel while keeping its
+// chroma and alpha.
+func mapLuminance(originalPixels [][]color.Color, mapFn func(x int, y int, luminance uint8) uint8) [][]color.Color {
+	var newPixels [][]color.Color
+	for xIndex := 0; xIndex < len(originalPixels); xIndex++ {
+		newCol := make([]color.Color, len(originalPixels[xIndex]))
+		for yIndex := range newCol {
+			pixel := color.NRGBAModel.Convert(originalPixels[xIndex][yIndex]).(color.NRGBA)
+			luminance, cb, cr := color.RGBToYCbCr(pixel.R, pixel.G, pixel.B)
+			r, g, b := color.YCbCrToRGB(mapFn(xIndex, yIndex, luminance), cb, cr)
+			newCol[yIndex] = color.RGBAModel.Convert(color.NRGBA{r, g, b, pixel.A})
+		}
+		newPixels = append(newPixels, newCol)
+	}
+	return newPixels
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func createTwoToneArray(first TestColor, second TestColor) [][]color.Color {
+	var xArray [][]color.Color
+	for xIndex := 0; xIndex < 16; xIndex++ {
+		var yArray []color.Color
+		for yIndex := 0; yIndex < 16; yIndex++ {
+			if (xIndex+yIndex)%2 == 0 {
+				yArray = append(yArray, first.color)
+			} else {
+				yArray = append(yArray, second.color)
+			}
+		}
+		xArray = append(xArray, yArray)
+	}
+	return xArray
+}
+
+func TestCalcEqualizeLookup(t *testing.T) {
+	var twoValues [256]int
+	twoValues[50] = 10
+	twoValues[100] = 10
+
+	lookup := calcEqualizeLookup(twoValues)
+	if lookup[50] != 0 || lookup[100] != 255 {
+		t.Errorf("calcEqualizeLookup returned invalid mapping: %v %v", lookup[50], lookup[100])
+	}
+
+	var oneValue [256]int
+	oneValue[80] = 25
+	lookup = calcEqualizeLookup(oneValue)
+	if lookup[80] != 80 || lookup[10] != 10 {
+		t.Errorf("calcEqualizeLookup changed a single value histogram: %v %v", lookup[80], lookup[10])
+	}
+
+	var emptyHistogram [256]int
+	lookup = calcEqualizeLookup(emptyHistogram)
+	if lookup[200] != 200 {
+		t.Errorf("calcEqualizeLookup changed an empty histogram: %v", lookup[200])
+	}
+}
+
+func TestClipHistogram(t *testing.T) {
+	var histogram [256]int
+	histogram[10] = 1000
+	histogram[20] = 24
+
+	clipped := clipHistogram(histogram, 2)
+
+	total := 0
+	for _, count := range clipped {
+		total += count
+	}
+	if total != 1024 {
+		t.Errorf("clipHistogram changed the pixel count: Expect: %v. Got: %v", 1024, total)
+	}
+
+	// The limit is 2 * 1024 / 256 = 8, plus an even share of the excess
+	if clipped[10] > 8+(1000+16)/256+1 {
+		t.Errorf("clipHistogram did not clip the tallest bin: %v", clipped[10])
+	}
+
+	if clipped[200] == 0 {
+		t.Errorf("clipHistogram did not redistribute the excess")
+	}
+}
+
+func TestTransformPixelsEqualize(t *testing.T) {
+	dark := SetTestColor(100, 100, 100)
+	light := SetTestColor(150, 150, 150)
+
+	result, err := TransformPixelsEqualize(createTwoToneArray(dark, light))
+	if err != nil {
+		t.Fatalf("TransformPixelsEqualize returned an unexpected error: %v", err)
+	}
+
+	if result[0][0] != testBlack.color || result[0][1] != testWhite.color {
+		t.Errorf("TransformPixelsEqualize did not stretch the histogram: %v %v", result[0][0], result[0][1])
+	}
+
+	empty, err := TransformPixelsEqualize([][]color.Color{})
+	if err != nil || len(empty) != 0 {
+		t.Errorf("TransformPixelsEqualize returned invalid result for an empty array: %v %v", empty, err)
+	}
+}
+
+func TestEqualizeKeepsHue(t *testing.T) {
+	darkRed := SetTestColor(120, 40, 40)
+	lightRed := SetTestColor(200, 90, 90)
+
+	result, err := TransformPixelsEqualize(createTwoToneArray(darkRed, lightRed))
+	if err != nil {
+		t.Fatalf("TransformPixelsEqualize returned an unexpected error: %v", err)
+	}
+
+	for _, pixel := range []color.Color{result[0][0], result[0][1]} {
+		rgba := color.RGBAModel.Convert(pixel).(color.RGBA)
+		// Converting to and from YCbCr can round green and blue apart by one
+		if !(rgba.R > rgba.G && abs(int(rgba.G)-int(rgba.B)) <= 1) {
+			t.Errorf("TransformPixelsEqualize changed the hue: %v", rgba)
+		}
+	}
+}
+
+func TestTransformPixelsClahe(t *testing.T) {
+	dark := SetTestColor(100, 100, 100)
+	light := SetTestColor(150, 150, 150)
+
+	result, err := TransformPixelsClahe(createTwoToneArray(dark, light), 2, 4)
+	if err != nil {
+		t.Fatalf("TransformPixelsClahe returned an unexpected error: %v", err)
+	}
+
+	newDark := color.RGBAModel.Convert(result[5][5]).(color.RGBA)
+	newLight := color.RGBAModel.Convert(result[5][6]).(color.RGBA)
+	if int(newLight.R)-int(newDark.R) <= int(light.rgb.R)-int(dark.rgb.R) {
+		t.Errorf("TransformPixelsClahe did not increase contrast: %v %v", newDark, newLight)
+	}
+
+	var tests = []struct {
+		name    string
+		grid    int
+		clip    float64
+		errText string
+	}{
+		{"BadGrid", 0, 2, "tile grid must be between 1 and 64"},
+		{"LargeGrid", 65, 2, "tile grid must be between 1 and 64"},
+		{"BadClip", 8, 0.5, "clip limit must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TransformPixelsClahe(createTwoToneArray(dark, light), tt.grid, tt.clip)
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("Test %s returned incorrect error. Want: %s. Got: %v", tt.name, tt.errText, err)
+			}
+		})
+	}
+
+	// More tiles than pixels still works
+	small, err := TransformPixelsClahe([][]color.Color{{testWhite.color, testBlack.color}}, 8, 2)
+	if err != nil || len(small) != 1 || len(small[0]) != 2 {
+		t.Errorf("TransformPixelsClahe returned invalid result for a tiny image: %v %v", small, err)
+	}
+}
+
+func TestProcessListWithHistogram(t *testing.T) {
+	dark := SetTestColor(100, 100, 100)
+	light := SetTestColor(150, 150, 150)
+
+	result, err := ProcessListOfTransformations(createTwoToneArray(dark, light), []TransformationType{Equalize})
+	if err != nil || result[0][0] != testBlack.color {
+		t.Errorf("equalize step returned invalid result: %v %v", result[0][0], err)
+	}
+
+	options := TransformOptions{claheGrid: 4, claheClip: 3}
+	_, err = ProcessListOfTransformationsWithOptions(createTwoToneArray(dark, light), []TransformationType{Clahe}, options)
+	if err != nil {
+		t.Errorf("clahe step returned an unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// MosaicCellFn maps a pixel position to the identifier of the mosaic cell it
+// belongs to.  All pixels returning the same identifier are averaged together.
+type MosaicCellFn func(x int, y int) [3]int
+
+const voronoiSeed = 1
+
+var voronoiCellCounts = map[TransformationType]int{Voronoi100: 100, Voronoi500: 500}
+
+var dotBackground = color.RGBAModel.Convert(color.RGBA{0, 0, 0, 255})
+
+func HexagonMosaic10(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsHexagon(originalPixels, 10)
+}
+
+func HexagonMosaic20(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsHexagon(originalPixels, 20)
+}
+
+func TriangleMosaic10(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsTriangle(originalPixels, 10)
+}
+
+func TriangleMosaic20(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsTriangle(originalPixels, 20)
+}
+
+func DotMosaic10(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsDots(originalPixels, 10, dotBackground)
+}
+
+func DotMosaic20(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsDots(originalPixels, 20, dotBackground)
+}
+
+func VoronoiMosaic100(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsVoronoi(originalPixels, voronoiCellCounts[Voronoi100], voronoiSeed)
+}
+
+func VoronoiMosaic500(originalPixels [][]color.Color) ([][]color.Color, error) {
+	return TransformPixelsVoronoi(originalPixels, voronoiCellCounts[Voronoi500], voronoiSeed)
+}
+
+func TransformPixelsHexagon(originalPixels [][]color.Color, size int) ([][]color.Color, error) {
+	if size < 1 {
+		return nil, errors.New("cell size must be at least 1")
+	}
+	return TransformPixelsByCell(originalPixels, hexagonCell(float64(size)))
+}
+
+func TransformPixelsTriangle(originalPixels [][]color.Color, size int) ([][]color.Color, error) {
+	if size < 1 {
+		return nil, errors.New("cell size must be at least 1")
+	}
+	return TransformPixelsByCell(originalPixels, triangleCell(float64(size)))
+}
+
+func TransformPixelsVoronoi(originalPixels [][]color.Color, cells int, seed int64) ([][]color.Color, error) {
+	if cells < 1 {
+		return nil, errors.New("cell count must be at least 1")
+	}
+	if len(originalPixels) == 0 {
+		return originalPixels, nil
+	}
+	return TransformPixelsByCell(originalPixels, voronoiCell(len(originalPixels), len(originalPixels[0]), cells, seed))
+}
+
+// TransformPixelsByCell averages the colors of every pixel in a cell and
+// paints the whole cell with that average.
+func TransformPixelsByCell(originalPixels [][]color.Color, cellOf MosaicCellFn) ([][]color.Color, error) {
+	cellPixels := make(map[[3]int][]color.Color)
+	for xIndex := 0; xIndex < len(originalPixels); xIndex++ {
+		for yIndex := 0; yIndex < len(originalPixels[xIndex]); yIndex++ {
+			cell := cellOf(xIndex, yIndex)
+			cellPixels[cell] = append(cellPixels[cell], originalPixels[xIndex][yIndex])
+		}
+	}
+
+	cellColors := make(map[[3]int]color.Color, len(cellPixels))
+	for cell, pixels := range cellPixels {
+		newColor, err := PixelBlockTransformation(pixels)
+		if err != nil {
+			return nil, errors.New("could not calculate cell color")
+		}
+		cellColors[cell] = newColor
+	}
+
+	var transformedPixels [][]color.Color
+	for xIndex := 0; xIndex < len(originalPixels); xIndex++ {
+		newCol := make([]color.Color, len(originalPixels[xIndex]))
+		for yIndex := range newCol {
+			newCol[yIndex] = cellColors[cellOf(xIndex, yIndex)]
+		}
+		transformedPixels = append(transformedPixels, newCol)
+	}
+
+	return transformedPixels, nil
+}
+
+// TransformPixelsDots averages each size x size block and draws it as a
+// circle inscribed in the block.  Pixels outside the circles are set to the
+// background color.
+func TransformPixelsDots(originalPixels [][]color.Color, size int, background color.Color) ([][]color.Color, error) {
+	if size < 1 {
+		return nil, errors.New("cell size must be at least 1")
+	}
+
+	var transformedPixels [][]color.Color
+	for xIndex := 0; xIndex < len(originalPixels); xIndex++ {
+		transformedPixels = append(transformedPixels, make([]color.Color, len(originalPixels[xIndex])))
+	}
+
+	radius := float64(size) / 2
+	for xIndex := 0; xIndex < len(originalPixels); xIndex += size {
+		for yIndex := 0; yIndex < len(originalPixels[xIndex]); yIndex += size {
+
+			pixelBlock, err := getPixelBlock(originalPixels, xIndex, yIndex, size)
+			if err != nil {
+				return nil, errors.New("could not get pixel block")
+			}
+
+			newColor, err := PixelBlockTransformation(pixelBlock)
+			if err != nil {
+				return nil, errors.New("could not calculate pixel block color")
+			}
+
+			for x := xIndex; x < len(transformedPixels) && x < xIndex+size; x++ {
+				for y := yIndex; y < len(transformedPixels[x]) && y < yIndex+size; y++ {
+					dx := float64(x-xIndex) + 0.5 - radius
+					dy := float64(y-yIndex) + 0.5 - radius
+					if dx*dx+dy*dy <= radius*radius {
+						transformedPixels[x][y] = newColor
+					} else {
+						transformedPixels[x][y] = background
+					}
+				}
+			}
+		}
+	}
+
+	return transformedPixels, nil
+}
+
+// hexagonCell returns a cell function for pointy-top hexagons whose
+// circumradius is size, using axial coordinates rounded to the nearest hex.
+func hexagonCell(size float64) MosaicCellFn {
+	return func(x int, y int) [3]int {
+		px := float64(x) + 0.5
+		py := float64(y) + 0.5
+		q := (math.Sqrt(3)/3*px - py/3) / size
+		r := (2.0 / 3.0 * py) / size
+		s := -q - r
+
+		rq := math.Round(q)
+		rr := math.Round(r)
+		rs := math.Round(s)
+		dq := math.Abs(rq - q)
+		dr := math.Abs(rr - r)
+		ds := math.Abs(rs - s)
+		if dq > dr && dq > ds {
+			rq = -rr - rs
+		} else if dr > ds {
+			rr = -rq - rs
+		}
+		return [3]int{int(rq), int(rr), 0}
+	}
+}
+
+// triangleCell returns a cell function for a tessellation of equilateral
+// triangles with the given side length.  Each triangle is bounded by one line
+// from each of three families, so the three line indexes identify it.
+func triangleCell(size float64) MosaicCellFn {
+	height := size * math.Sqrt(3) / 2
+	return func(x int, y int) [3]int {
+		px := float64(x) + 0.5
+		py := float64(y) + 0.5
+		row := math.Floor(py / height)
+		left := math.Floor(px/size - py/(2*height))
+		right := math.Floor(px/size + py/(2*height))
+		return [3]int{int(row), int(left), int(right)}
+	}
+}
+
+// voronoiCell scatters cells seed points over the image and assigns every
+// pixel to its nearest seed.  The same seed always yields the same cells.
+func voronoiCell(width int, height int, cells int, seed int64) MosaicCellFn {
+	random := rand.New(rand.NewSource(seed))
+	seedX := make([]float64, cells)
+	seedY := make([]float64, cells)
+	for index := 0; index < cells; index++ {
+		seedX[index] = random.Float64() * float64(width)
+		seedY[index] = random.Float64() * float64(height)
+	}
+
+	nearest := make([][]int, width)
+	for xIndex := 0; xIndex < width; xIndex++ {
+		nearest[xIndex] = make([]int, height)
+		for yIndex := 0; yIndex < height; yIndex++ {
+			bestIndex := 0
+			bestDistance := math.MaxFloat64
+			for index := 0; index < cells; index++ {
+				dx := seedX[index] - float64(xIndex)
+				dy := seedY[index] - float64(yIndex)
+				distance := dx*dx + dy*dy
+				if distance < bestDistance {
+					bestDistance = distance
+					bestIndex = index
+				}
+			}
+			nearest[xIndex][yIndex] = bestIndex
+		}
+	}
+
+	return func(x int, y int) [3]int {
+		if x < len(nearest) && y < len(nearest[x]) {
+			return [3]int{nearest[x][y], 0, 0}
+		}
+		return [3]int{-1, 0, 0}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+type MosaicTest struct {
+	name      string
+	fnToTest  TransformFn
+	input     [][]color.Color
+	expected  [][]color.Color
+	expectErr bool
+	errText   string
+}
+
+type MosaicCellTest struct {
+	name      string
+	cellOf    MosaicCellFn
+	firstX    int
+	firstY    int
+	secondX   int
+	secondY   int
+	expectSet bool
+}
+
+func create2DArrayHalves(left TestColor, right TestColor, size int) [][]color.Color {
+	var xArray [][]color.Color
+	for xIndex := 0; xIndex < size; xIndex++ {
+		var yArray []color.Color
+		for yIndex := 0; yIndex < size; yIndex++ {
+			if xIndex < size/2 {
+				yArray = append(yArray, left.color)
+			} else {
+				yArray = append(yArray, right.color)
+			}
+		}
+		xArray = append(xArray, yArray)
+	}
+	return xArray
+}
+
+func TestTransformPixelsByCell(t *testing.T) {
+	oneCell := func(x int, y int) [3]int { return [3]int{} }
+	columnCells := func(x int, y int) [3]int { return [3]int{x, 0, 0} }
+
+	var tests = []struct {
+		name     string
+		cellOf   MosaicCellFn
+		input    [][]color.Color
+		expected [][]color.Color
+	}{
+		{"OriginalEmpty", oneCell, [][]color.Color{}, [][]color.Color{}},
+		{"OneCell", oneCell, [][]color.Color{{testWhite.color, testBlack.color}}, [][]color.Color{{testGray.color, testGray.color}}},
+		{"ColumnCells", columnCells, [][]color.Color{
+			{testWhite.color, testBlack.color},
+			{testRed.color, testRed.color},
+		}, [][]color.Color{
+			{testGray.color, testGray.color},
+			{testRed.color, testRed.color},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := TransformPixelsByCell(tt.input, tt.cellOf)
+			if err != nil {
+				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			if len(tt.expected) != len(result) {
+				t.Fatalf("Test %s returned invalid result: Expect: %v. Got: %v", tt.name, tt.expected, result)
+			}
+
+			for xIndex := 0; xIndex < len(tt.expected); xIndex++ {
+				for yIndex := 0; yIndex < len(tt.expected[xIndex]); yIndex++ {
+					if tt.expected[xIndex][yIndex] != result[xIndex][yIndex] {
+						t.Errorf("Test %s returned invalid pixel result: Expect: %v. Got: %v", tt.name, tt.expected[xIndex][yIndex], result[xIndex][yIndex])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMosaicTransformations(t *testing.T) {
+	hexagonZero := func(p [][]color.Color) ([][]color.Color, error) { return TransformPixelsHexagon(p, 0) }
+	triangleZero := func(p [][]color.Color) ([][]color.Color, error) { return TransformPixelsTriangle(p, 0) }
+	dotZero := func(p [][]color.Color) ([][]color.Color, error) { return TransformPixelsDots(p, 0, testBlack.color) }
+	voronoiZero := func(p [][]color.Color) ([][]color.Color, error) { return TransformPixelsVoronoi(p, 0, 1) }
+	voronoiOne := func(p [][]color.Color) ([][]color.Color, error) { return TransformPixelsVoronoi(p, 1, 1) }
+
+	var tests = []MosaicTest{
+		{"Hexagon10-Uniform", HexagonMosaic10, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
+		{"Hexagon20-Uniform", HexagonMosaic20, create2DArraySingleColor(testBlue), create2DArraySingleColor(testBlue), false, ""},
+		{"Triangle10-Uniform", TriangleMosaic10, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
+		{"Triangle20-Uniform", TriangleMosaic20, create2DArraySingleColor(testGreen), create2DArraySingleColor(testGreen), false, ""},
+		{"Voronoi100-Uniform", VoronoiMosaic100, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
+		{"Voronoi500-Uniform", VoronoiMosaic500, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
+		{"Voronoi-OneCell", voronoiOne, create2DArrayHalves(testWhite, testBlack, 10), create2DArraySingleColor(testGray), false, ""},
+		{"Dot10-Uniform", DotMosaic10, [][]color.Color{
+			{testRed.color, testRed.color, testRed.color, testRed.color},
+			{testRed.color, testRed.color, testRed.color, testRed.color},
+			{testRed.color, testRed.color, testRed.color, testRed.color},
+			{testRed.color, testRed.color, testRed.color, testRed.color},
+		}, [][]color.Color{
+			{testBlack.color, testBlack.color, testBlack.color, testRed.color},
+			{testBlack.color, testRed.color, testRed.color, testRed.color},
+			{testBlack.color, testRed.color, testRed.color, testRed.color},
+			{testRed.color, testRed.color, testRed.color, testRed.color},
+		}, false, ""},
+		{"Hexagon-BadSize", hexagonZero, create2DArraySingleColor(testRed), nil, true, "cell size must be at least 1"},
+		{"Triangle-BadSize", triangleZero, create2DArraySingleColor(testRed), nil, true, "cell size must be at least 1"},
+		{"Dot-BadSize", dotZero, create2DArraySingleColor(testRed), nil, true, "cell size must be at least 1"},
+		{"Voronoi-BadCount", voronoiZero, create2DArraySingleColor(testRed), nil, true, "cell count must be at least 1"},
+		{"Voronoi-Empty", VoronoiMosaic100, [][]color.Color{}, [][]color.Color{}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.fnToTest(tt.input)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			if err != nil && tt.expectErr {
+				if !strings.Contains(err.Error(), tt.errText) {
+					t.Errorf("Test %s returned incorrect error. Want: %s. Got: %v", tt.name, tt.errText, err)
+				}
+			}
+
+			if err == nil && tt.expectErr {
+				t.Errorf("Test %s should have returned an error, but did not", tt.name)
+			}
+
+			if err == nil && !tt.expectErr {
+				if len(tt.expected) != len(result) {
+					t.Fatalf("Test %s returned invalid result: Expect: %v. Got: %v", tt.name, tt.expected, result)
+				}
+
+				for xIndex := 0; xIndex < len(tt.expected); xIndex++ {
+					for yIndex := 0; yIndex < len(tt.expected[xIndex]); yIndex++ {
+						if tt.expected[xIndex][yIndex] != result[xIndex][yIndex] {
+							t.Errorf("Test %s returned invalid pixel result at %d,%d: Expect: %v. Got: %v", tt.name, xIndex, yIndex, tt.expected[xIndex][yIndex], result[xIndex][yIndex])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDotsUseEveryBlock(t *testing.T) {
+	input := [][]color.Color{
+		{testWhite.color, testWhite.color, testRed.color, testRed.color},
+		{testWhite.color, testWhite.color, testRed.color, testRed.color},
+		{testBlue.color, testBlue.color, testGreen.color, testGreen.color},
+		{testBlue.color, testBlue.color, testGreen.color, testGreen.color},
+	}
+
+	result, err := TransformPixelsDots(input, 2, testBlack.color)
+	if err != nil {
+		t.Fatalf("TransformPixelsDots returned an unexpected error: %v", err)
+	}
+
+	// A 2x2 circle covers all four pixel centers, so every block keeps its color
+	for xIndex := 0; xIndex < len(input); xIndex++ {
+		for yIndex := 0; yIndex < len(input[xIndex]); yIndex++ {
+			if input[xIndex][yIndex] != result[xIndex][yIndex] {
+				t.Errorf("TransformPixelsDots returned invalid pixel result at %d,%d: Expect: %v. Got: %v", xIndex, yIndex, input[xIndex][yIndex], result[xIndex][yIndex])
+			}
+		}
+	}
+}
+
+func TestMosaicCells(t *testing.T) {
+	var tests = []MosaicCellTest{
+		{"HexagonNeighbors", hexagonCell(10), 20, 20, 21, 21, true},
+		{"HexagonFarApart", hexagonCell(10), 0, 0, 40, 0, false},
+		{"HexagonVertical", hexagonCell(10), 5, 0, 5, 30, false},
+		{"TriangleNeighbors", triangleCell(10), 10, 4, 11, 4, true},
+		{"TriangleAcrossRow", triangleCell(10), 10, 7, 10, 10, false},
+		{"TriangleUpAndDown", triangleCell(10), 1, 7, 5, 1, false},
+		{"VoronoiSamePixel", voronoiCell(10, 10, 5, 1), 3, 3, 3, 3, true},
+		{"VoronoiOneCell", voronoiCell(10, 10, 1, 1), 0, 0, 9, 9, true},
+		{"VoronoiOutOfRange", voronoiCell(10, 10, 1, 1), 0, 0, 20, 20, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := tt.cellOf(tt.firstX, tt.firstY)
+			second := tt.cellOf(tt.secondX, tt.secondY)
+			if (first == second) != tt.expectSet {
+				t.Errorf("Test %s returned invalid cells: First: %v. Second: %v. Expect same: %v", tt.name, first, second, tt.expectSet)
+			}
+		})
+	}
+}
+
+func TestVoronoiIsDeterministic(t *testing.T) {
+	first := voronoiCell(30, 30, 20, 7)
+	second := voronoiCell(30, 30, 20, 7)
+
+	for xIndex := 0; xIndex < 30; xIndex++ {
+		for yIndex := 0; yIndex < 30; yIndex++ {
+			if first(xIndex, yIndex) != second(xIndex, yIndex) {
+				t.Fatalf("voronoiCell returned different cells for the same seed at %d,%d", xIndex, yIndex)
+			}
+		}
+	}
+}
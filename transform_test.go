@@ -42,6 +42,15 @@ type TransformNxNTest struct {
 	errText   string
 }
 
+type TransformResizeTest struct {
+	name      string
+	input     [][]color.Color
+	size      int
+	expect    [][]color.Color
+	expectErr bool
+	errText   string
+}
+
 type GetPixelTest struct {
 	name        string
 	inputPixels [][]color.Color
@@ -127,6 +136,17 @@ func TestProcessListOfTransformations(t *testing.T) {
 		{"Pixel-20", []TransformationType{Pixel20}, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
 		{"Pixel-50", []TransformationType{Pixel50}, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
 		{"Multiple 1", []TransformationType{ShiftLeft, ShiftRight}, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
+		{"Downsample-10", []TransformationType{Downsample10}, create2DArraySingleColor(testRed), [][]color.Color{{testRed.color}}, false, ""},
+		{"Downsample-3", []TransformationType{Downsample3}, create2DArraySingleColor(testRed), [][]color.Color{
+			{testRed.color, testRed.color, testRed.color, testRed.color},
+			{testRed.color, testRed.color, testRed.color, testRed.color},
+			{testRed.color, testRed.color, testRed.color, testRed.color},
+			{testRed.color, testRed.color, testRed.color, testRed.color},
+		}, false, ""},
+		{"Hexagon-10", []TransformationType{Hexagon10}, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
+		{"Triangle-10", []TransformationType{Triangle10}, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
+		{"Voronoi-100", []TransformationType{Voronoi100}, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
+		{"Downsample-Upscale", []TransformationType{Downsample10, Upscale10}, create2DArraySingleColor(testRed), create2DArraySingleColor(testRed), false, ""},
 	}
 
 	for _, tt := range tests {
@@ -459,6 +479,146 @@ func TestTransformPixelsTenByTen(t *testing.T) {
 	}
 }
 
+func TestTransformPixelsDownsampleNxN(t *testing.T) {
+	var tests = []TransformResizeTest{
+		{"OriginalEmpty", [][]color.Color{}, 2, [][]color.Color{}, false, ""},
+		{"BadSize", [][]color.Color{{testWhite.color}}, 0, nil, true, "block size must be at least 1"},
+		{"SizeOne", [][]color.Color{{testWhite.color, testBlack.color}}, 1, [][]color.Color{{testWhite.color, testBlack.color}}, false, ""},
+		{"TwoByTwo", [][]color.Color{
+			{testWhite.color, testWhite.color, testRed.color, testRed.color},
+			{testBlack.color, testBlack.color, testRed.color, testRed.color},
+			{testBlue.color, testBlue.color, testGreen.color, testGreen.color},
+			{testBlue.color, testBlue.color, testGreen.color, testGreen.color},
+		}, 2, [][]color.Color{
+			{testGray.color, testRed.color},
+			{testBlue.color, testGreen.color},
+		}, false, ""},
+		{"PartialBlocks", [][]color.Color{
+			{testWhite.color, testWhite.color, testRed.color},
+			{testBlack.color, testBlack.color, testRed.color},
+			{testBlue.color, testBlue.color, testGreen.color},
+		}, 2, [][]color.Color{
+			{testGray.color, testRed.color},
+			{testBlue.color, testGreen.color},
+		}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := TransformPixelsDownsampleNxN(tt.input, tt.size)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			if err != nil && tt.expectErr {
+				if !strings.Contains(err.Error(), tt.errText) {
+					t.Errorf("Test %s returned incorrect error. Want: %s. Got: %v", tt.name, tt.errText, err)
+				}
+			}
+
+			if err == nil && tt.expectErr {
+				t.Errorf("Test %s should have returned an error, but did not", tt.name)
+			}
+
+			if err == nil && !tt.expectErr {
+				if len(tt.expect) != len(result) {
+					t.Fatalf("Test %s returned invalid result: Expect: %v. Got: %v", tt.name, tt.expect, result)
+				}
+
+				for xIndex := 0; xIndex < len(tt.expect); xIndex++ {
+					if len(tt.expect[xIndex]) != len(result[xIndex]) {
+						t.Fatalf("Test %s returned invalid column length: Expect: %v. Got: %v", tt.name, len(tt.expect[xIndex]), len(result[xIndex]))
+					}
+					for yIndex := 0; yIndex < len(tt.expect[xIndex]); yIndex++ {
+						if tt.expect[xIndex][yIndex] != result[xIndex][yIndex] {
+							t.Errorf("Test %s returned invalid pixel result: Expect: %v. Got: %v", tt.name, tt.expect[xIndex][yIndex], result[xIndex][yIndex])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTransformPixelsDownsampleRect(t *testing.T) {
+	pixels := [][]color.Color{
+		{testWhite.color, testBlack.color, testRed.color, testRed.color},
+		{testWhite.color, testBlack.color, testRed.color, testRed.color},
+	}
+	result, err := TransformPixelsDownsampleRect(pixels, 2, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result) != 1 || len(result[0]) != 2 {
+		t.Fatalf("expected 1x2 pixels, got %v", result)
+	}
+	if result[0][0] != testGray.color || result[0][1] != testRed.color {
+		t.Errorf("unexpected colors %v", result[0])
+	}
+
+	if _, err := TransformPixelsDownsampleRect(pixels, 2, 0); err == nil {
+		t.Errorf("expected an error for a zero height")
+	}
+}
+
+func TestTransformPixelsUpscale(t *testing.T) {
+	var tests = []TransformResizeTest{
+		{"OriginalEmpty", [][]color.Color{}, 2, [][]color.Color{}, false, ""},
+		{"BadFactor", [][]color.Color{{testWhite.color}}, 0, nil, true, "upscale factor must be at least 1"},
+		{"FactorOne", [][]color.Color{{testWhite.color, testBlack.color}}, 1, [][]color.Color{{testWhite.color, testBlack.color}}, false, ""},
+		{"FactorTwo", [][]color.Color{
+			{testWhite.color, testRed.color},
+			{testBlue.color, testGreen.color},
+		}, 2, [][]color.Color{
+			{testWhite.color, testWhite.color, testRed.color, testRed.color},
+			{testWhite.color, testWhite.color, testRed.color, testRed.color},
+			{testBlue.color, testBlue.color, testGreen.color, testGreen.color},
+			{testBlue.color, testBlue.color, testGreen.color, testGreen.color},
+		}, false, ""},
+		{"FactorThreeSingleRow", [][]color.Color{{testWhite.color}}, 3, [][]color.Color{
+			{testWhite.color, testWhite.color, testWhite.color},
+			{testWhite.color, testWhite.color, testWhite.color},
+			{testWhite.color, testWhite.color, testWhite.color},
+		}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := TransformPixelsUpscale(tt.input, tt.size)
+			if err != nil && !tt.expectErr {
+				t.Errorf("Test %s returned an unexpected error: %v", tt.name, err)
+			}
+
+			if err != nil && tt.expectErr {
+				if !strings.Contains(err.Error(), tt.errText) {
+					t.Errorf("Test %s returned incorrect error. Want: %s. Got: %v", tt.name, tt.errText, err)
+				}
+			}
+
+			if err == nil && tt.expectErr {
+				t.Errorf("Test %s should have returned an error, but did not", tt.name)
+			}
+
+			if err == nil && !tt.expectErr {
+				if len(tt.expect) != len(result) {
+					t.Fatalf("Test %s returned invalid result: Expect: %v. Got: %v", tt.name, tt.expect, result)
+				}
+
+				for xIndex := 0; xIndex < len(tt.expect); xIndex++ {
+					if len(tt.expect[xIndex]) != len(result[xIndex]) {
+						t.Fatalf("Test %s returned invalid column length: Expect: %v. Got: %v", tt.name, len(tt.expect[xIndex]), len(result[xIndex]))
+					}
+					for yIndex := 0; yIndex < len(tt.expect[xIndex]); yIndex++ {
+						if tt.expect[xIndex][yIndex] != result[xIndex][yIndex] {
+							t.Errorf("Test %s returned invalid pixel result: Expect: %v. Got: %v", tt.name, tt.expect[xIndex][yIndex], result[xIndex][yIndex])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
 func TestGetPixelBlock(t *testing.T) {
 	var tests = []GetPixelTest{
 		{"NoOriginal", [][]color.Color{}, 0, 0, 1, nil, true, "x value too big"},
@@ -513,6 +673,35 @@ func TestGetPixelBlock(t *testing.T) {
 
 }
 
+func TestGetPixelBlockRect(t *testing.T) {
+	pixels := [][]color.Color{
+		{testGray.color, testGray.color, testGray.color},
+		{testBlue.color, testRed.color, testGray.color},
+		{testWhite.color, testBlack.color, testGray.color},
+	}
+
+	result, err := getPixelBlockRect(pixels, 1, 0, 5, 2)
+	if err != nil {
+		t.Fatalf("getPixelBlockRect returned an unexpected error: %v", err)
+	}
+
+	expected := []color.Color{testBlue.color, testRed.color, testWhite.color, testBlack.color}
+	if len(expected) != len(result) {
+		t.Fatalf("getPixelBlockRect returned invalid result: Expect: %v. Got: %v", expected, result)
+	}
+
+	for index := range expected {
+		if expected[index] != result[index] {
+			t.Errorf("getPixelBlockRect returned invalid pixel result: Expect: %v. Got: %v", expected[index], result[index])
+		}
+	}
+
+	_, err = getPixelBlockRect(pixels, 0, 3, 1, 1)
+	if err == nil || !strings.Contains(err.Error(), "y value too big") {
+		t.Errorf("getPixelBlockRect should have returned an error. Got: %v", err)
+	}
+}
+
 func TestSetPixelBlock(t *testing.T) {
 	var tests = []SetPixelTest{
 		{"NoOriginal1", [][]color.Color{}, testGray.color, 0, 0, 1, nil, true, "x value too big"},
@@ -582,3 +771,35 @@ func TestSetPixelBlock(t *testing.T) {
 		})
 	}
 }
+
+func FuzzTransformPixelsNxN(f *testing.F) {
+	f.Add(uint8(10), uint8(7), 3, uint32(1))
+	f.Add(uint8(1), uint8(1), 1, uint32(2))
+	f.Add(uint8(0), uint8(5), 2, uint32(3))
+	f.Add(uint8(4), uint8(4), 50, uint32(4))
+
+	f.Fuzz(func(t *testing.T, width uint8, height uint8, size int, seed uint32) {
+		pixels := make([][]color.Color, width)
+		for x := range pixels {
+			pixels[x] = make([]color.Color, height)
+			for y := range pixels[x] {
+				value := seed * uint32(x*31+y*17+1)
+				pixels[x][y] = color.RGBA{uint8(value), uint8(value >> 8), uint8(value >> 16), uint8(value >> 24)}
+			}
+		}
+
+		result, err := TransformPixelsNxN(pixels, size)
+		if err != nil {
+			return
+		}
+
+		if len(result) != int(width) {
+			t.Fatalf("expected width %v, got %v", width, len(result))
+		}
+		for x := range result {
+			if len(result[x]) != int(height) {
+				t.Fatalf("expected height %v, got %v", height, len(result[x]))
+			}
+		}
+	})
+}
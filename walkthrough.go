@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultWalkthroughDelay = 1000
+const maxWalkthroughDelay = 60000
+
+// Milliseconds each crossfade frame is shown.
+const walkthroughFadeDelay = 40
+
+type WalkthroughSettings struct {
+	file string
+	// Milliseconds each step is shown
+	delay int
+	// Number of blended frames between steps
+	fade   int
+	labels bool
+}
+
+// WalkthroughFrame is the image after a step, with the label shown for it.
+type WalkthroughFrame struct {
+	label  string
+	pixels [][]color.Color
+}
+
+func checkWalkthroughFile(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif", ".png", ".apng":
+		return nil
+	}
+	return fmt.Errorf("walkthrough must be a .gif, .png or .apng file: %v", path)
+}
+
+// RecordWalkthrough runs the transformations and keeps the image before the
+// first step, after every step and after compositing.
+func RecordWalkthrough(pixels [][]color.Color, transformationList []TransformationType, options TransformOptions) ([]WalkthroughFrame, error) {
+	frames := []WalkthroughFrame{{label: "original", pixels: CopyPixelArray(pixels)}}
+	options.onStep = func(step int, transformation TransformationType, stepPixels [][]color.Color) {
+		// Later steps may change the pixels in place
+		label := fmt.Sprintf("%v. %v", step+1, transformation)
+		frames = append(frames, WalkthroughFrame{label: label, pixels: CopyPixelArray(stepPixels)})
+	}
+
+	result, err := ProcessListOfTransformationsWithOptions(pixels, transformationList, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.composite != nil {
+		frames = append(frames, WalkthroughFrame{label: "composite", pixels: result})
+	}
+	return frames, nil
+}
+
+// scaleNearest resizes with nearest neighbor sampling, so pixelated and
+// downsampled steps keep their hard edges on the shared canvas.
+func scaleNearest(pixels [][]color.Color, width int, height int) [][]color.Color {
+	if len(pixels) == width && len(pixels[0]) == height {
+		return pixels
+	}
+	scaled := make([][]color.Color, width)
+	for x := range scaled {
+		scaled[x] = make([]color.Color, height)
+		sourceX := x * len(pixels) / width
+		for y := range scaled[x] {
+			scaled[x][y] = pixels[sourceX][y*len(pixels[sourceX])/height]
+		}
+	}
+	return scaled
+}
+
+// blendPixels mixes the colors, amount 0 is all from and 1 all to.
+func blendPixels(from [][]color.Color, to [][]color.Color, amount float64) [][]color.Color {
+	mix := func(a uint32, b uint32) uint8 {
+		return uint8((float64(a)*(1-amount) + float64(b)*amount) / 257)
+	}
+	blended := make([][]color.Color, len(from))
+	for x := range from {
+		blended[x] = make([]color.Color, len(from[x]))
+		for y := range from[x] {
+			r1, g1, b1, a1 := from[x][y].RGBA()
+			r2, g2, b2, a2 := to[x][y].RGBA()
+			blended[x][y] = color.RGBA{mix(r1, r2), mix(g1, g2), mix(b1, b2), mix(a1, a2)}
+		}
+	}
+	return blended
+}
+
+func walkthroughLabelSettings(label string) TextSettings {
+	settings := getDefaultTextSettings()
+	settings.template = label
+	settings.outlineColor = color.RGBA{0, 0, 0, 255}
+	settings.gravity = GravityNorthWest
+	settings.offsetX = 4
+	settings.offsetY = 4
+	return settings
+}
+
+// BuildWalkthrough puts the frames on a canvas the size of the original,
+// labels them and adds the crossfades.  It returns the frames with their
+// delays in milliseconds.
+func BuildWalkthrough(frames []WalkthroughFrame, settings WalkthroughSettings) ([][][]color.Color, []int, error) {
+	if len(frames) == 0 || len(frames[0].pixels) == 0 || len(frames[0].pixels[0]) == 0 {
+		return nil, nil, fmt.Errorf("walkthrough has no frames")
+	}
+	width := len(frames[0].pixels)
+	height := len(frames[0].pixels[0])
+
+	var keyFrames [][][]color.Color
+	for _, frame := range frames {
+		if len(frame.pixels) == 0 || len(frame.pixels[0]) == 0 {
+			continue
+		}
+		pixels := scaleNearest(frame.pixels, width, height)
+		if settings.labels {
+			var err error
+			pixels, err = TransformPixelsText(pixels, walkthroughLabelSettings(frame.label), "")
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		keyFrames = append(keyFrames, pixels)
+	}
+
+	var result [][][]color.Color
+	var delays []int
+	for index, pixels := range keyFrames {
+		result = append(result, pixels)
+		delays = append(delays, settings.delay)
+		if index == len(keyFrames)-1 {
+			break
+		}
+		for fade := 1; fade <= settings.fade; fade++ {
+			amount := float64(fade) / float64(settings.fade+1)
+			result = append(result, blendPixels(pixels, keyFrames[index+1], amount))
+			delays = append(delays, walkthroughFadeDelay)
+		}
+	}
+	return result, delays, nil
+}
+
+// writeWalkthrough records the steps for the image and writes them as an
+// animated GIF, or an APNG for a .png or .apng file.
+func writeWalkthrough(img image.Image, params Transformation) error {
+	settings := params.walkthrough
+	pixels, err := CreatePixelArrayFromImage(img)
+	if err != nil {
+		return &DecodeError{Path: params.inputFile, Err: err}
+	}
+
+	recorded, err := RecordWalkthrough(pixels, params.transformList, params.options)
+	if err != nil {
+		return err
+	}
+	frames, delays, err := BuildWalkthrough(recorded, settings)
+	if err != nil {
+		return &EncodeError{Path: settings.file, Err: err}
+	}
+
+	var encoded bytes.Buffer
+	if strings.ToLower(filepath.Ext(settings.file)) == ".gif" {
+		animation := Animation{frames: frames}
+		for _, delay := range delays {
+			animation.delays = append(animation.delays, (delay+5)/10)
+		}
+		err = EncodeAnimation(&encoded, animation, params.gif, settings.file)
+	} else if err = EncodeAPNG(&encoded, frames, delays); err != nil {
+		err = &EncodeError{Path: settings.file, Err: err}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(settings.file, encoded.Bytes(), 0644); err != nil {
+		return &IOError{Path: settings.file, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"os"
+	"testing"
+)
+
+func TestRecordWalkthrough(t *testing.T) {
+	frames, err := RecordWalkthrough(createTwoToneArray(testRed, testBlue), []TransformationType{SwapRB, Downsample3}, TransformOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedLabels := []string{"original", "1. swap-rb", "2. downsample3"}
+	if len(frames) != len(expectedLabels) {
+		t.Fatalf("expected %v frames, got %v", len(expectedLabels), len(frames))
+	}
+	for index, frame := range frames {
+		if frame.label != expectedLabels[index] {
+			t.Errorf("frame %v: expected label %v, got %v", index, expectedLabels[index], frame.label)
+		}
+	}
+	if frames[0].pixels[0][0] != testRed.color || frames[1].pixels[0][0] != testBlue.color {
+		t.Errorf("expected the original and the swapped colors, got %v and %v", frames[0].pixels[0][0], frames[1].pixels[0][0])
+	}
+	if len(frames[2].pixels) != 6 {
+		t.Errorf("expected the downsampled size, got %v", len(frames[2].pixels))
+	}
+}
+
+func TestRecordWalkthroughComposite(t *testing.T) {
+	options := TransformOptions{composite: &CompositeSettings{opacity: 0.5}}
+	frames, err := RecordWalkthrough(createGray2DArray(), []TransformationType{Gray}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(frames) != 3 || frames[2].label != "composite" {
+		t.Errorf("expected a final composite frame, got %v frames", len(frames))
+	}
+}
+
+func TestBuildWalkthrough(t *testing.T) {
+	frames := []WalkthroughFrame{
+		{"original", scaleNearest(create2DArraySingleColor(testBlack), 40, 40)},
+		{"1. upscale2", [][]color.Color{{testWhite.color}}},
+	}
+	settings := WalkthroughSettings{delay: 500, fade: 3}
+
+	result, delays, err := BuildWalkthrough(frames, settings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result) != 5 || len(delays) != 5 {
+		t.Fatalf("expected 2 steps and 3 fades, got %v frames", len(result))
+	}
+	if delays[0] != 500 || delays[1] != walkthroughFadeDelay || delays[4] != 500 {
+		t.Errorf("unexpected delays %v", delays)
+	}
+	// Every frame has the size of the original
+	for _, frame := range result {
+		if len(frame) != len(frames[0].pixels) || len(frame[0]) != len(frames[0].pixels[0]) {
+			t.Fatalf("expected every frame on the original canvas")
+		}
+	}
+	if r, _, _, _ := result[2][0][0].RGBA(); r>>8 != 127 {
+		t.Errorf("expected the middle fade to be half way, got %v", r>>8)
+	}
+
+	settings.labels = true
+	labeled, _, err := BuildWalkthrough(frames, settings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	changed := false
+	for x := range labeled[0] {
+		for y := range labeled[0][x] {
+			changed = changed || labeled[0][x][y] != result[0][x][y]
+		}
+	}
+	if !changed {
+		t.Errorf("expected a label on the frame")
+	}
+}
+
+func TestRunWalkthrough(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := tmpDir + "/input.png"
+	if err := writePng(createTwoToneArray(testRed, testBlue), input); err != nil {
+		t.Fatalf("could not write input: %v", err)
+	}
+
+	args := []string{"-i", input, "-o", tmpDir + "/result.jpg", "-g", "-p3", "-walkthrough", tmpDir + "/steps.gif", "-walkthrough-fade", "2", "-walkthrough-delay", "200"}
+	if code := run(args); code != exitOK {
+		t.Fatalf("run exited with %v", code)
+	}
+	data, _ := os.ReadFile(tmpDir + "/steps.gif")
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected a GIF walkthrough: %v", err)
+	}
+	// 3 steps with 2 fades between each
+	if len(decoded.Image) != 7 || decoded.Delay[0] != 20 || decoded.Delay[1] != 4 {
+		t.Errorf("unexpected frames %v with delays %v", len(decoded.Image), decoded.Delay)
+	}
+
+	args[7] = tmpDir + "/steps.png"
+	if code := run(args); code != exitOK {
+		t.Fatalf("run exited with %v", code)
+	}
+	if data, _ := os.ReadFile(tmpDir + "/steps.png"); !bytes.Contains(data, []byte("acTL")) {
+		t.Errorf("expected an animated PNG")
+	}
+
+	args[7] = tmpDir + "/steps.webp"
+	if code := run(args); code != exitInvalidParameter {
+		t.Errorf("expected an invalid parameter, got %v", code)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultWatchInterval = 500 * time.Millisecond
+
+type fileState struct {
+	modified time.Time
+	size     int64
+}
+
+// Watcher polls a file or a directory tree for changed images.  Polling works
+// on every platform and file system, including network shares.  A change is
+// only reported once the file has stayed the same for a whole poll, so an
+// image that is still being written is processed once, after the writes.
+type Watcher struct {
+	root    string
+	exclude string
+	known   map[string]fileState
+	pending map[string]fileState
+}
+
+// NewWatcher records the current state of the root.  Files below exclude,
+// such as an output directory inside the input directory, are ignored.  The
+// paths are compared as absolute paths, so either may be relative.
+func NewWatcher(root string, exclude string) (*Watcher, error) {
+	if exclude != "" {
+		absExclude, err := filepath.Abs(exclude)
+		if err != nil {
+			return nil, &IOError{Path: exclude, Err: err}
+		}
+		exclude = absExclude
+	}
+	watcher := &Watcher{root: root, exclude: exclude, pending: make(map[string]fileState)}
+	known, err := watcher.scan()
+	if err != nil {
+		return nil, err
+	}
+	watcher.known = known
+	return watcher, nil
+}
+
+// Files returns the watched files in order.
+func (watcher *Watcher) Files() []string {
+	var files []string
+	for path := range watcher.known {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (watcher *Watcher) scan() (map[string]fileState, error) {
+	states := make(map[string]fileState)
+
+	info, err := os.Stat(watcher.root)
+	if err != nil {
+		return nil, &IOError{Path: watcher.root, Err: err}
+	}
+	if !info.IsDir() {
+		states[watcher.root] = fileState{info.ModTime(), info.Size()}
+		return states, nil
+	}
+
+	err = filepath.WalkDir(watcher.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return &IOError{Path: path, Err: err}
+		}
+		if entry.IsDir() {
+			if absPath, err := filepath.Abs(path); err == nil && watcher.exclude != "" && absPath == watcher.exclude {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isImageFileName(path) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Removed while walking
+			return nil
+		}
+		states[path] = fileState{info.ModTime(), info.Size()}
+		return nil
+	})
+	return states, err
+}
+
+// Poll returns the files that changed and settled since the previous polls.
+func (watcher *Watcher) Poll() ([]string, error) {
+	states, err := watcher.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	var ready []string
+	for path, state := range states {
+		if known, ok := watcher.known[path]; ok && known.equal(state) {
+			delete(watcher.pending, path)
+			continue
+		}
+		if pending, ok := watcher.pending[path]; ok && pending.equal(state) {
+			ready = append(ready, path)
+			watcher.known[path] = state
+			delete(watcher.pending, path)
+			continue
+		}
+		watcher.pending[path] = state
+	}
+
+	for path := range watcher.known {
+		if _, ok := states[path]; !ok {
+			delete(watcher.known, path)
+			delete(watcher.pending, path)
+		}
+	}
+
+	sort.Strings(ready)
+	return ready, nil
+}
+
+func (state fileState) equal(other fileState) bool {
+	return state.size == other.size && state.modified.Equal(other.modified)
+}
+
+func isImageFileName(path string) bool {
+	extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	_, ok := imageFormatNames[extension]
+	return ok || decodeOnlyFormats[extension]
+}
+
+// watchOutputPath maps an input file to its result.  For a watched directory
+// the result keeps its path below the output directory and its format, unless
+// --format asks for another.
+func watchOutputPath(params Transformation, inputDir bool, inputFile string) (string, string, error) {
+	if !inputDir {
+		return params.outputFile, params.outputFormat, nil
+	}
+
+	relative, err := filepath.Rel(params.inputFile, inputFile)
+	if err != nil {
+		return "", "", &IOError{Path: inputFile, Err: err}
+	}
+	outputFile := filepath.Join(params.outputFile, relative)
+
+	format := params.outputFormat
+	if format == "" {
+		format, err = parseImageFormat(strings.TrimPrefix(filepath.Ext(inputFile), "."))
+		if err != nil {
+			// Formats that can only be read are written as PNG
+			format = "png"
+			outputFile = strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + ".png"
+		}
+	} else {
+		outputFile = strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + "." + format
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return "", "", &IOError{Path: filepath.Dir(outputFile), Err: err}
+	}
+	return outputFile, format, nil
+}
+
+// processWatchedFiles transforms the files and reports the time of each run.
+// Errors are reported and skipped, a half saved image must not end the watch.
+func processWatchedFiles(params Transformation, inputDir bool, files []string, w io.Writer) {
+	for _, inputFile := range files {
+		start := time.Now()
+
+		outputFile, format, err := watchOutputPath(params, inputDir, inputFile)
+		if err == nil {
+			fileParams := params
+			fileParams.outputFormat = format
+			fileParams.options.sourceName = filepath.Base(inputFile)
+			err = processImageFile(fileParams, inputFile, outputFile)
+		}
+
+		if err != nil {
+			fmt.Fprintf(w, "%v: %v\n", inputFile, err)
+			continue
+		}
+		fmt.Fprintf(w, "%v -> %v in %v\n", inputFile, outputFile, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// watchLoop processes the input and then every change until the context is
+// done.
+func watchLoop(ctx context.Context, params Transformation, w io.Writer) error {
+	if params.inputFile == streamPath || params.outputFile == streamPath {
+		return &InvalidParameterError{Flag: "--watch", Err: errors.New("--watch needs an input and output file, not a stream")}
+	}
+
+	info, err := os.Stat(params.inputFile)
+	if err != nil {
+		return &IOError{Path: params.inputFile, Err: err}
+	}
+	inputDir := info.IsDir()
+
+	exclude := ""
+	if inputDir {
+		exclude = params.outputFile
+		if err := os.MkdirAll(params.outputFile, 0755); err != nil {
+			return &IOError{Path: params.outputFile, Err: err}
+		}
+	}
+
+	watcher, err := NewWatcher(filepath.Clean(params.inputFile), exclude)
+	if err != nil {
+		return err
+	}
+	processWatchedFiles(params, inputDir, watcher.Files(), w)
+	fmt.Fprintf(w, "Watching %v for changes, press Ctrl+C to stop\n", params.inputFile)
+
+	ticker := time.NewTicker(params.watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			files, err := watcher.Poll()
+			if err != nil {
+				fmt.Fprintf(w, "Error: %v\n", err)
+				continue
+			}
+			processWatchedFiles(params, inputDir, files, w)
+		}
+	}
+}
+
+func runWatch(params Transformation, w io.Writer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return watchLoop(ctx, params, w)
+}
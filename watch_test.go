@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeWatchedFile(t *testing.T, path string, data []byte, modified time.Time) {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("could not write %v: %v", path, err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("could not set the time of %v: %v", path, err)
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	writeWatchedFile(t, filepath.Join(dir, "a.png"), []byte("a"), start)
+	writeWatchedFile(t, filepath.Join(dir, "notes.txt"), []byte("n"), start)
+	os.Mkdir(filepath.Join(dir, "out"), 0755)
+	writeWatchedFile(t, filepath.Join(dir, "out", "a.png"), []byte("a"), start)
+
+	watcher, err := NewWatcher(dir, filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if files := watcher.Files(); !reflect.DeepEqual(files, []string{filepath.Join(dir, "a.png")}) {
+		t.Errorf("expected only the input image, got %v", files)
+	}
+
+	poll := func() []string {
+		files, err := watcher.Poll()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return files
+	}
+
+	if files := poll(); files != nil {
+		t.Errorf("expected no changes, got %v", files)
+	}
+
+	// Writes in quick succession are reported once, after they settle
+	writeWatchedFile(t, filepath.Join(dir, "a.png"), []byte("ab"), start.Add(time.Second))
+	if files := poll(); files != nil {
+		t.Errorf("expected the change to wait, got %v", files)
+	}
+	writeWatchedFile(t, filepath.Join(dir, "a.png"), []byte("abc"), start.Add(2*time.Second))
+	if files := poll(); files != nil {
+		t.Errorf("expected the change to wait for the last write, got %v", files)
+	}
+	if files := poll(); !reflect.DeepEqual(files, []string{filepath.Join(dir, "a.png")}) {
+		t.Errorf("expected a.png, got %v", files)
+	}
+	if files := poll(); files != nil {
+		t.Errorf("expected the change to be reported once, got %v", files)
+	}
+
+	// New files are picked up, changes in the excluded directory are not
+	writeWatchedFile(t, filepath.Join(dir, "b.jpg"), []byte("b"), start)
+	writeWatchedFile(t, filepath.Join(dir, "out", "a.png"), []byte("changed"), start.Add(time.Second))
+	poll()
+	if files := poll(); !reflect.DeepEqual(files, []string{filepath.Join(dir, "b.jpg")}) {
+		t.Errorf("expected b.jpg, got %v", files)
+	}
+
+	// An absolute input with a relative output still skips the output
+	workingDir, _ := os.Getwd()
+	relativeOut, err := filepath.Rel(workingDir, filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	watcher, err = NewWatcher(dir, relativeOut)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if files := watcher.Files(); !reflect.DeepEqual(files, []string{filepath.Join(dir, "a.png"), filepath.Join(dir, "b.jpg")}) {
+		t.Errorf("expected the relative output to be excluded, got %v", files)
+	}
+}
+
+func TestWatchOutputPath(t *testing.T) {
+	dir := t.TempDir()
+	params := getEmptyTransformationParams()
+	params.inputFile = filepath.Join(dir, "in")
+	params.outputFile = filepath.Join(dir, "out")
+
+	outputFile, format, err := watchOutputPath(params, true, filepath.Join(dir, "in", "sub", "a.png"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if outputFile != filepath.Join(dir, "out", "sub", "a.png") || format != "png" {
+		t.Errorf("unexpected output %v %v", outputFile, format)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out", "sub")); err != nil {
+		t.Errorf("expected the output directory to be created: %v", err)
+	}
+
+	params.outputFormat = "jpeg"
+	outputFile, format, _ = watchOutputPath(params, true, filepath.Join(dir, "in", "a.png"))
+	if outputFile != filepath.Join(dir, "out", "a.jpeg") || format != "jpeg" {
+		t.Errorf("unexpected output %v %v", outputFile, format)
+	}
+
+	outputFile, _, _ = watchOutputPath(params, false, params.inputFile)
+	if outputFile != params.outputFile {
+		t.Errorf("expected the output file for a single input, got %v", outputFile)
+	}
+}
+
+func TestWatchLoop(t *testing.T) {
+	dir := t.TempDir()
+	inputDir := filepath.Join(dir, "in")
+	os.Mkdir(inputDir, 0755)
+	inputFile := filepath.Join(inputDir, "gray.png")
+	outputFile := filepath.Join(dir, "out", "gray.png")
+	writeWatchedFile(t, inputFile, encodeTestPng(t), time.Now().Add(-time.Hour))
+
+	params, err := parseParameters([]string{"-i", inputDir, "-o", filepath.Join(dir, "out"), "-g", "--watch", "-watch-interval", "10"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !params.watch || params.watchInterval != 10*time.Millisecond {
+		t.Fatalf("expected watch parameters, got %v %v", params.watch, params.watchInterval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var output bytes.Buffer
+	done := make(chan error)
+	go func() { done <- watchLoop(ctx, params, &output) }()
+
+	waitFor := func(description string, condition func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				cancel()
+				<-done
+				t.Fatalf("timed out waiting for %v", description)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitFor("the first run", func() bool {
+		_, err := os.Stat(outputFile)
+		return err == nil
+	})
+	first, _ := os.Stat(outputFile)
+
+	var changed bytes.Buffer
+	encodeImage(&changed, createTwoToneArray(testRed, testBlue), "png", "changed")
+	writeWatchedFile(t, inputFile, changed.Bytes(), time.Now())
+	waitFor("the rerun", func() bool {
+		info, err := os.Stat(outputFile)
+		return err == nil && info.Size() != first.Size()
+	})
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if runs := strings.Count(output.String(), " -> "); runs != 2 {
+		t.Errorf("expected two timed runs, got %v:\n%v", runs, output.String())
+	}
+}
+
+func TestWatchLoopRejectsStreams(t *testing.T) {
+	params, err := parseParameters([]string{"-i", "-", "-o", "out.png", "--watch"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := watchLoop(context.Background(), params, &bytes.Buffer{}); exitCodeForError(err) != exitInvalidParameter {
+		t.Errorf("expected an invalid parameter error, got %v", err)
+	}
+}